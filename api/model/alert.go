@@ -19,6 +19,8 @@ type AlertHistory struct {
 	Annotations string    `json:"annotations" example:""`
 	StartAt     time.Time `json:"start_at" example:"2021-03-03 22:00:00"`
 	EndsAt      time.Time `json:"ends_at" example:"2021-03-03 22:00:00"`
+	// WorkloadName is the top controller of the pod, when the alert has one.
+	WorkloadName string `json:"workload_name" example:"fend-demo"`
 }
 
 func (a *AlertHistory) TableName() string {
@@ -76,50 +78,28 @@ func ListAlertHistory(group uint, startTime string, endTime string) []*AlertHist
 	return histories
 }
 
-func GetAlertTends(group uint, startTime string, endTime string) []*TendCount {
-	var items []*SeverityCount
-
-	t1, _ := time.Parse(TIME_LAYOUT, startTime)
-	t2, _ := time.Parse(TIME_LAYOUT, endTime)
-
-	tx := Db.Table("notification_alert_history").
-		Select("DATE(start_at) as datetime, count(1) as count, severity").
-		Group("date(start_at)").Group("severity").
-		Where("group_refer = ?", group).
-		Where("start_at  > ?", t1).
-		Where("start_at  < ?", t2)
-
-	//stmt := tx.Session(&gorm.Session{DryRun: true}).Scan(items).Statement
-	//log.Info(stmt.SQL.String())
-	tx.Scan(&items)
-	var counts []*TendCount
-	for _, v := range items {
-		switch v.Severity {
-		case "normal":
-			counts = append(counts, &TendCount{
-				NormalCount: v.Count,
-				DateTime:    v.Datetime,
-			})
-		case "warning":
-			counts = append(counts, &TendCount{
-				WarningCount: v.Count,
-				DateTime:     v.Datetime,
-			})
-		case "critical":
-			counts = append(counts, &TendCount{
-				CriticalCount: v.Count,
-				DateTime:      v.Datetime,
-			})
-		}
+func GetAlertTends(group uint, startTime string, endTime string) ([]*TendCount, error) {
+	series, err := GetAlertTrends(&TrendQuery{
+		GroupRefer:  group,
+		StartTime:   startTime,
+		EndTime:     endTime,
+		Granularity: GRANULARITY_DAY,
+	})
+	if err != nil {
+		return nil, err
 	}
-	return counts
+	return firstSeries(series), nil
 }
 
 func AddAlertHistory(r *AlertHistory) error {
-	var deployment string
-	if len(r.Pod) > 0 {
-		podArr := strings.Split(r.Pod, "-")
-		deployment = strings.Join(podArr[0:len(podArr)-2], "-")
+	deployment := r.WorkloadName
+	if len(deployment) == 0 && len(r.Pod) > 0 {
+		// guess name-<hash>-<id>; names with fewer parts have no workload
+		if podArr := strings.Split(r.Pod, "-"); len(podArr) > 2 {
+			deployment = strings.Join(podArr[0:len(podArr)-2], "-")
+		}
+	}
+	if len(deployment) > 0 && DbPlat != nil {
 		xesApp := getGroupByApp(r.Namespace, deployment)
 		if xesApp != nil && xesApp.GroupId > 0 {
 			r.GroupRefer = xesApp.GroupId
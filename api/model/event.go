@@ -13,6 +13,7 @@ type EventHistory struct {
 	GroupRefer      uint      `json:"group_id" gorm:"index"`
 	Reason          string    `json:"reason" example:"NotFound"`
 	Severity        string    `json:"severity" example:"warning"`
+	EventType       string    `json:"event_type" example:"Warning"`
 	Cluster         string    `json:"cluster" example:"aaa"`
 	Namespace       string    `json:"namespace" example:"jichujiagou_common"`
 	ObjKind         string    `json:"obj_kind" example:"deployment"`
@@ -21,6 +22,19 @@ type EventHistory struct {
 	Message         string    `json:"message" example:"fend-demo Not found"`
 	SourceComponent string    `json:"source_component"`
 	SourceHost      string    `json:"source_host"`
+	// Fingerprint identifies repeated occurrences of the same event, which
+	// update one row instead of inserting new ones.
+	Fingerprint string    `json:"fingerprint" gorm:"index"`
+	Count       int32     `json:"count" example:"1"`
+	FirstSeen   time.Time `json:"first_seen" example:"2021-03-03 22:00:00"`
+	// Set by events.k8s.io/v1 events only.
+	ReportingController string `json:"reporting_controller" example:"kubelet"`
+	ReportingInstance   string `json:"reporting_instance" example:"kubelet-node-1"`
+	RelatedKind         string `json:"related_kind" example:"Node"`
+	RelatedName         string `json:"related_name" example:"node-1"`
+	// WorkloadKind and WorkloadName are the top controller of the object.
+	WorkloadKind string `json:"workload_kind" example:"Deployment"`
+	WorkloadName string `json:"workload_name" example:"fend-demo"`
 }
 
 func (a *EventHistory) TableName() string {
@@ -74,85 +88,59 @@ type EventReasonsRepose struct {
 	Data    map[string]string `json:"data"`
 }
 
-func ListEventHistory(group uint, startTime string, endTime string) []*EventHistory {
-	var histories []*EventHistory
-	start, _ := time.Parse(TIME_LAYOUT, startTime)
-	end, _ := time.Parse(TIME_LAYOUT, endTime)
-	tx := Db.Table("notification_event_history").
-		Where("group_refer = ?", group).
-		Where("datetime  > ?", start).
-		Where("datetime  < ?", end).Limit(100).Order("id Desc")
-	tx.Scan(&histories)
-	return histories
+func ListEventHistory(group uint, startTime string, endTime string) ([]*EventHistory, error) {
+	page, err := QueryEventHistory(&EventHistoryQuery{
+		GroupRefer: group,
+		StartTime:  startTime,
+		EndTime:    endTime,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return page.Events, nil
 }
 
-func GetEventTends(group uint, startTime string, endTime string) []*TendCount {
-	var items []*SeverityCount
-
-	t1, _ := time.Parse(TIME_LAYOUT, startTime)
-	t2, _ := time.Parse(TIME_LAYOUT, endTime)
-
-	tx := Db.Table("notification_event_history").
-		Select("DATE(datetime) as datetime, count(1) as count, severity").
-		Group("date(datetime)").Group("severity").
-		Where("group_refer = ?", group).
-		Where("datetime  > ?", t1).
-		Where("datetime  < ?", t2)
-
-	//stmt := tx.Session(&gorm.Session{DryRun: true}).Scan(items).Statement
-	//log.Info(stmt.SQL.String())
-	tx.Scan(&items)
-	var counts []*TendCount
-	for _, v := range items {
-		switch v.Severity {
-		case "normal":
-			counts = append(counts, &TendCount{
-				NormalCount: v.Count,
-				DateTime:    v.Datetime,
-			})
-		case "warning":
-			counts = append(counts, &TendCount{
-				WarningCount: v.Count,
-				DateTime:     v.Datetime,
-			})
-		case "critical":
-			counts = append(counts, &TendCount{
-				CriticalCount: v.Count,
-				DateTime:      v.Datetime,
-			})
-		}
+func GetEventTends(group uint, startTime string, endTime string) ([]*TendCount, error) {
+	series, err := GetEventTrends(&TrendQuery{
+		GroupRefer:  group,
+		StartTime:   startTime,
+		EndTime:     endTime,
+		Granularity: GRANULARITY_DAY,
+	})
+	if err != nil {
+		return nil, err
 	}
-	return counts
+	return firstSeries(series), nil
 }
 
 func AddEventHistory(r *EventHistory) (error,uint) {
-	// @todo 导致panic
-	//var xesApp *XesApp
-	//switch r.ObjKind {
-	//case "Pod":
-	//	xesApp = SplitForGetXesApp(r, 2)
-	//case "Deployment":
-	//	xesApp = SplitForGetXesApp(r, 0)
-	//case "Ingress":
-	//	xesApp = SplitForGetXesApp(r, 1)
-	//case "Service":
-	//	xesApp = SplitForGetXesApp(r, 1)
-	//case "ReplicaSet":
-	//	xesApp = SplitForGetXesApp(r, 1)
-	//case "Node":
-	//
-	//}
-	//if xesApp != nil && xesApp.GroupId > 0 {
-	//	r.GroupRefer = xesApp.GroupId
-	//}
+	// the group comes from the resolved workload, not from splitting names
+	if len(r.WorkloadName) > 0 && DbPlat != nil {
+		if xesApp := getGroupByApp(r.Namespace, r.WorkloadName); xesApp.GroupId > 0 {
+			r.GroupRefer = xesApp.GroupId
+		}
+	}
 	result := Db.Create(r)
 	return result.Error,r.ID
 }
 
+// UpdateEventHistory refreshes the occurrence count, last seen time, message
+// and severity of an existing history row.
+func UpdateEventHistory(id uint, count int32, lastSeen time.Time, message, severity string) error {
+	result := Db.Model(&EventHistory{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"count":    count,
+		"datetime": lastSeen,
+		"message":  message,
+		"severity": severity,
+	})
+	return result.Error
+}
+
 func SplitForGetXesApp(r *EventHistory, subLen int) *XesApp {
 	var deployment string
-	if subLen > 0 {
-		podArr := strings.Split(r.ObjName, "-")
+	if r.WorkloadName != "" {
+		deployment = r.WorkloadName
+	} else if podArr := strings.Split(r.ObjName, "-"); subLen > 0 && len(podArr) > subLen {
 		deployment = strings.Join(podArr[0:len(podArr)-subLen], "-")
 	} else {
 		deployment = r.ObjName
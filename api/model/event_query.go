@@ -0,0 +1,220 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultEventQueryLimit = 100
+	MaxEventQueryLimit     = 1000
+	// EventDatetimeWindow is the range searched around `datetime` when the
+	// caller (e.g. the Yach detail link) only knows when the event happened.
+	EventDatetimeWindow = 30 * time.Minute
+
+	eventFacetLimit = 20
+
+	SORT_ASC  = "asc"
+	SORT_DESC = "desc"
+)
+
+// EventHistoryQuery carries every filter accepted by the event history API.
+// Field names follow the query parameters of the Yach detail link.
+type EventHistoryQuery struct {
+	GroupRefer    uint   `json:"group_id" form:"group_id"`
+	Reason        string `json:"reason" form:"reason"`
+	Severity      string `json:"severity" form:"severity"`
+	Cluster       string `json:"cluster" form:"cluster"`
+	Namespace     string `json:"namespace" form:"namespace"`
+	ObjKind       string `json:"obj_kind" form:"obj_kind"`
+	ObjNamePrefix string `json:"obj_name" form:"obj_name"`
+	SourceHost    string `json:"source_host" form:"source_host"`
+	Message       string `json:"message" form:"message"`
+	Datetime      string `json:"datetime" form:"datetime" example:"2021-03-03 22:00:00"`
+	StartTime     string `json:"start_time" form:"start_time" example:"2021-03-03 22:00:00"`
+	EndTime       string `json:"end_time" form:"end_time" example:"2021-03-03 23:00:00"`
+	Cursor        uint   `json:"cursor" form:"cursor"`
+	Limit         int    `json:"limit" form:"limit" example:"100"`
+	Sort          string `json:"sort" form:"sort" example:"desc"`
+
+	start time.Time
+	end   time.Time
+}
+
+type FacetCount struct {
+	Value string `json:"value" gorm:"column:value;"`
+	Count int64  `json:"count" gorm:"column:count;"`
+}
+
+type EventHistoryFacets struct {
+	Reasons    []*FacetCount `json:"reasons"`
+	Namespaces []*FacetCount `json:"namespaces"`
+}
+
+type EventHistoryPage struct {
+	Total      int64               `json:"total"`
+	NextCursor uint                `json:"next_cursor"`
+	Events     []*EventHistory     `json:"events"`
+	Facets     *EventHistoryFacets `json:"facets"`
+}
+
+type EventHistoryPageRepose struct {
+	Code    int               `json:"code" example:"0"`
+	Stat    int               `json:"stat" example:"0"`
+	Message string            `json:"msg" example:""`
+	Data    *EventHistoryPage `json:"data"`
+}
+
+// Validate parses the time range and normalizes limit and sort order.
+func (q *EventHistoryQuery) Validate() error {
+	var err error
+	if len(q.StartTime) > 0 {
+		if q.start, err = time.ParseInLocation(TIME_LAYOUT, q.StartTime, time.Local); err != nil {
+			return fmt.Errorf("invalid start_time %q: %v", q.StartTime, err)
+		}
+	}
+	if len(q.EndTime) > 0 {
+		if q.end, err = time.ParseInLocation(TIME_LAYOUT, q.EndTime, time.Local); err != nil {
+			return fmt.Errorf("invalid end_time %q: %v", q.EndTime, err)
+		}
+	}
+	if len(q.Datetime) > 0 && q.start.IsZero() && q.end.IsZero() {
+		t, err := time.ParseInLocation(TIME_LAYOUT, q.Datetime, time.Local)
+		if err != nil {
+			return fmt.Errorf("invalid datetime %q: %v", q.Datetime, err)
+		}
+		q.start = t.Add(-EventDatetimeWindow)
+		q.end = t.Add(EventDatetimeWindow)
+	}
+	if !q.start.IsZero() && !q.end.IsZero() && q.end.Before(q.start) {
+		return errors.New("end_time is before start_time")
+	}
+
+	switch {
+	case q.Limit <= 0:
+		q.Limit = DefaultEventQueryLimit
+	case q.Limit > MaxEventQueryLimit:
+		q.Limit = MaxEventQueryLimit
+	}
+
+	q.Sort = strings.ToLower(q.Sort)
+	switch q.Sort {
+	case "":
+		q.Sort = SORT_DESC
+	case SORT_ASC, SORT_DESC:
+	default:
+		return fmt.Errorf("invalid sort %q", q.Sort)
+	}
+	return nil
+}
+
+// filters applies every filter except the cursor, so that the same scope
+// serves the page, the total count and the facets.
+func (q *EventHistoryQuery) filters(tx *gorm.DB) *gorm.DB {
+	if q.GroupRefer > 0 {
+		tx = tx.Where("group_refer = ?", q.GroupRefer)
+	}
+	if len(q.Reason) > 0 {
+		tx = tx.Where("reason = ?", q.Reason)
+	}
+	if len(q.Severity) > 0 {
+		tx = tx.Where("severity = ?", strings.ToLower(q.Severity))
+	}
+	if len(q.Cluster) > 0 {
+		tx = tx.Where("cluster = ?", q.Cluster)
+	}
+	if len(q.Namespace) > 0 {
+		tx = tx.Where("namespace = ?", q.Namespace)
+	}
+	if len(q.ObjKind) > 0 {
+		tx = tx.Where("obj_kind = ?", q.ObjKind)
+	}
+	if len(q.ObjNamePrefix) > 0 {
+		tx = tx.Where("obj_name like ?", escapeLike(q.ObjNamePrefix)+"%")
+	}
+	if len(q.SourceHost) > 0 {
+		tx = tx.Where("source_host = ?", q.SourceHost)
+	}
+	if len(q.Message) > 0 {
+		tx = tx.Where("message like ?", "%"+escapeLike(q.Message)+"%")
+	}
+	if !q.start.IsZero() {
+		tx = tx.Where("datetime  > ?", q.start)
+	}
+	if !q.end.IsZero() {
+		tx = tx.Where("datetime  < ?", q.end)
+	}
+	return tx
+}
+
+func (q *EventHistoryQuery) cursor(tx *gorm.DB) *gorm.DB {
+	if q.Sort == SORT_ASC {
+		if q.Cursor > 0 {
+			tx = tx.Where("id > ?", q.Cursor)
+		}
+		return tx.Order("id asc")
+	}
+	if q.Cursor > 0 {
+		tx = tx.Where("id < ?", q.Cursor)
+	}
+	return tx.Order("id desc")
+}
+
+// QueryEventHistory returns one page of event history matching q together with
+// the total number of matches and the most frequent reasons and namespaces.
+func QueryEventHistory(q *EventHistoryQuery) (*EventHistoryPage, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	page := &EventHistoryPage{
+		Events: []*EventHistory{},
+		Facets: &EventHistoryFacets{},
+	}
+
+	tx := Db.Table("notification_event_history").
+		Scopes(q.filters, q.cursor).
+		Limit(q.Limit).
+		Scan(&page.Events)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	if len(page.Events) == q.Limit {
+		page.NextCursor = page.Events[len(page.Events)-1].ID
+	}
+
+	tx = Db.Table("notification_event_history").
+		Scopes(q.filters).
+		Count(&page.Total)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+
+	var err error
+	if page.Facets.Reasons, err = q.facet("reason"); err != nil {
+		return nil, err
+	}
+	if page.Facets.Namespaces, err = q.facet("namespace"); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+func (q *EventHistoryQuery) facet(column string) ([]*FacetCount, error) {
+	facets := []*FacetCount{}
+	tx := Db.Table("notification_event_history").
+		Scopes(q.filters).
+		Select(column + " as value, count(1) as count").
+		Group(column).
+		Order("count desc").
+		Limit(eventFacetLimit).
+		Scan(&facets)
+	return facets, tx.Error
+}
+
+// escapeLike escapes the LIKE wildcards so user input is matched literally.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -3,8 +3,10 @@ package model
 import (
 	"context"
 	"fmt"
+	"github.com/crain-cn/event-mesh/cmd/config"
 	v1 "github.com/crain-cn/event-mesh/pkg/k8s/apis/eventmesh/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"regexp"
 	"strings"
 	"time"
 )
@@ -24,6 +26,12 @@ type EventRule struct {
 	Datetime time.Time `json:"datetime" example:"2021-03-03 22:00:00"`
 	Events   string    `json:"events"`
 	Status   string    `json:"status" example:"On"`
+	// Threshold makes the rule a count rule: the events are notified together
+	// once more than Threshold of them are seen within Window, for For.
+	Threshold int    `json:"threshold" example:"5"`
+	Window    string `json:"window" example:"10m"`
+	For       string `json:"for" example:"0s"`
+	GroupBy   string `json:"group_by" example:"namespace,workload_name"`
 }
 
 func (a *EventRule) TableName() string {
@@ -94,6 +102,75 @@ func AddEventRule(r *EventRule) (*EventRule, error) {
 	return nil, result.Error
 }
 
+// GetEventCountRules returns the rules that are on and have a threshold as
+// count rules. A rule of an app counts the pods of its deployment, a rule of a
+// group the events of its namespaces. They always group by namespace, the
+// event routes match on it.
+func GetEventCountRules() ([]*config.CountRule, error) {
+	var eventRules []*EventRule
+	result := Db.Where("status = ? AND threshold > 0", STATUS_ON).Find(&eventRules)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	rules := make([]*config.CountRule, 0, len(eventRules))
+	for _, r := range eventRules {
+		rule := &config.CountRule{
+			FilterRule: config.FilterRule{
+				Name:    r.Name,
+				Reasons: splitEventList(r.Events),
+			},
+			GroupBy:   []string{"namespace"},
+			Threshold: r.Threshold,
+			Severity:  r.Severity,
+		}
+		var err error
+		if len(r.Window) > 0 {
+			if rule.Window, err = time.ParseDuration(r.Window); err != nil {
+				log.Error("event rule ", r.Name, " window: ", err)
+				continue
+			}
+		}
+		if len(r.For) > 0 {
+			if rule.For, err = time.ParseDuration(r.For); err != nil {
+				log.Error("event rule ", r.Name, " for: ", err)
+				continue
+			}
+		}
+		for _, label := range splitEventList(r.GroupBy) {
+			if label != "namespace" {
+				rule.GroupBy = append(rule.GroupBy, label)
+			}
+		}
+		switch {
+		case r.App > 0:
+			xesApp := getDeployemtByApp(r.GroupRefer, r.App)
+			rule.Kinds = []string{"Pod"}
+			rule.Namespaces = []string{xesApp.Namespace}
+			rule.NameRegex = "^" + regexp.QuoteMeta(xesApp.Deployment) + "-"
+		case r.GroupRefer > 0:
+			seen := make(map[string]bool)
+			for _, xesApp := range getNamespacesByGroup(r.GroupRefer) {
+				if !seen[xesApp.Namespace] {
+					seen[xesApp.Namespace] = true
+					rule.Namespaces = append(rule.Namespaces, xesApp.Namespace)
+				}
+			}
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func splitEventList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); len(item) > 0 {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 func createEventResource(r *EventRule) {
 	receiver := GetReceiverById(r.ReceiverRefer)
 	events := strings.Replace(r.Events, ",", "|", -1)
@@ -115,6 +192,13 @@ func createEventResource(r *EventRule) {
 			{Name: "event_reason", Value: events, Regex: true},
 			{Name: "obj_name", Value: fmt.Sprintf("%s.*", xesApp.Deployment), Regex: true},
 		}
+		// count rules route the alerts of their counts, not the events
+		if r.Threshold > 0 {
+			matchers = []v1.Matcher{
+				{Name: "namespace", Value: namesapce},
+				{Name: "count_rule", Value: r.Name},
+			}
+		}
 
 		_, err := Clients.client.EventmeshV1().EventRoutes(namesapce).Create(context.TODO(), &v1.EventRoute{
 			ObjectMeta: metav1.ObjectMeta{
@@ -62,17 +62,13 @@ func getAppGroup(group_id uint) *AppGroup {
 	return AppGroup
 }
 
-func GetAppUserAll() map[string]string {
+// GetAppOwnersAll returns the manager of every app that has one.
+func GetAppOwnersAll() ([]*XesDeploy, error) {
 	xesDeploy := []*XesDeploy{}
 	tx := DbPlat.Table("k8s_platform.xes_cloud_app").
 		Select("k8s_platform.xes_cloud_app.namespace as namespace,k8s_platform.xes_cloud_app.deployment as deployment,k8s_platform.xes_cloud_app.manager_id as manager_id,k8s_platform.xes_cloud_user.name as name,k8s_platform.xes_cloud_user.email as email,k8s_platform.xes_cloud_user.workcode as workcode").
 		Joins("left join k8s_platform.xes_cloud_user  on k8s_platform.xes_cloud_user.id = k8s_platform.xes_cloud_app.manager_id").
 		Where("k8s_platform.xes_cloud_user.name is NOT NULL")
-	tx.Scan(&xesDeploy)
-
-	users := make(map[string]string,0)
-	for _,value := range xesDeploy {
-		users[value.Namespace + "|" + value.Deployment] = value.Workcode
-	}
-	return users
+	err := tx.Scan(&xesDeploy).Error
+	return xesDeploy, err
 }
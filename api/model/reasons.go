@@ -12,13 +12,63 @@ func (a *EventReasons) TableName() string {
 	return "notification_reasons"
 }
 
-func GetEventReasonsAll() map[string]string {
+type EventReasonsListRepose struct {
+	Code    int             `json:"code" example:"0"`
+	Stat    int             `json:"stat" example:"0"`
+	Message string          `json:"msg" example:""`
+	Data    []*EventReasons `json:"data"`
+}
+
+// EventReasonRepose is the response of a single reason; EventReasonsRepose
+// is the one of the name to label map.
+type EventReasonRepose struct {
+	Code    int           `json:"code" example:"0"`
+	Stat    int           `json:"stat" example:"0"`
+	Message string        `json:"msg" example:""`
+	Data    *EventReasons `json:"data"`
+}
+
+// GetEventReasonsAll returns the reason dictionary.
+func GetEventReasonsAll() ([]*EventReasons, error) {
 	var eventReasons []*EventReasons
 	tx := Db.Table("notification_reasons")
+	err := tx.Order("id desc").Limit(1000).Find(&eventReasons).Error
+	return eventReasons, err
+}
+
+func ListEventReasons(name string, classId int) []*EventReasons {
+	var eventReasons []*EventReasons
+	tx := Db.Table("notification_reasons")
+	if len(name) > 0 {
+		tx = tx.Where("name like ?", "%"+name+"%")
+	}
+	if classId > 0 {
+		tx = tx.Where("class_id = ?", classId)
+	}
 	tx.Order("id desc").Limit(1000).Find(&eventReasons)
-	reasons := make(map[string]string,0)
-	for _,value := range eventReasons {
-		reasons[value.Name] = value.Label
+	return eventReasons
+}
+
+func GetEventReason(id uint) *EventReasons {
+	reason := &EventReasons{}
+	Db.Where(&EventReasons{ID: id}).First(reason)
+	return reason
+}
+
+func AddEventReason(r *EventReasons) (*EventReasons, error) {
+	result := Db.Create(r)
+	return r, result.Error
+}
+
+func UpdateEventReason(update *EventReasons) (*EventReasons, error) {
+	result := Db.Model(&EventReasons{}).Where("id =?", update.ID).Updates(update)
+	if result.Error != nil {
+		return nil, result.Error
 	}
-	return reasons
+	return GetEventReason(update.ID), nil
+}
+
+func DeleteEventReason(id uint) error {
+	tx := Db.Where("id =?", id).Delete(&EventReasons{})
+	return tx.Error
 }
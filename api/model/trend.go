@@ -0,0 +1,346 @@
+package model
+
+import (
+	"fmt"
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
+
+const (
+	GRANULARITY_MINUTE = "minute"
+	GRANULARITY_HOUR   = "hour"
+	GRANULARITY_DAY    = "day"
+
+	DefaultTopWorkloads = 10
+	MaxTopWorkloads     = 100
+
+	weekDuration = 7 * 24 * time.Hour
+)
+
+// bucketFormats are the MySQL DATE_FORMAT layouts used to truncate a
+// timestamp to the requested granularity. Each one renders in TIME_LAYOUT.
+var bucketFormats = map[string]string{
+	GRANULARITY_MINUTE: "%Y-%m-%d %H:%i:00",
+	GRANULARITY_HOUR:   "%Y-%m-%d %H:00:00",
+	GRANULARITY_DAY:    "%Y-%m-%d 00:00:00",
+}
+
+// trendSource describes a history table the trend queries can run against.
+type trendSource struct {
+	table      string
+	timeColumn string
+	// dimensions maps the group_by names accepted by the API to columns.
+	dimensions map[string]string
+}
+
+var (
+	eventTrendSource = &trendSource{
+		table:      "notification_event_history",
+		timeColumn: "datetime",
+		dimensions: map[string]string{
+			"cluster":   "cluster",
+			"namespace": "namespace",
+			"reason":    "reason",
+			"obj_kind":  "obj_kind",
+			"group":     "group_refer",
+		},
+	}
+	alertTrendSource = &trendSource{
+		table:      "notification_alert_history",
+		timeColumn: "start_at",
+		dimensions: map[string]string{
+			"cluster":   "cluster",
+			"namespace": "namespace",
+			"alertname": "alert_name",
+			"group":     "group_refer",
+		},
+	}
+)
+
+type TrendQuery struct {
+	GroupRefer  uint   `json:"group_id" form:"group_id"`
+	Cluster     string `json:"cluster" form:"cluster"`
+	Namespace   string `json:"namespace" form:"namespace"`
+	StartTime   string `json:"start_time" form:"start_time" example:"2021-03-03 00:00:00"`
+	EndTime     string `json:"end_time" form:"end_time" example:"2021-03-04 00:00:00"`
+	Granularity string `json:"granularity" form:"granularity" example:"hour"`
+	GroupBy     string `json:"group_by" form:"group_by" example:"namespace"`
+	Limit       int    `json:"limit" form:"limit" example:"10"`
+
+	start time.Time
+	end   time.Time
+}
+
+// TendSeries is one line of a trend chart. Key is the value of the group_by
+// dimension, or empty when the trend is not grouped.
+type TendSeries struct {
+	Key   string       `json:"key"`
+	Tends []*TendCount `json:"tends"`
+}
+
+type WorkloadTendCount struct {
+	Cluster       string `json:"cluster" gorm:"column:cluster;"`
+	Namespace     string `json:"namespace" gorm:"column:namespace;"`
+	WorkloadKind  string `json:"workload_kind" gorm:"column:workload_kind;"`
+	WorkloadName  string `json:"workload_name" gorm:"column:workload_name;"`
+	CriticalCount int    `json:"critical_count" gorm:"column:critical_count;"`
+	WarningCount  int    `json:"warning_count" gorm:"column:warning_count;"`
+	NormalCount   int    `json:"normal_count" gorm:"column:normal_count;"`
+	Count         int    `json:"count" gorm:"column:count;"`
+}
+
+// TendComparison compares a period with the same period one week earlier.
+// Previous buckets are shifted forward by a week so they line up with Current.
+type TendComparison struct {
+	Current       []*TendCount `json:"current"`
+	Previous      []*TendCount `json:"previous"`
+	CurrentTotal  *TendCount   `json:"current_total"`
+	PreviousTotal *TendCount   `json:"previous_total"`
+	// ChangeRate is (current - previous) / previous over all severities;
+	// it is zero when the previous week had no data.
+	ChangeRate float64 `json:"change_rate"`
+}
+
+type TendSeriesRepose struct {
+	Code    int           `json:"code" example:"0"`
+	Stat    int           `json:"stat" example:"0"`
+	Message string        `json:"msg" example:""`
+	Data    []*TendSeries `json:"data"`
+}
+
+type WorkloadTendRepose struct {
+	Code    int                  `json:"code" example:"0"`
+	Stat    int                  `json:"stat" example:"0"`
+	Message string               `json:"msg" example:""`
+	Data    []*WorkloadTendCount `json:"data"`
+}
+
+type TendComparisonRepose struct {
+	Code    int             `json:"code" example:"0"`
+	Stat    int             `json:"stat" example:"0"`
+	Message string          `json:"msg" example:""`
+	Data    *TendComparison `json:"data"`
+}
+
+type trendRow struct {
+	Bucket    string `gorm:"column:bucket;"`
+	Dimension string `gorm:"column:dimension;"`
+	Severity  string `gorm:"column:severity;"`
+	Count     int    `gorm:"column:count;"`
+}
+
+func (q *TrendQuery) validate(src *trendSource) error {
+	var err error
+	if q.start, err = time.ParseInLocation(TIME_LAYOUT, q.StartTime, time.Local); err != nil {
+		return fmt.Errorf("invalid start_time %q: %v", q.StartTime, err)
+	}
+	if q.end, err = time.ParseInLocation(TIME_LAYOUT, q.EndTime, time.Local); err != nil {
+		return fmt.Errorf("invalid end_time %q: %v", q.EndTime, err)
+	}
+	if q.end.Before(q.start) {
+		return fmt.Errorf("end_time is before start_time")
+	}
+	if len(q.Granularity) == 0 {
+		q.Granularity = GRANULARITY_DAY
+	}
+	if _, ok := bucketFormats[q.Granularity]; !ok {
+		return fmt.Errorf("invalid granularity %q", q.Granularity)
+	}
+	if len(q.GroupBy) > 0 {
+		if _, ok := src.dimensions[q.GroupBy]; !ok {
+			return fmt.Errorf("invalid group_by %q", q.GroupBy)
+		}
+	}
+	switch {
+	case q.Limit <= 0:
+		q.Limit = DefaultTopWorkloads
+	case q.Limit > MaxTopWorkloads:
+		q.Limit = MaxTopWorkloads
+	}
+	return nil
+}
+
+func (q *TrendQuery) scope(src *trendSource, start, end time.Time) func(*gorm.DB) *gorm.DB {
+	return func(tx *gorm.DB) *gorm.DB {
+		if q.GroupRefer > 0 {
+			tx = tx.Where("group_refer = ?", q.GroupRefer)
+		}
+		if len(q.Cluster) > 0 {
+			tx = tx.Where("cluster = ?", q.Cluster)
+		}
+		if len(q.Namespace) > 0 {
+			tx = tx.Where("namespace = ?", q.Namespace)
+		}
+		return tx.Where(src.timeColumn+" >= ?", start).
+			Where(src.timeColumn+" < ?", end)
+	}
+}
+
+func (src *trendSource) series(q *TrendQuery, start, end time.Time) ([]*TendSeries, error) {
+	dimension := "''"
+	if len(q.GroupBy) > 0 {
+		dimension = src.dimensions[q.GroupBy]
+	}
+	bucket := fmt.Sprintf("DATE_FORMAT(%s, '%s')", src.timeColumn, bucketFormats[q.Granularity])
+
+	var rows []*trendRow
+	tx := Db.Table(src.table).
+		Scopes(q.scope(src, start, end)).
+		Select(fmt.Sprintf("%s as bucket, %s as dimension, severity, count(1) as count", bucket, dimension)).
+		Group("bucket").Group("dimension").Group("severity").
+		Order("bucket asc").
+		Scan(&rows)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+
+	var series []*TendSeries
+	byKey := map[string]*TendSeries{}
+	byBucket := map[string]*TendCount{}
+	for _, row := range rows {
+		s, ok := byKey[row.Dimension]
+		if !ok {
+			s = &TendSeries{Key: row.Dimension}
+			byKey[row.Dimension] = s
+			series = append(series, s)
+		}
+		c, ok := byBucket[row.Dimension+"|"+row.Bucket]
+		if !ok {
+			t, err := time.ParseInLocation(TIME_LAYOUT, row.Bucket, time.Local)
+			if err != nil {
+				return nil, err
+			}
+			c = &TendCount{DateTime: t}
+			byBucket[row.Dimension+"|"+row.Bucket] = c
+			s.Tends = append(s.Tends, c)
+		}
+		c.add(row.Severity, row.Count)
+	}
+	return series, nil
+}
+
+// add accumulates count into the severity column. Severities other than
+// critical and warning are counted as normal so no row is dropped.
+func (c *TendCount) add(severity string, count int) {
+	switch strings.ToLower(severity) {
+	case "critical":
+		c.CriticalCount += count
+	case "warning":
+		c.WarningCount += count
+	default:
+		c.NormalCount += count
+	}
+}
+
+func (c *TendCount) total() int {
+	return c.CriticalCount + c.WarningCount + c.NormalCount
+}
+
+func (src *trendSource) trends(q *TrendQuery) ([]*TendSeries, error) {
+	if err := q.validate(src); err != nil {
+		return nil, err
+	}
+	return src.series(q, q.start, q.end)
+}
+
+func (src *trendSource) weekOverWeek(q *TrendQuery) (*TendComparison, error) {
+	q.GroupBy = ""
+	if err := q.validate(src); err != nil {
+		return nil, err
+	}
+	current, err := src.series(q, q.start, q.end)
+	if err != nil {
+		return nil, err
+	}
+	previous, err := src.series(q, q.start.Add(-weekDuration), q.end.Add(-weekDuration))
+	if err != nil {
+		return nil, err
+	}
+
+	cmp := &TendComparison{
+		Current:       []*TendCount{},
+		Previous:      []*TendCount{},
+		CurrentTotal:  &TendCount{DateTime: q.start},
+		PreviousTotal: &TendCount{DateTime: q.start.Add(-weekDuration)},
+	}
+	for _, s := range current {
+		for _, c := range s.Tends {
+			cmp.Current = append(cmp.Current, c)
+			cmp.CurrentTotal.CriticalCount += c.CriticalCount
+			cmp.CurrentTotal.WarningCount += c.WarningCount
+			cmp.CurrentTotal.NormalCount += c.NormalCount
+		}
+	}
+	for _, s := range previous {
+		for _, c := range s.Tends {
+			cmp.PreviousTotal.CriticalCount += c.CriticalCount
+			cmp.PreviousTotal.WarningCount += c.WarningCount
+			cmp.PreviousTotal.NormalCount += c.NormalCount
+			c.DateTime = c.DateTime.Add(weekDuration)
+			cmp.Previous = append(cmp.Previous, c)
+		}
+	}
+	if prev := cmp.PreviousTotal.total(); prev > 0 {
+		cmp.ChangeRate = float64(cmp.CurrentTotal.total()-prev) / float64(prev)
+	}
+	return cmp, nil
+}
+
+// GetEventTrends returns event counts per severity bucketed by q.Granularity,
+// one series per value of q.GroupBy.
+func GetEventTrends(q *TrendQuery) ([]*TendSeries, error) {
+	return eventTrendSource.trends(q)
+}
+
+// GetAlertTrends is GetEventTrends for the alert history.
+func GetAlertTrends(q *TrendQuery) ([]*TendSeries, error) {
+	return alertTrendSource.trends(q)
+}
+
+// GetEventTendsWeekOverWeek compares the events of q's time range with the
+// same range one week earlier.
+func GetEventTendsWeekOverWeek(q *TrendQuery) (*TendComparison, error) {
+	return eventTrendSource.weekOverWeek(q)
+}
+
+// GetAlertTendsWeekOverWeek is GetEventTendsWeekOverWeek for the alert history.
+func GetAlertTendsWeekOverWeek(q *TrendQuery) (*TendComparison, error) {
+	return alertTrendSource.weekOverWeek(q)
+}
+
+// GetTopWorkloads returns the q.Limit workloads that produced the most events
+// in q's time range. The events of an object without a workload, or recorded
+// before the workload was resolved, count for the object itself.
+func GetTopWorkloads(q *TrendQuery) ([]*WorkloadTendCount, error) {
+	q.GroupBy = ""
+	if err := q.validate(eventTrendSource); err != nil {
+		return nil, err
+	}
+	workloads := []*WorkloadTendCount{}
+	tx := Db.Table(eventTrendSource.table).
+		Scopes(q.scope(eventTrendSource, q.start, q.end)).
+		Select("cluster, namespace, " +
+			"coalesce(nullif(workload_kind, ''), obj_kind) as workload_kind, " +
+			"coalesce(nullif(workload_name, ''), obj_name) as workload_name, " +
+			"sum(case when severity = 'critical' then 1 else 0 end) as critical_count, " +
+			"sum(case when severity = 'warning' then 1 else 0 end) as warning_count, " +
+			"sum(case when severity not in ('critical', 'warning') then 1 else 0 end) as normal_count, " +
+			"count(1) as count").
+		// grouped by the expressions: the aliases are also column names,
+		// which MySQL would group by instead
+		Group("cluster").Group("namespace").
+		Group("coalesce(nullif(workload_kind, ''), obj_kind)").
+		Group("coalesce(nullif(workload_name, ''), obj_name)").
+		Order("count desc").
+		Limit(q.Limit).
+		Scan(&workloads)
+	return workloads, tx.Error
+}
+
+func firstSeries(series []*TendSeries) []*TendCount {
+	if len(series) == 0 {
+		return []*TendCount{}
+	}
+	return series[0].Tends
+}
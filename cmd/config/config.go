@@ -6,6 +6,8 @@ import (
 	"gopkg.in/yaml.v2"
 	"io/ioutil"
 	"os"
+	"sync"
+	"time"
 )
 
 var (
@@ -18,6 +20,116 @@ type ConfigResolver struct {
 	Databases  []*Database     `yaml:"databases"`
 	Sessions   []*SessionStore `yaml:"sessions"`
 	EventSinks []*EventSinks   `yaml:"eventSinks"`
+	// EventFilterRules are evaluated after the per-cluster rules. When empty
+	// the built-in default rules are used.
+	EventFilterRules []*FilterRule `yaml:"eventFilterRules"`
+	// EventSeverityRules are evaluated after the per-cluster severity rules.
+	EventSeverityRules []*SeverityRule `yaml:"eventSeverityRules"`
+	// EventResolveRules are evaluated after the per-cluster resolve rules.
+	// When both are empty the built-in default rules are used.
+	EventResolveRules []*ResolveRule `yaml:"eventResolveRules"`
+	// EventCountRules are evaluated for every cluster, after its own count
+	// rules.
+	EventCountRules []*CountRule `yaml:"eventCountRules"`
+	// OwnerDirectory configures who is mentioned in notifications. When
+	// unset the owners are read from the platform database.
+	OwnerDirectory *OwnerDirectoryOpt `yaml:"ownerDirectory"`
+	// ReasonDictionary configures where the event reasons are described.
+	// When unset they are read from the database.
+	ReasonDictionary *ReasonDictionaryOpt `yaml:"reasonDictionary"`
+	// ClusterHealth configures when the event source of a cluster is down.
+	ClusterHealth *ClusterHealthOpt `yaml:"clusterHealth"`
+	// ClusterPolicies say which clusters are collected, the event sinks they
+	// use and the labels of their alerts. The policy of cluster "*" applies
+	// to the clusters without one.
+	ClusterPolicies []*ClusterPolicy `yaml:"clusterPolicies"`
+
+	// policyLock guards crPolicies, the policies read from the Cluster CRs
+	policyLock sync.RWMutex
+	crPolicies map[string]*ClusterPolicy
+}
+
+// ClusterPolicy is how a cluster is collected. The policy of a cluster is
+// its policy in the config overridden by the one of its Cluster CR, see
+// SetClusterPolicy.
+type ClusterPolicy struct {
+	Cluster string `yaml:"cluster"`
+	// Collect, when false, collects no events of the cluster.
+	Collect *bool `yaml:"collect"`
+	// Sinks names the event sinks of the cluster, by their cluster field,
+	// when it uses the filters and sinks of another.
+	Sinks string `yaml:"sinks"`
+	// Labels are added to every alert of the cluster, e.g. region and env.
+	Labels map[string]string `yaml:"labels"`
+	// Env, when set, applies the policy only where the env environment
+	// variable is Env, e.g. dev.
+	Env string `yaml:"env"`
+}
+
+// Collected tells whether the events of the cluster are collected.
+func (p *ClusterPolicy) Collected() bool {
+	return p.Collect == nil || *p.Collect
+}
+
+// ClusterHealthOpt alerts ClusterEventSourceDown when a cluster has produced
+// no event for SilentFor, or has failed to list or watch its events for
+// FailingFor. The Watchdog alert of the process is put every Interval. Zero
+// values fall back to DefaultClusterHealthOpt.
+type ClusterHealthOpt struct {
+	SilentFor  time.Duration `yaml:"silentFor"`
+	FailingFor time.Duration `yaml:"failingFor"`
+	Interval   time.Duration `yaml:"interval"`
+}
+
+var DefaultClusterHealthOpt = ClusterHealthOpt{
+	SilentFor:  30 * time.Minute,
+	FailingFor: 5 * time.Minute,
+	Interval:   time.Minute,
+}
+
+// ReasonDictionaryOpt configures the reason dictionary, which gives the
+// cn_reason and reason_class labels and the reason_doc annotation of events.
+type ReasonDictionaryOpt struct {
+	// Source is db or configmap.
+	Source string `yaml:"source"`
+	// ConfigMap is the namespace/name of the ConfigMap read by the configmap
+	// source. Its reasons.yaml key lists name, label, class_id and doc.
+	ConfigMap       string        `yaml:"configMap"`
+	RefreshInterval time.Duration `yaml:"refreshInterval"`
+	// Classes names the class ids of the reasons. Unnamed classes are
+	// labelled with their id.
+	Classes map[int]string `yaml:"classes"`
+}
+
+const (
+	ReasonSourceDB        = "db"
+	ReasonSourceConfigMap = "configmap"
+)
+
+var DefaultReasonDictionaryOpt = ReasonDictionaryOpt{
+	Source:          ReasonSourceDB,
+	RefreshInterval: time.Minute,
+}
+
+// OwnerDirectoryOpt lists the sources of workload owners. The owners in
+// eventmesh.io/owner annotations of the workload or its namespace come first
+// when annotations is listed; db and file are asked in the order listed.
+type OwnerDirectoryOpt struct {
+	Sources []string `yaml:"sources"`
+	// File is the YAML file read by the file source.
+	File            string        `yaml:"file"`
+	RefreshInterval time.Duration `yaml:"refreshInterval"`
+}
+
+const (
+	OwnerSourceDB          = "db"
+	OwnerSourceFile        = "file"
+	OwnerSourceAnnotations = "annotations"
+)
+
+var DefaultOwnerDirectoryOpt = OwnerDirectoryOpt{
+	Sources:         []string{OwnerSourceDB},
+	RefreshInterval: 5 * time.Minute,
 }
 
 type Database struct {
@@ -49,10 +161,238 @@ type RedisOpt struct {
 }
 
 type EventSinks struct {
-	Cluster    string   `yaml:"cluster"`
-	Filters    []string `yaml:"filters"`
-	NotFilters []string `yaml:"notFilters"`
-	SlsOpt     *SlsOpt  `yaml:"slsSink"`
+	Cluster string `yaml:"cluster"`
+	// Source is the API the events are read from: auto, core/v1 or
+	// events.k8s.io/v1. auto uses events.k8s.io/v1 when the cluster serves it.
+	Source      string               `yaml:"source"`
+	Filters     []string             `yaml:"filters"`
+	NotFilters  []string             `yaml:"notFilters"`
+	Rules       []*FilterRule        `yaml:"rules"`
+	Severities  []*SeverityRule      `yaml:"severityRules"`
+	Resolves    []*ResolveRule       `yaml:"resolveRules"`
+	Counts      []*CountRule         `yaml:"countRules"`
+	Queue       *EventQueueOpt       `yaml:"queue"`
+	Aggregation *EventAggregationOpt `yaml:"aggregation"`
+	Watch       *EventWatchOpt       `yaml:"watch"`
+	Enrichment  *EventEnrichmentOpt  `yaml:"enrichment"`
+	Diagnostics *EventDiagnosticsOpt `yaml:"diagnostics"`
+	State       *StateWatchOpt       `yaml:"stateWatch"`
+	Anomaly     *EventAnomalyOpt     `yaml:"anomaly"`
+	SlsOpt      *SlsOpt              `yaml:"slsSink"`
+	// SilentFor overrides the SilentFor of ClusterHealth for a cluster with
+	// few events.
+	SilentFor time.Duration `yaml:"silentFor"`
+}
+
+// EventQueueOpt bounds the per-cluster queue between the informer and the
+// event handlers. Zero values fall back to DefaultEventQueueOpt.
+type EventQueueOpt struct {
+	Workers int `yaml:"workers"`
+	// MaxDepth is the queue length above which every new event is dropped.
+	MaxDepth int `yaml:"maxDepth"`
+	// ShedNormalDepth is the queue length above which Normal events are
+	// dropped so that Warning events still get through.
+	ShedNormalDepth int `yaml:"shedNormalDepth"`
+	MaxRetries      int `yaml:"maxRetries"`
+}
+
+// EventAggregationOpt controls how repeated occurrences of an event are
+// collapsed. Notifications are sent when the occurrence count reaches one of
+// NotifyCounts; an aggregate idle for IdleTimeout is forgotten.
+type EventAggregationOpt struct {
+	NotifyCounts []int32       `yaml:"notifyCounts"`
+	IdleTimeout  time.Duration `yaml:"idleTimeout"`
+}
+
+var DefaultEventAggregationOpt = EventAggregationOpt{
+	NotifyCounts: []int32{1, 5, 20},
+	IdleTimeout:  time.Hour,
+}
+
+var DefaultEventQueueOpt = EventQueueOpt{
+	Workers:         4,
+	MaxDepth:        10000,
+	ShedNormalDepth: 5000,
+	MaxRetries:      3,
+}
+
+// EventWatchOpt narrows the events the apiserver sends. Fields left empty are
+// derived from the filter rules where that drops nothing the rules keep.
+type EventWatchOpt struct {
+	// Namespaces are watched one by one instead of the whole cluster.
+	Namespaces []string `yaml:"namespaces"`
+	// Type is sent as a type= field selector, e.g. Warning.
+	Type string `yaml:"type"`
+	// FieldSelector is added to the field selector as is.
+	FieldSelector string `yaml:"fieldSelector"`
+}
+
+// EventEnrichmentOpt lists the labels and annotations copied into alert
+// labels from the objects around an event. Keys become label names with
+// invalid characters replaced by "_", so app.kubernetes.io/name turns into
+// app_kubernetes_io_name. The most specific object wins: the involved object,
+// then its workload, its namespace and its node.
+type EventEnrichmentOpt struct {
+	Object    *EnrichmentSource `yaml:"object"`
+	Workload  *EnrichmentSource `yaml:"workload"`
+	Namespace *EnrichmentSource `yaml:"namespace"`
+	Node      *EnrichmentSource `yaml:"node"`
+	// CacheTTL is how long looked up metadata is reused.
+	CacheTTL time.Duration `yaml:"cacheTTL"`
+}
+
+type EnrichmentSource struct {
+	Labels      []string `yaml:"labels"`
+	Annotations []string `yaml:"annotations"`
+}
+
+const DefaultEnrichmentCacheTTL = 5 * time.Minute
+
+// EventDiagnosticsOpt attaches the state and the log tail of the failing
+// container to the notifications of pod events with one of Reasons. Zero
+// values fall back to DefaultEventDiagnosticsOpt.
+type EventDiagnosticsOpt struct {
+	Reasons []string `yaml:"reasons"`
+	// TailLines is the number of log lines fetched.
+	TailLines int64 `yaml:"tailLines"`
+	// MaxBytes caps the log tail kept in the annotation.
+	MaxBytes int `yaml:"maxBytes"`
+	// Redact lists extra regexes whose matches are masked in the log tail,
+	// on top of the built-in password, token and key patterns.
+	Redact []string `yaml:"redact"`
+}
+
+var DefaultEventDiagnosticsOpt = EventDiagnosticsOpt{
+	Reasons:   []string{"BackOff", "Unhealthy", "Failed"},
+	TailLines: 20,
+	MaxBytes:  2048,
+}
+
+// StateWatchOpt enables the state watchers of a cluster. They alert on what
+// emits no useful event: containers OOMKilled or stuck waiting, node
+// conditions and PVCs left Pending or Lost. Zero values fall back to
+// DefaultStateWatchOpt.
+type StateWatchOpt struct {
+	Pods  bool `yaml:"pods"`
+	Nodes bool `yaml:"nodes"`
+	PVCs  bool `yaml:"pvcs"`
+	// WaitingReasons are the container waiting reasons alerted on.
+	WaitingReasons []string `yaml:"waitingReasons"`
+	// NodeConditions are the node conditions alerted on while True, and
+	// Ready while it is not True.
+	NodeConditions []string `yaml:"nodeConditions"`
+	// OOMKilledFor is how long a container OOMKilled last stays alerted.
+	OOMKilledFor time.Duration `yaml:"oomKilledFor"`
+	// PendingFor is how long a PVC is Pending before it is alerted.
+	PendingFor time.Duration `yaml:"pendingFor"`
+	// Interval is how often the states are evaluated.
+	Interval time.Duration `yaml:"interval"`
+}
+
+var DefaultStateWatchOpt = StateWatchOpt{
+	WaitingReasons: []string{"CrashLoopBackOff", "ImagePullBackOff", "ErrImagePull", "CreateContainerConfigError"},
+	NodeConditions: []string{"Ready", "MemoryPressure", "DiskPressure", "PIDPressure", "NetworkUnavailable"},
+	OOMKilledFor:   15 * time.Minute,
+	PendingFor:     5 * time.Minute,
+	Interval:       time.Minute,
+}
+
+// EventAnomalyOpt alerts EventRateAnomaly when the rate of events of a
+// namespace, or of one reason in it, rises Factor times over its baseline.
+// Baselines are EWMAs of the number of events per Interval. Zero values fall
+// back to DefaultEventAnomalyOpt.
+type EventAnomalyOpt struct {
+	// Types are the event types counted.
+	Types    []string      `yaml:"types"`
+	Interval time.Duration `yaml:"interval"`
+	// Alpha is the weight of the last interval in the baseline.
+	Alpha  float64 `yaml:"alpha"`
+	Factor float64 `yaml:"factor"`
+	// MinEvents is the fewest events in an interval that can be an anomaly.
+	MinEvents int `yaml:"minEvents"`
+	// Warmup is how many intervals a baseline learns before it alerts.
+	Warmup int `yaml:"warmup"`
+}
+
+var DefaultEventAnomalyOpt = EventAnomalyOpt{
+	Types:     []string{"Warning"},
+	Interval:  time.Minute,
+	Alpha:     0.05,
+	Factor:    10,
+	MinEvents: 20,
+	Warmup:    60,
+}
+
+const (
+	SeverityCritical = "critical"
+	SeverityWarning  = "warning"
+	SeverityInfo     = "info"
+)
+
+// SeverityRule sets the severity of the events it matches. It matches like a
+// FilterRule, whose action is ignored, and only once the event was seen
+// MinCount times and for MinDuration, when those are set. The first matching
+// rule wins.
+type SeverityRule struct {
+	FilterRule  `yaml:",inline"`
+	Severity    string        `yaml:"severity"`
+	MinCount    int32         `yaml:"minCount"`
+	MinDuration time.Duration `yaml:"minDuration"`
+}
+
+// ResolveRule ends the alerts of a problem event. The alert of an event with
+// one of Reasons stays firing for Timeout, and is resolved when an event with
+// one of ResolvedBy follows for the same object or, with ResolveOnReady, when
+// the pod or node turns Ready. Kinds limits the rule to some kinds.
+type ResolveRule struct {
+	Name           string        `yaml:"name"`
+	Kinds          []string      `yaml:"kinds"`
+	Reasons        []string      `yaml:"reasons"`
+	ResolvedBy     []string      `yaml:"resolvedBy"`
+	ResolveOnReady bool          `yaml:"resolveOnReady"`
+	Timeout        time.Duration `yaml:"timeout"`
+}
+
+// CountRule alerts when more than Threshold events it matches are seen within
+// Window for one value of the GroupBy labels, once that lasted For. It matches
+// like a FilterRule, whose action is ignored, and sees the events before the
+// filter rules.
+type CountRule struct {
+	FilterRule `yaml:",inline"`
+	// GroupBy are labels of the event alerts, e.g. namespace or
+	// workload_name. Without any the rule counts all its events together.
+	GroupBy   []string      `yaml:"groupBy"`
+	Threshold int           `yaml:"threshold"`
+	Window    time.Duration `yaml:"window"`
+	For       time.Duration `yaml:"for"`
+	Severity  string        `yaml:"severity"`
+}
+
+const (
+	FilterActionInclude = "include"
+	FilterActionExclude = "exclude"
+)
+
+const (
+	EventSourceAuto     = "auto"
+	EventSourceCoreV1   = "core/v1"
+	EventSourceEventsV1 = "events.k8s.io/v1"
+)
+
+// FilterRule matches events on every non-empty field. List fields match when
+// any entry is equal, regex fields use Go regexp syntax. The first matching
+// rule decides whether the event is included or excluded.
+type FilterRule struct {
+	Name           string   `yaml:"name"`
+	Action         string   `yaml:"action"`
+	Types          []string `yaml:"types"`
+	Reasons        []string `yaml:"reasons"`
+	Components     []string `yaml:"components"`
+	Kinds          []string `yaml:"kinds"`
+	Namespaces     []string `yaml:"namespaces"`
+	NameRegex      string   `yaml:"nameRegex"`
+	NamespaceRegex string   `yaml:"namespaceRegex"`
+	MessageRegex   string   `yaml:"messageRegex"`
 }
 
 type SlsOpt struct {
@@ -114,33 +454,348 @@ func (c *ConfigResolver) GetSessionStore(store string, env string) (*SessionStor
 }
 
 func (c *ConfigResolver) GetSlsConfig(cluster string) (*SlsOpt, error) {
+	sink := c.GetEventSinks(cluster)
+	if sink == nil {
+		return nil, errors.New("unknown config")
+	}
+	return sink.SlsOpt, nil
+}
+
+// GetEventSinks returns the sink config of a cluster, or nil if there is none.
+// A cluster whose policy names other sinks uses theirs; the getters of the
+// sink config all go through it.
+func (c *ConfigResolver) GetEventSinks(cluster string) *EventSinks {
+	if sinks := c.GetClusterPolicy(cluster).Sinks; len(sinks) > 0 {
+		cluster = sinks
+	}
 	for _, sink := range c.EventSinks {
-		if sink.Cluster != cluster {
-			continue
+		if sink.Cluster == cluster {
+			return sink
 		}
-		return sink.SlsOpt, nil
 	}
-	return nil, errors.New("unknown config")
+	return nil
 }
 
-func (c *ConfigResolver) GetEventSinksFilters(cluster string) []string {
-	var filters []string
-	for _, sink := range c.EventSinks {
-		if sink.Cluster != cluster {
+// GetClusterPolicy returns the policy of the cluster. Unset fields of the
+// policy of its Cluster CR are taken from its policy in the config, or from
+// the policy of cluster "*"; the labels of both are merged.
+func (c *ConfigResolver) GetClusterPolicy(cluster string) *ClusterPolicy {
+	policy := &ClusterPolicy{Cluster: cluster, Labels: make(map[string]string)}
+	var configured *ClusterPolicy
+	env := os.Getenv("env")
+	for _, p := range c.ClusterPolicies {
+		if len(p.Env) > 0 && p.Env != env {
+			continue
+		}
+		if p.Cluster == cluster {
+			configured = p
+			break
+		}
+		if p.Cluster == "*" && configured == nil {
+			configured = p
+		}
+	}
+	c.policyLock.RLock()
+	cr := c.crPolicies[cluster]
+	c.policyLock.RUnlock()
+	for _, p := range []*ClusterPolicy{configured, cr} {
+		if p == nil {
 			continue
 		}
+		if p.Collect != nil {
+			policy.Collect = p.Collect
+		}
+		if len(p.Sinks) > 0 {
+			policy.Sinks = p.Sinks
+		}
+		for name, value := range p.Labels {
+			policy.Labels[name] = value
+		}
+	}
+	return policy
+}
+
+// SetClusterPolicy sets the policy read from the Cluster CR of the cluster,
+// nil removes it.
+func (c *ConfigResolver) SetClusterPolicy(cluster string, policy *ClusterPolicy) {
+	c.policyLock.Lock()
+	defer c.policyLock.Unlock()
+	if policy == nil {
+		delete(c.crPolicies, cluster)
+		return
+	}
+	if c.crPolicies == nil {
+		c.crPolicies = make(map[string]*ClusterPolicy)
+	}
+	c.crPolicies[cluster] = policy
+}
+
+func (c *ConfigResolver) GetEventWatchOpt(cluster string) *EventWatchOpt {
+	sink := c.GetEventSinks(cluster)
+	if sink == nil || sink.Watch == nil {
+		return &EventWatchOpt{}
+	}
+	opt := *sink.Watch
+	return &opt
+}
+
+func (c *ConfigResolver) GetEventSource(cluster string) string {
+	sink := c.GetEventSinks(cluster)
+	if sink == nil || len(sink.Source) == 0 {
+		return EventSourceAuto
+	}
+	return sink.Source
+}
+
+func (c *ConfigResolver) GetEventQueueOpt(cluster string) *EventQueueOpt {
+	opt := DefaultEventQueueOpt
+	sink := c.GetEventSinks(cluster)
+	if sink == nil || sink.Queue == nil {
+		return &opt
+	}
+	if sink.Queue.Workers > 0 {
+		opt.Workers = sink.Queue.Workers
+	}
+	if sink.Queue.MaxDepth > 0 {
+		opt.MaxDepth = sink.Queue.MaxDepth
+	}
+	if sink.Queue.ShedNormalDepth > 0 {
+		opt.ShedNormalDepth = sink.Queue.ShedNormalDepth
+	}
+	if opt.ShedNormalDepth > opt.MaxDepth {
+		opt.ShedNormalDepth = opt.MaxDepth
+	}
+	if sink.Queue.MaxRetries > 0 {
+		opt.MaxRetries = sink.Queue.MaxRetries
+	}
+	return &opt
+}
+
+// GetEventEnrichmentOpt returns nil when the cluster has no enrichment.
+func (c *ConfigResolver) GetEventEnrichmentOpt(cluster string) *EventEnrichmentOpt {
+	sink := c.GetEventSinks(cluster)
+	if sink == nil || sink.Enrichment == nil {
+		return nil
+	}
+	opt := *sink.Enrichment
+	if opt.CacheTTL <= 0 {
+		opt.CacheTTL = DefaultEnrichmentCacheTTL
+	}
+	return &opt
+}
+
+// GetStateWatchOpt returns nil when the cluster has no state watchers.
+func (c *ConfigResolver) GetStateWatchOpt(cluster string) *StateWatchOpt {
+	sink := c.GetEventSinks(cluster)
+	if sink == nil || sink.State == nil {
+		return nil
+	}
+	opt := *sink.State
+	if !opt.Pods && !opt.Nodes && !opt.PVCs {
+		return nil
+	}
+	if len(opt.WaitingReasons) == 0 {
+		opt.WaitingReasons = DefaultStateWatchOpt.WaitingReasons
+	}
+	if len(opt.NodeConditions) == 0 {
+		opt.NodeConditions = DefaultStateWatchOpt.NodeConditions
+	}
+	if opt.OOMKilledFor <= 0 {
+		opt.OOMKilledFor = DefaultStateWatchOpt.OOMKilledFor
+	}
+	if opt.PendingFor <= 0 {
+		opt.PendingFor = DefaultStateWatchOpt.PendingFor
+	}
+	if opt.Interval <= 0 {
+		opt.Interval = DefaultStateWatchOpt.Interval
+	}
+	return &opt
+}
+
+// GetEventAnomalyOpt returns nil when the cluster has no anomaly detection.
+func (c *ConfigResolver) GetEventAnomalyOpt(cluster string) *EventAnomalyOpt {
+	sink := c.GetEventSinks(cluster)
+	if sink == nil || sink.Anomaly == nil {
+		return nil
+	}
+	opt := *sink.Anomaly
+	if len(opt.Types) == 0 {
+		opt.Types = DefaultEventAnomalyOpt.Types
+	}
+	if opt.Interval <= 0 {
+		opt.Interval = DefaultEventAnomalyOpt.Interval
+	}
+	if opt.Alpha <= 0 || opt.Alpha > 1 {
+		opt.Alpha = DefaultEventAnomalyOpt.Alpha
+	}
+	if opt.Factor <= 1 {
+		opt.Factor = DefaultEventAnomalyOpt.Factor
+	}
+	if opt.MinEvents <= 0 {
+		opt.MinEvents = DefaultEventAnomalyOpt.MinEvents
+	}
+	if opt.Warmup <= 0 {
+		opt.Warmup = DefaultEventAnomalyOpt.Warmup
+	}
+	return &opt
+}
+
+// GetEventDiagnosticsOpt returns nil when the cluster has no diagnostics.
+func (c *ConfigResolver) GetEventDiagnosticsOpt(cluster string) *EventDiagnosticsOpt {
+	sink := c.GetEventSinks(cluster)
+	if sink == nil || sink.Diagnostics == nil {
+		return nil
+	}
+	opt := *sink.Diagnostics
+	if len(opt.Reasons) == 0 {
+		opt.Reasons = DefaultEventDiagnosticsOpt.Reasons
+	}
+	if opt.TailLines <= 0 {
+		opt.TailLines = DefaultEventDiagnosticsOpt.TailLines
+	}
+	if opt.MaxBytes <= 0 {
+		opt.MaxBytes = DefaultEventDiagnosticsOpt.MaxBytes
+	}
+	return &opt
+}
+
+func (c *ConfigResolver) GetOwnerDirectoryOpt() *OwnerDirectoryOpt {
+	opt := DefaultOwnerDirectoryOpt
+	if c.OwnerDirectory == nil {
+		return &opt
+	}
+	if len(c.OwnerDirectory.Sources) > 0 {
+		opt.Sources = c.OwnerDirectory.Sources
+	}
+	opt.File = c.OwnerDirectory.File
+	if c.OwnerDirectory.RefreshInterval > 0 {
+		opt.RefreshInterval = c.OwnerDirectory.RefreshInterval
+	}
+	return &opt
+}
+
+func (c *ConfigResolver) GetClusterHealthOpt() *ClusterHealthOpt {
+	opt := DefaultClusterHealthOpt
+	if c.ClusterHealth == nil {
+		return &opt
+	}
+	if c.ClusterHealth.SilentFor > 0 {
+		opt.SilentFor = c.ClusterHealth.SilentFor
+	}
+	if c.ClusterHealth.FailingFor > 0 {
+		opt.FailingFor = c.ClusterHealth.FailingFor
+	}
+	if c.ClusterHealth.Interval > 0 {
+		opt.Interval = c.ClusterHealth.Interval
+	}
+	return &opt
+}
+
+// GetClusterSilentFor returns how long the cluster can produce no event
+// before its event source is down.
+func (c *ConfigResolver) GetClusterSilentFor(cluster string) time.Duration {
+	if sink := c.GetEventSinks(cluster); sink != nil && sink.SilentFor > 0 {
+		return sink.SilentFor
+	}
+	return c.GetClusterHealthOpt().SilentFor
+}
+
+func (c *ConfigResolver) GetReasonDictionaryOpt() *ReasonDictionaryOpt {
+	opt := DefaultReasonDictionaryOpt
+	if c.ReasonDictionary == nil {
+		return &opt
+	}
+	if len(c.ReasonDictionary.Source) > 0 {
+		opt.Source = c.ReasonDictionary.Source
+	}
+	opt.ConfigMap = c.ReasonDictionary.ConfigMap
+	if c.ReasonDictionary.RefreshInterval > 0 {
+		opt.RefreshInterval = c.ReasonDictionary.RefreshInterval
+	}
+	opt.Classes = c.ReasonDictionary.Classes
+	return &opt
+}
+
+func (c *ConfigResolver) GetEventAggregationOpt(cluster string) *EventAggregationOpt {
+	opt := DefaultEventAggregationOpt
+	sink := c.GetEventSinks(cluster)
+	if sink == nil || sink.Aggregation == nil {
+		return &opt
+	}
+	if len(sink.Aggregation.NotifyCounts) > 0 {
+		opt.NotifyCounts = sink.Aggregation.NotifyCounts
+	}
+	if sink.Aggregation.IdleTimeout > 0 {
+		opt.IdleTimeout = sink.Aggregation.IdleTimeout
+	}
+	return &opt
+}
+
+func (c *ConfigResolver) GetEventSinksFilters(cluster string) []string {
+	if sink := c.GetEventSinks(cluster); sink != nil {
 		return sink.Filters
 	}
-	return filters
+	return nil
+}
+
+// GetEventSeverityRules returns the severity rules of a cluster followed by
+// the global ones.
+func (c *ConfigResolver) GetEventSeverityRules(cluster string) []*SeverityRule {
+	var rules []*SeverityRule
+	if sink := c.GetEventSinks(cluster); sink != nil {
+		rules = append(rules, sink.Severities...)
+	}
+	return append(rules, c.EventSeverityRules...)
+}
+
+// GetEventResolveRules returns the resolve rules of a cluster followed by the
+// global ones.
+func (c *ConfigResolver) GetEventResolveRules(cluster string) []*ResolveRule {
+	var rules []*ResolveRule
+	if sink := c.GetEventSinks(cluster); sink != nil {
+		rules = append(rules, sink.Resolves...)
+	}
+	return append(rules, c.EventResolveRules...)
+}
+
+// GetEventCountRules returns the count rules of a cluster followed by the
+// global ones.
+func (c *ConfigResolver) GetEventCountRules(cluster string) []*CountRule {
+	var rules []*CountRule
+	if sink := c.GetEventSinks(cluster); sink != nil {
+		rules = append(rules, sink.Counts...)
+	}
+	return append(rules, c.EventCountRules...)
+}
+
+// GetEventFilterRules returns the ordered filter rules configured for a
+// cluster: its own rules followed by its legacy notFilters and filters.
+// Global rules are not included.
+func (c *ConfigResolver) GetEventFilterRules(cluster string) []*FilterRule {
+	sink := c.GetEventSinks(cluster)
+	if sink == nil {
+		return nil
+	}
+	var rules []*FilterRule
+	rules = append(rules, sink.Rules...)
+	if len(sink.NotFilters) > 0 {
+		rules = append(rules,
+			&FilterRule{Name: "notFilters-reasons", Action: FilterActionInclude, Reasons: sink.NotFilters},
+			&FilterRule{Name: "notFilters-components", Action: FilterActionInclude, Components: sink.NotFilters},
+		)
+	}
+	if len(sink.Filters) > 0 {
+		rules = append(rules,
+			&FilterRule{Name: "filters-reasons", Action: FilterActionExclude, Reasons: sink.Filters},
+			&FilterRule{Name: "filters-components", Action: FilterActionExclude, Components: sink.Filters},
+		)
+	}
+	return rules
 }
 
 func (c *ConfigResolver) GetEventSinksNotFilters(cluster string) []string {
-	var filters []string
-	for _, sink := range c.EventSinks {
-		if sink.Cluster != cluster {
-			continue
-		}
+	if sink := c.GetEventSinks(cluster); sink != nil {
 		return sink.NotFilters
 	}
-	return filters
+	return nil
 }
@@ -10,7 +10,13 @@ func main() {
 	logging.InitLogger()
 	options := module.ParseOptions()
 	config := module.ParseConfigYaml()
-	memProvider, marker := module.SetALertMemProvider()
-	module.SetupK8s(options, config, memProvider)
-	os.Exit(module.RunAlertDispatch(options, memProvider, marker))
+	mux := module.SetupWeb(options)
+	alerts, marker, peers := module.SetAlertProvider(options, config)
+	k8sWatcher := module.SetupK8s(options, config, alerts)
+	module.SetupAPI(mux, k8sWatcher)
+	code := module.RunAlertDispatch(options, alerts, marker, peers)
+	// hand the clusters over before exiting
+	k8sWatcher.Stop()
+	peers.Stop()
+	os.Exit(code)
 }
@@ -2,6 +2,7 @@ package module
 
 import (
 	"context"
+	cmdconfig "github.com/crain-cn/event-mesh/cmd/config"
 	"github.com/crain-cn/event-mesh/pkg/config"
 	"github.com/crain-cn/event-mesh/pkg/dispatch"
 	"github.com/crain-cn/event-mesh/pkg/logging"
@@ -10,8 +11,10 @@ import (
 	"github.com/crain-cn/event-mesh/pkg/notify/webhook"
 	"github.com/crain-cn/event-mesh/pkg/notify/wechat"
 	"github.com/crain-cn/event-mesh/pkg/notify/yach"
+	"github.com/crain-cn/event-mesh/pkg/peer"
 	"github.com/crain-cn/event-mesh/pkg/provider"
 	"github.com/crain-cn/event-mesh/pkg/provider/mem"
+	"github.com/crain-cn/event-mesh/pkg/provider/redis"
 	"github.com/crain-cn/event-mesh/pkg/template"
 	"github.com/fsnotify/fsnotify"
 	"github.com/pkg/errors"
@@ -38,11 +41,90 @@ func SetALertMemProvider() (provider.Alerts, types.Marker) {
 	return alerts, marker
 }
 
-func RunAlertDispatch(o options, alerts provider.Alerts, marker types.Marker) int {
+// AlertPeers are the replicas sharing the alerts and the notification log
+// through a session store; nil when the alerts are in memory.
+type AlertPeers struct {
+	peer            *peer.Peer
+	notificationLog *peer.NotificationLog
+	cancel          context.CancelFunc
+	done            chan struct{}
+}
+
+// Stop leaves the peers, for the next one to notify at once.
+func (p *AlertPeers) Stop() {
+	if p == nil {
+		return
+	}
+	p.cancel()
+	<-p.done
+}
+
+// SetAlertProvider keeps the alerts in the session store of -alerts.store,
+// shared by the replicas, or in memory when there is none.
+func SetAlertProvider(o options, configResolver *cmdconfig.ConfigResolver) (provider.Alerts, types.Marker, *AlertPeers) {
+	if len(o.alertStore) == 0 {
+		alerts, marker := SetALertMemProvider()
+		return alerts, marker, nil
+	}
+	store, err := configResolver.GetSessionStore(o.alertStore, o.env)
+	if err != nil {
+		log.Fatal(err, ": ", o.alertStore)
+	}
+	if store.Redis == nil {
+		log.Fatal("no redis in session store ", o.alertStore)
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		log.Fatal(err)
+	}
+	client := redis.NewClient(store.Redis)
+	marker := types.NewMarker(prometheus.NewRegistry())
+	ctx, cancel := context.WithCancel(context.Background())
+	alerts, err := redis.NewAlerts(ctx, client, o.alertPrefix, marker, 30*time.Minute)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// kept as long as the retention of the dispatch
+	notificationLog, err := peer.NewNotificationLog(ctx, client, o.alertPrefix, 120*time.Hour)
+	if err != nil {
+		log.Fatal(err)
+	}
+	peers := &AlertPeers{
+		peer:            peer.NewPeer(client, o.alertPrefix, hostname, o.peerTimeout),
+		notificationLog: notificationLog,
+		cancel:          cancel,
+		done:            make(chan struct{}),
+	}
+	// a replica not knowing its position would notify along with the first
+	refreshCtx, refreshCancel := context.WithTimeout(ctx, o.peerTimeout)
+	err = peers.peer.Refresh(refreshCtx)
+	refreshCancel()
+	if err != nil {
+		log.Fatal(err, ": read the alert peers")
+	}
+	go func() {
+		defer close(peers.done)
+		peers.peer.Run(ctx)
+	}()
+	return alerts, marker, peers
+}
+
+func RunAlertDispatch(o options, alerts provider.Alerts, marker types.Marker, peers *AlertPeers) int {
 
 	var retention time.Duration
 	retention, _ = time.ParseDuration("120h")
 
+	// the replicas sharing the alerts wait for their position, and notify
+	// what the notification log of the others does not tell was notified
+	var (
+		waitFunc        func() time.Duration
+		notificationLog notify.NotificationLog
+	)
+	if peers != nil {
+		waitFunc = peers.peer.Wait
+		notificationLog = peers.notificationLog
+	}
+
 	configCoordinator := config.NewCoordinator(
 		o.configFile,
 		prometheus.DefaultRegisterer,
@@ -101,10 +183,10 @@ func RunAlertDispatch(o options, alerts provider.Alerts, marker types.Marker) in
 		disp.Stop()
 		pipeline := pipelineBuilder.New(
 			receivers,
-			//	waitFunc,
+			waitFunc,
 			//	inhibitor,
 			//	silencer,
-			//	notificationLog,
+			notificationLog,
 			//	peer,
 		)
 		config.StaticRoute = conf.Route
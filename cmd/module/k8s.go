@@ -2,22 +2,39 @@ package module
 
 import (
 	"github.com/crain-cn/event-mesh/cmd/config"
+	"github.com/crain-cn/event-mesh/pkg/k8s/clustermesh"
 	"github.com/crain-cn/event-mesh/pkg/k8s/watcher"
 	"github.com/crain-cn/event-mesh/pkg/provider"
-	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 )
 
-func SetupK8s(o options, configResolver *config.ConfigResolver, alerts provider.Alerts) *rest.Config {
+func SetupK8s(o options, configResolver *config.ConfigResolver, alerts provider.Alerts) *watcher.K8sWatcher {
 	// creates the connection
 	log.Info("SetupK8sClient...")
 	clientConfig, err := clientcmd.BuildConfigFromFlags(o.master, o.kubeConfig)
 	if err != nil {
 		log.Fatal(err)
 	}
-	k8sWatcher := watcher.NewK8sWatcher(configResolver, clientConfig)
+	clusterSource, err := clustermesh.NewClusterSource(o.clusterSource, o.clusterPath, clientConfig)
+	if err != nil {
+		log.Fatal(err)
+	}
+	k8sWatcher := watcher.NewK8sWatcher(configResolver, clientConfig, clusterSource, o.dataDir)
+	if o.leaderElect && o.shard {
+		log.Fatal("-leader-elect and -shard can not be combined")
+	}
+	if o.shard {
+		if err := k8sWatcher.EnableSharding(o.shardOpt); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if o.leaderElect {
+		if err := k8sWatcher.EnableLeaderElection(o.leader); err != nil {
+			log.Fatal(err)
+		}
+	}
 	//k8sClient, err := kubernetes.NewForConfig(clientConfig)
 	go k8sWatcher.EnableK8sWatcher(alerts)
 
-	return clientConfig
+	return k8sWatcher
 }
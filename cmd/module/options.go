@@ -3,9 +3,13 @@ package module
 import (
 	"flag"
 	"fmt"
+	"github.com/crain-cn/event-mesh/cmd/config"
+	"github.com/crain-cn/event-mesh/pkg/k8s/clustermesh"
+	"github.com/crain-cn/event-mesh/pkg/k8s/leader"
 	"github.com/crain-cn/event-mesh/pkg/logging"
 	"github.com/sirupsen/logrus"
 	"os"
+	"time"
 )
 
 var (
@@ -13,10 +17,21 @@ var (
 )
 
 type options struct {
-	master     string
-	kubeConfig string
-	configFile string
-	dataDir    string
+	master        string
+	kubeConfig    string
+	configFile    string
+	dataDir       string
+	listenAddress string
+	clusterSource string
+	clusterPath   string
+	leaderElect   bool
+	leader        leader.Options
+	shard         bool
+	shardOpt      clustermesh.ShardOptions
+	env           string
+	alertStore    string
+	alertPrefix   string
+	peerTimeout   time.Duration
 }
 
 func ParseOptions() options {
@@ -32,6 +47,27 @@ func (o *options) parse(fs *flag.FlagSet, args []string) error {
 	flag.StringVar(&o.kubeConfig, "kubeconfig", "", "Path to kubeconfig. Only required if out of cluster")
 	flag.StringVar(&o.configFile, "config", "config/route.yml", "")
 	flag.StringVar(&o.dataDir, "data", "data/", "")
+	flag.StringVar(&o.listenAddress, "web.listen-address", ":9096", "Address to serve /metrics on, apart from the 9093 and 9094 of an alertmanager alongside")
+	flag.StringVar(&o.clusterSource, "cluster-source", "clustermesh", "Where the clusters are found: clustermesh, dir, file or local")
+	flag.StringVar(&o.clusterPath, "cluster-path", "", "Directory of kubeconfigs of the dir source, cluster map of the file source, or cluster name of the local source")
+	flag.BoolVar(&o.leaderElect, "leader-elect", false, "Elect the replica watching the clusters through a Lease")
+	flag.StringVar(&o.leader.Mode, "leader-elect.mode", leader.DefaultOptions.Mode, "active-passive, or active-active to keep the replicas not leading in sync and serving the read APIs")
+	flag.StringVar(&o.leader.Namespace, "leader-elect.namespace", "", "Namespace of the Lease and of the checkpoints handed over, the one of the pod by default")
+	flag.StringVar(&o.leader.Name, "leader-elect.name", leader.DefaultOptions.Name, "Name of the Lease")
+	flag.DurationVar(&o.leader.LeaseDuration, "leader-elect.lease-duration", leader.DefaultOptions.LeaseDuration, "How long the replicas wait for a leader that died")
+	flag.DurationVar(&o.leader.RenewDeadline, "leader-elect.renew-deadline", leader.DefaultOptions.RenewDeadline, "How long the leader retries to renew the Lease before it stops leading")
+	flag.DurationVar(&o.leader.RetryPeriod, "leader-elect.retry-period", leader.DefaultOptions.RetryPeriod, "How often the Lease is renewed or tried")
+	flag.BoolVar(&o.shard, "shard", false, "Shard the clusters across the replicas by consistent hashing, instead of electing a leader")
+	flag.StringVar(&o.shardOpt.Membership, "shard.membership", clustermesh.DefaultShardOptions.Membership, "lease, a Lease per replica, or service, the ready endpoints of a headless Service")
+	flag.StringVar(&o.shardOpt.Namespace, "shard.namespace", "", "Namespace of the membership and of the checkpoints handed over, the one of the pod by default")
+	flag.StringVar(&o.shardOpt.Name, "shard.name", clustermesh.DefaultShardOptions.Name, "Prefix of the Leases, or name of the headless Service")
+	flag.DurationVar(&o.shardOpt.LeaseDuration, "shard.lease-duration", clustermesh.DefaultShardOptions.LeaseDuration, "How long a replica that died keeps its shard")
+	flag.DurationVar(&o.shardOpt.Interval, "shard.interval", clustermesh.DefaultShardOptions.Interval, "How often the membership is read")
+	flag.DurationVar(&o.shardOpt.Handoff, "shard.handoff", clustermesh.DefaultShardOptions.Handoff, "How long a replica waits to start the clusters it gained, longer than -shard.interval")
+	flag.StringVar(&o.env, "env", config.DefaultEnv, "Environment of the databases and session stores of the config")
+	flag.StringVar(&o.alertStore, "alerts.store", "", "Session store of the config keeping the alerts and the notification log shared by the replicas, such as redis; in memory when empty")
+	flag.StringVar(&o.alertPrefix, "alerts.prefix", "eventmesh", "Prefix of the keys in the session store")
+	flag.DurationVar(&o.peerTimeout, "alerts.peer-timeout", 15*time.Second, "How long a replica waits per replica before it to notify, and how long a replica that stopped beating is a peer")
 	if err := fs.Parse(args); err != nil {
 		return fmt.Errorf("Parse flags: %v", err)
 	}
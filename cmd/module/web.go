@@ -0,0 +1,47 @@
+package module
+
+import (
+	"encoding/json"
+	"github.com/crain-cn/event-mesh/pkg/k8s/watcher"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+)
+
+// SetupWeb serves the prometheus metrics in the background.
+func SetupWeb(o options) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	go func() {
+		log.Info("listening on ", o.listenAddress)
+		if err := http.ListenAndServe(o.listenAddress, mux); err != nil {
+			log.WithError(err).Error("web server stopped")
+		}
+	}()
+	return mux
+}
+
+// SetupAPI serves the read APIs of the watcher. A replica that does not lead
+// in the active-passive mode answers 503 but for the leadership.
+func SetupAPI(mux *http.ServeMux, k8sWatcher *watcher.K8sWatcher) {
+	mux.HandleFunc("/api/v1/leader", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, k8sWatcher.LeaderStatus())
+	})
+	mux.HandleFunc("/api/v1/clusters", func(w http.ResponseWriter, r *http.Request) {
+		if !k8sWatcher.Serving() {
+			writeJSON(w, http.StatusServiceUnavailable, k8sWatcher.LeaderStatus())
+			return
+		}
+		writeJSON(w, http.StatusOK, k8sWatcher.ClusterStatus())
+	})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.WithError(err).Error("write response")
+	}
+}
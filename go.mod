@@ -5,6 +5,7 @@ go 1.15
 require (
 	github.com/Shopify/sarama v1.27.2 // indirect
 	github.com/alecthomas/template v0.0.0-20190718012654-fb15b899a751 // indirect
+	github.com/alicebob/miniredis/v2 v2.30.0
 	github.com/armon/go-metrics v0.0.0-20190430140413-ec5e00d3c878 // indirect
 	github.com/cenkalti/backoff/v4 v4.0.2
 	github.com/cespare/xxhash v1.1.0
@@ -19,6 +20,7 @@ require (
 	github.com/gin-gonic/gin v1.6.3 // indirect
 	github.com/go-kit/kit v0.10.0
 	github.com/go-openapi/spec v0.20.3 // indirect
+	github.com/go-redis/redis/v8 v8.4.2
 	github.com/gorilla/websocket v1.4.2 // indirect
 	github.com/hashicorp/go-immutable-radix v1.1.0 // indirect
 	github.com/hashicorp/go-msgpack v0.5.5 // indirect
@@ -26,7 +28,6 @@ require (
 	github.com/kylelemons/godebug v1.1.0
 	github.com/lestrrat/go-file-rotatelogs v0.0.0-20180223000712-d3151e2a480f
 	github.com/lestrrat/go-strftime v0.0.0-20180220042222-ba3bf9c1d042 // indirect
-	github.com/linvon/cuckoo-filter v0.3.0
 	github.com/mailru/easyjson v0.7.7 // indirect
 	github.com/mitchellh/mapstructure v1.3.2 // indirect
 	github.com/mwitkow/go-conntrack v0.0.0-20190716064945-2f068394615f // indirect
@@ -1,58 +1,55 @@
 package clustermesh
 
 import (
-	"context"
-	"errors"
-	"github.com/crain-cn/event-mesh/pkg/k8s/kubeutil"
-	"github.com/crain-cn/cluster-mesh/client/clientset/versioned"
-	"github.com/crain-cn/cluster-mesh/client/informers/externalversions"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"sync"
 )
 
 type ClusterClient struct {
-	Client          *versioned.Clientset
-	kcClients       map[string]*kubernetes.Clientset
-	SharedInformers externalversions.SharedInformerFactory
-	Lock            sync.Mutex
+	kcClients map[string]*kubernetes.Clientset
+	Lock      sync.Mutex
 }
 
-func (c *ClusterClient) GetClient(clusterName string) (*kubernetes.Clientset, error) {
-	if _, ok := c.kcClients[clusterName]; !ok {
-		kubeClient, err := c.CreateClient(clusterName)
-		if kubeClient == nil || err != nil {
-			log.Info("Failed to client cluster:", clusterName)
-			return nil, errors.New("invalid kubeconfig")
-		} else {
-			c.Lock.Lock()
-			c.kcClients[clusterName] = kubeClient
-			c.Lock.Unlock()
-			return kubeClient, nil
-		}
-	}
-	return c.kcClients[clusterName], nil
+// GetClient returns the client kept for the cluster.
+func (c *ClusterClient) GetClient(clusterName string) (*kubernetes.Clientset, bool) {
+	c.Lock.Lock()
+	defer c.Lock.Unlock()
+	kubeClient, ok := c.kcClients[clusterName]
+	return kubeClient, ok
 }
 
-func (c *ClusterClient) CreateClient(clusterName string) (*kubernetes.Clientset, error) {
-	cluster, err := c.Client.CloudV1beta1().
-		Clusters().
-		Get(context.TODO(), clusterName, metav1.GetOptions{})
+// NewClient creates the client of the cluster, and replaces the one kept for
+// it.
+func (c *ClusterClient) NewClient(cluster *Cluster) (*kubernetes.Clientset, error) {
+	kubeClient, err := c.CreateClient(cluster)
 	if err != nil {
+		log.Info("Failed to client cluster:", cluster.Name)
 		return nil, err
 	}
+	c.Lock.Lock()
+	c.kcClients[cluster.Name] = kubeClient
+	c.Lock.Unlock()
+	return kubeClient, nil
+}
 
+func (c *ClusterClient) CreateClient(cluster *Cluster) (*kubernetes.Clientset, error) {
+	config, err := cluster.restConfig()
 	if err != nil {
-		log.Error(err, "Failed to loadConfig  Cluster:%v", clusterName)
+		log.Error(err, "Failed to loadConfig  Cluster:%v", cluster.Name)
 		return nil, err
 	}
-	config, err := kubeutil.LoadConfig(cluster.Spec.KubeConfig)
 	return kubernetes.NewForConfig(config)
 }
 
-func NewClusterClinet(client *versioned.Clientset) *ClusterClient {
+// Forget drops the client of the cluster.
+func (c *ClusterClient) Forget(clusterName string) {
+	c.Lock.Lock()
+	delete(c.kcClients, clusterName)
+	c.Lock.Unlock()
+}
+
+func NewClusterClinet() *ClusterClient {
 	return &ClusterClient{
-		Client:    client,
 		kcClients: make(map[string]*kubernetes.Clientset),
 	}
 }
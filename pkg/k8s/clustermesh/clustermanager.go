@@ -3,36 +3,104 @@ package clustermesh
 import (
 	"github.com/crain-cn/event-mesh/cmd/config"
 	"github.com/crain-cn/event-mesh/pkg/k8s/events"
+	"github.com/crain-cn/event-mesh/pkg/owner"
 	"github.com/crain-cn/event-mesh/pkg/provider"
+	"github.com/crain-cn/event-mesh/pkg/reason"
 	"github.com/crain-cn/cluster-mesh/api/cloud.mesh/v1beta1"
-	"github.com/crain-cn/cluster-mesh/client/clientset/versioned"
-	"github.com/crain-cn/cluster-mesh/client/informers/externalversions"
 	"github.com/sirupsen/logrus"
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
-	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/tools/record"
-	"os"
 	"reflect"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
 
 type ClusterManager struct {
-	client         *versioned.Clientset
 	configResolver *config.ConfigResolver
-	clusterClient  *ClusterClient
-	eventWatchers  map[string]*events.EventWatcher
-	eventRecorder  record.EventRecorder
-	Lock           sync.Mutex
-	Alerts         provider.Alerts
-	Store          cache.Store
-	Reasons 	   map[string]string
-	Workcodes	   map[string]string
-	CacheSynced    chan struct{}
-	stopCh         chan struct{}
+	// Source finds the clusters.
+	Source        ClusterSource
+	clusterClient *ClusterClient
+	// clusters are the clusters by name, Lock guards them
+	clusters      map[string]*managedCluster
+	eventRecorder record.EventRecorder
+	Lock          sync.Mutex
+	Alerts        provider.Alerts
+	Store         cache.Store
+	// Reasons is the reason dictionary shared by the event watchers.
+	Reasons *reason.Dictionary
+	// Owners is the directory of who to mention for a workload.
+	Owners *owner.Directory
+	// DataDir keeps the anomaly baselines of the clusters.
+	DataDir string
+	// Checkpoints keeps the event watch checkpoints of the clusters.
+	Checkpoints events.CheckpointStore
+	// Health tracks the event sources of the clusters.
+	Health      *events.HealthMonitor
+	CacheSynced chan struct{}
+	stopCh      chan struct{}
+	// standby is set while another replica leads; the clusters are kept
+	// without watchers. leadStopCh stops what runs while leading.
+	standby    bool
+	leadStopCh chan struct{}
+	// ring shards the clusters across the replicas, identity is this one;
+	// the clusters gained wait for handoffUntil to start. A nil ring owns
+	// every cluster.
+	ring         *Ring
+	identity     string
+	handoffUntil time.Time
+}
+
+const (
+	// retryMin and retryMax bound the backoff of a cluster whose client
+	// could not be created.
+	retryMin = 5 * time.Second
+	retryMax = 5 * time.Minute
+
+	ClusterPhaseRunning  = "Running"
+	ClusterPhaseFailed   = "Failed"
+	ClusterPhaseExcluded = "Excluded"
+	ClusterPhaseStandby  = "Standby"
+	// ClusterPhasePending clusters wait for their previous owner to stop
+	// them and save their checkpoints.
+	ClusterPhasePending = "Pending"
+
+	// AnnotationCollect, "true" or "false", sets whether the events of a
+	// Cluster CR are collected.
+	AnnotationCollect = "eventmesh.io/collect"
+	// AnnotationSinks names the event sinks of the config a Cluster CR uses.
+	AnnotationSinks = "eventmesh.io/sinks"
+	// AlertLabelPrefix marks the labels of a Cluster CR added, without the
+	// prefix, to every alert of the cluster, e.g. alert.eventmesh.io/region.
+	AlertLabelPrefix = "alert.eventmesh.io/"
+)
+
+// ClusterStatus is the state of a cluster in the manager, and of its event
+// source.
+type ClusterStatus struct {
+	Name  string `json:"name"`
+	Phase string `json:"phase"`
+	// Owner is the replica watching the cluster when they are sharded.
+	Owner string `json:"owner,omitempty"`
+	// Attempts counts the starts since the cluster was added or changed.
+	Attempts  int                         `json:"attempts"`
+	LastError string                      `json:"last_error,omitempty"`
+	NextRetry time.Time                   `json:"next_retry,omitempty"`
+	StartedAt time.Time                   `json:"started_at,omitempty"`
+	Health    *events.ClusterHealthStatus `json:"health,omitempty"`
+}
+
+// managedCluster is a cluster of the manager with its watchers.
+type managedCluster struct {
+	cluster      *Cluster
+	policy       *config.ClusterPolicy
+	status       ClusterStatus
+	eventWatcher *events.EventWatcher
+	stateWatcher *events.StateWatcher
+	retry        *time.Timer
 }
 
 var (
@@ -46,121 +114,332 @@ func init() {
 	}
 }
 
-func NewClusterManager(configResolver *config.ConfigResolver, clientConfig *rest.Config, alerts provider.Alerts) *ClusterManager {
-	client, err := versioned.NewForConfig(clientConfig)
-	if err != nil {
-		log.Error(err)
-		//return nil, fmt.Errorf("unable to create k8s client: %s", err)
-	}
-
+func NewClusterManager(configResolver *config.ConfigResolver, source ClusterSource, alerts provider.Alerts) *ClusterManager {
 	clusterManager := &ClusterManager{
-		client:         client,
 		configResolver: configResolver,
+		Source:         source,
 		CacheSynced:    make(chan struct{}),
-		clusterClient:  NewClusterClinet(client),
-		eventWatchers:  make(map[string]*events.EventWatcher),
+		clusterClient:  NewClusterClinet(),
+		clusters:       make(map[string]*managedCluster),
 		Alerts:         alerts,
+		Health:         events.NewHealthMonitor(configResolver, alerts),
 		stopCh:         make(chan struct{}),
 	}
-
-	//list, err := client.CloudV1beta1().Clusters().List(context.TODO(), metav1.ListOptions{})
-	//if err != nil {
-	//	log.Error(err)
-	//}
-	//for _, cluster := range list.Items {
-	//clusterManager.AddCluster(&cluster)
-	//}
-
 	return clusterManager
 }
 
 func (m *ClusterManager) ClusterMeshInit(asyncControllers *sync.WaitGroup) {
+	m.Lock.Lock()
+	if !m.standby {
+		m.leadLocked()
+	}
+	m.Lock.Unlock()
+	log.Info("cluster source: ", m.Source.Name())
+	go m.Source.Run(m, m.stopCh)
+}
 
-	sharedInformerFactory := externalversions.NewSharedInformerFactory(m.client, time.Minute*1)
-	clusterInformer := sharedInformerFactory.Cloud().V1beta1().Clusters()
-	clusterInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
-		AddFunc: func(obj interface{}) {
-			if cluster := ObjToV1beta1Cluster(obj); cluster != nil {
-				clusterCpy := cluster.DeepCopy()
-				m.AddCluster(clusterCpy)
-			}
-		},
-		UpdateFunc: func(oldObj, newObj interface{}) {
-			if old := ObjToV1beta1Cluster(oldObj); old != nil {
-				if new := ObjToV1beta1Cluster(newObj); new != nil {
-					if reflect.DeepEqual(old, new) {
-						return
-					}
-					oldCpy := old.DeepCopy()
-					newCpy := new.DeepCopy()
-					m.UpdateCluster(oldCpy, newCpy)
-				}
+// SetLeading starts the watchers of the clusters when leading. When not, it
+// stops them and returns once their checkpoints are saved, for the replica
+// taking over to resume from them; the clusters are kept as standby.
+func (m *ClusterManager) SetLeading(leading bool) {
+	m.Lock.Lock()
+	if leading == !m.standby {
+		m.Lock.Unlock()
+		return
+	}
+	m.standby = !leading
+	if leading {
+		log.Info("leading, starting the clusters")
+		m.leadLocked()
+	} else {
+		log.Info("not leading, stopping the clusters")
+		if m.leadStopCh != nil {
+			close(m.leadStopCh)
+			m.leadStopCh = nil
+		}
+	}
+	names, watchers := m.rebalanceLocked(0)
+	m.Lock.Unlock()
+	m.handOver(names, watchers)
+}
+
+// SetShard restricts the replica to the clusters the ring assigns to
+// identity. The clusters lost are stopped; the clusters gained start after
+// handoff, for their previous owner to save their checkpoints first.
+func (m *ClusterManager) SetShard(identity string, ring *Ring, handoff time.Duration) {
+	m.Lock.Lock()
+	m.identity = identity
+	m.ring = ring
+	m.handoffUntil = time.Now().Add(handoff)
+	names, watchers := m.rebalanceLocked(handoff)
+	m.Lock.Unlock()
+	m.handOver(names, watchers)
+}
+
+// ownsLocked tells whether the replica watches the cluster.
+func (m *ClusterManager) ownsLocked(name string) bool {
+	return !m.standby && (m.ring == nil || m.ring.Owner(name) == m.identity)
+}
+
+func (m *ClusterManager) ownerLocked(name string) string {
+	if m.ring == nil {
+		return ""
+	}
+	return m.ring.Owner(name)
+}
+
+// rebalanceLocked starts the standby clusters the replica owns, after delay,
+// and stops the clusters it does not. It returns the clusters stopped and
+// their event watchers.
+func (m *ClusterManager) rebalanceLocked(delay time.Duration) (names []string, watchers []*events.EventWatcher) {
+	for name, c := range m.clusters {
+		c.status.Owner = m.ownerLocked(name)
+		if c.status.Phase == ClusterPhaseExcluded {
+			continue
+		}
+		owned := m.ownsLocked(name)
+		switch {
+		case owned && c.status.Phase == ClusterPhaseStandby:
+			if delay > 0 {
+				m.handoffLocked(c, delay)
+			} else {
+				m.startLocked(c)
 			}
-		},
-		DeleteFunc: func(obj interface{}) {
-			cluster := ObjToV1beta1Cluster(obj)
-			if cluster == nil {
-				return
+		case !owned && c.status.Phase != ClusterPhaseStandby:
+			names = append(names, name)
+			if c.eventWatcher != nil {
+				watchers = append(watchers, c.eventWatcher)
 			}
-			m.DeleteCluster(cluster)
-		},
-	})
-	go clusterInformer.Informer().Run(m.stopCh)
-	sharedInformerFactory.Start(m.stopCh)
-	sharedInformerFactory.WaitForCacheSync(m.stopCh)
+			m.stopLocked(c)
+			c.status = ClusterStatus{Name: name, Phase: ClusterPhaseStandby, Owner: c.status.Owner}
+		}
+	}
+	return names, watchers
 }
 
-func (m *ClusterManager) GetDevK8S() *kubernetes.Clientset{
-	clientConfig, err := clientcmd.BuildConfigFromFlags("", "/Users/edz/.kube/k8s-32-dev")
-	if err != nil {
-		log.Fatal(err)
+// handOver forgets the health of the clusters stopped, and returns once the
+// checkpoints of their watchers are saved.
+func (m *ClusterManager) handOver(names []string, watchers []*events.EventWatcher) {
+	for _, name := range names {
+		m.Health.Remove(name)
+	}
+	for _, w := range watchers {
+		w.Wait()
 	}
+}
 
-	kcClient, err := kubernetes.NewForConfig(clientConfig)
-	if err != nil {
-		log.Error(err)
+// handoffLocked starts the cluster after delay.
+func (m *ClusterManager) handoffLocked(c *managedCluster, delay time.Duration) {
+	c.status.Phase = ClusterPhasePending
+	c.status.NextRetry = time.Now().Add(delay)
+	c.retry = time.AfterFunc(delay, func() { m.retryCluster(c) })
+}
+
+// leadLocked runs what only the leader runs besides the watchers, unless it
+// runs already.
+func (m *ClusterManager) leadLocked() {
+	if m.leadStopCh != nil {
+		return
 	}
-	return kcClient
+	m.leadStopCh = make(chan struct{})
+	go m.Health.Run(m.leadStopCh)
 }
 
-func (m *ClusterManager) AddCluster(cluster *v1beta1.Cluster) (bool, error) {
-	envStr := os.Getenv("env")
-	if envStr == "dev" && cluster.Name != "k8s-dev" {
+// clusterPolicy reads the policy of the cluster from its annotations and
+// labels.
+func clusterPolicy(cluster *Cluster) *config.ClusterPolicy {
+	policy := &config.ClusterPolicy{
+		Cluster: cluster.Name,
+		Sinks:   cluster.Annotations[AnnotationSinks],
+		Labels:  make(map[string]string),
+	}
+	if value, ok := cluster.Annotations[AnnotationCollect]; ok {
+		collect, err := strconv.ParseBool(value)
+		if err != nil {
+			log.WithError(err).Warning("invalid ", AnnotationCollect, " of cluster ", cluster.Name)
+		} else {
+			policy.Collect = &collect
+		}
+	}
+	for name, value := range cluster.Labels {
+		if strings.HasPrefix(name, AlertLabelPrefix) {
+			policy.Labels[strings.TrimPrefix(name, AlertLabelPrefix)] = value
+		}
+	}
+	return policy
+}
+
+// AddCluster starts the watchers of the cluster when its policy collects it.
+// A cluster added again with the same connection and policy, as on a resync,
+// is left as it is; otherwise it is restarted.
+func (m *ClusterManager) AddCluster(cluster *Cluster) (bool, error) {
+	policy := clusterPolicy(cluster)
+	m.Lock.Lock()
+	defer m.Lock.Unlock()
+	c := &managedCluster{
+		cluster: cluster,
+		policy:  policy,
+		status:  ClusterStatus{Name: cluster.Name, Owner: m.ownerLocked(cluster.Name)},
+	}
+	if old, ok := m.clusters[cluster.Name]; ok {
+		if old.cluster.sameConnection(cluster) && reflect.DeepEqual(old.policy, policy) {
+			old.cluster = cluster
+			return false, nil
+		}
+		log.Info("restart cluster:", cluster.Name)
+		watcher := old.eventWatcher
+		m.stopLocked(old)
+		m.clusters[cluster.Name] = c
+		if watcher != nil {
+			// the new watcher resumes from the checkpoint the old one saves
+			// once stopped
+			c.status.Phase = ClusterPhasePending
+			m.Lock.Unlock()
+			watcher.Wait()
+			m.Lock.Lock()
+			if m.clusters[cluster.Name] != c {
+				return false, nil
+			}
+		}
+	} else {
+		log.Info("add cluster:", cluster.Name)
+		m.clusters[cluster.Name] = c
+	}
+	m.configResolver.SetClusterPolicy(cluster.Name, policy)
+	if !m.configResolver.GetClusterPolicy(cluster.Name).Collected() {
+		c.status.Phase = ClusterPhaseExcluded
+		return false, nil
+	}
+	if !m.ownsLocked(cluster.Name) {
+		c.status.Phase = ClusterPhaseStandby
+		return false, nil
+	}
+	if delay := time.Until(m.handoffUntil); delay > 0 {
+		m.handoffLocked(c, delay)
 		return false, nil
 	}
-	log.Info("add cluster:", cluster.Name)
-	kcClient, err := m.clusterClient.GetClient(cluster.Name)
+	return m.startLocked(c)
+}
+
+// startLocked creates the client of the cluster and starts its watchers.
+// When the client fails the start is retried with backoff.
+func (m *ClusterManager) startLocked(c *managedCluster) (bool, error) {
+	name := c.cluster.Name
+	now := time.Now()
+	c.status.Attempts++
+	health := m.Health.Cluster(name)
+	kcClient, err := m.clusterClient.NewClient(c.cluster)
 	if err != nil {
-		log.Error(err)
+		health.Failed(events.HealthOpClient, err)
+		delay := retryDelay(c.status.Attempts)
+		c.status.Phase = ClusterPhaseFailed
+		c.status.LastError = err.Error()
+		c.status.NextRetry = now.Add(delay)
+		c.retry = time.AfterFunc(delay, func() { m.retryCluster(c) })
+		log.WithError(err).WithFields(logrus.Fields{
+			"cluster_name": name,
+			"attempts":     c.status.Attempts,
+		}).Error("start cluster, retrying in ", delay)
+		return false, err
 	}
-	if cluster.Name != "aliyun-us-rock-online" && cluster.Name != "neirongyun-aliyun-ack" && cluster.Name != "aliyun-yunxuexi-eci-online" {
-		//m.eventWatchers[cluster.Name] = events.NewEventWatcher(m.configResolver, cluster.Name, kcClient, m.Alerts)
-		m.eventWatchers[cluster.Name] = events.NewEventControllerWatcher(m.Workcodes,m.Reasons,m.configResolver, cluster.Name, kcClient, m.Alerts)
+	//m.eventWatchers[cluster.Name] = events.NewEventWatcher(m.configResolver, cluster.Name, kcClient, m.Alerts)
+	c.eventWatcher = events.NewEventControllerWatcher(m.Owners, m.Reasons, m.configResolver, m.DataDir, m.Checkpoints, name, kcClient, m.Alerts, health)
+	if opt := m.configResolver.GetStateWatchOpt(name); opt != nil {
+		c.stateWatcher = events.NewStateWatcher(m.Owners, m.Reasons, m.configResolver, opt, name, kcClient, m.Alerts)
 	}
-	return false, nil
+	c.status.Phase = ClusterPhaseRunning
+	c.status.LastError = ""
+	c.status.NextRetry = time.Time{}
+	c.status.StartedAt = now
+	return true, nil
 }
 
-func (s *ClusterManager) UpdateCluster(old, new *v1beta1.Cluster) (bool, error) {
+// retryCluster starts the cluster again, unless it was deleted or replaced
+// meanwhile.
+func (m *ClusterManager) retryCluster(c *managedCluster) {
+	m.Lock.Lock()
+	defer m.Lock.Unlock()
+	if m.clusters[c.cluster.Name] != c {
+		return
+	}
+	c.retry = nil
+	m.startLocked(c)
+}
+
+// stopLocked stops the watchers and the retries of the cluster and drops its
+// client.
+func (m *ClusterManager) stopLocked(c *managedCluster) {
+	if c.retry != nil {
+		c.retry.Stop()
+		c.retry = nil
+	}
+	if c.eventWatcher != nil {
+		c.eventWatcher.Stop()
+		c.eventWatcher = nil
+	}
+	if c.stateWatcher != nil {
+		c.stateWatcher.Stop()
+		c.stateWatcher = nil
+	}
+	m.clusterClient.Forget(c.cluster.Name)
+}
+
+func retryDelay(attempts int) time.Duration {
+	delay := retryMin
+	for i := 1; i < attempts && delay < retryMax; i++ {
+		delay *= 2
+	}
+	if delay > retryMax {
+		delay = retryMax
+	}
+	return delay
+}
+
+// UpdateCluster restarts the cluster when its connection changed, e.g. a
+// rotated kubeconfig, or its policy.
+func (m *ClusterManager) UpdateCluster(old, new *Cluster) (bool, error) {
 	log.WithFields(logrus.Fields{
-		"cluster_name": old.ClusterName,
+		"cluster_name": new.Name,
 	}).Debug(" Update Cluster ")
-	return false, nil
+	return m.AddCluster(new)
 }
 
-func (m *ClusterManager) DeleteCluster(cluster *v1beta1.Cluster) error {
+// DeleteCluster stops the watchers of the cluster and forgets it.
+func (m *ClusterManager) DeleteCluster(cluster *Cluster) error {
 	m.Lock.Lock()
-	if watcher, ok := m.eventWatchers[cluster.ClusterName]; !ok {
-		watcher.Stop()
+	if c, ok := m.clusters[cluster.Name]; ok {
+		m.stopLocked(c)
+		delete(m.clusters, cluster.Name)
 	}
-	delete(m.eventWatchers, cluster.ClusterName)
-	delete(m.clusterClient.kcClients, cluster.ClusterName)
+	m.configResolver.SetClusterPolicy(cluster.Name, nil)
 	m.Lock.Unlock()
+	m.Health.Remove(cluster.Name)
 	log.WithFields(logrus.Fields{
-		"cluster_name": cluster.ClusterName,
+		"cluster_name": cluster.Name,
 	}).Debug(" Delete Cluster")
 	return nil
 }
 
+// Status returns the state of the clusters, by name.
+func (m *ClusterManager) Status() []ClusterStatus {
+	health := make(map[string]events.ClusterHealthStatus)
+	for _, status := range m.Health.Status() {
+		health[status.Cluster] = status
+	}
+	m.Lock.Lock()
+	statuses := make([]ClusterStatus, 0, len(m.clusters))
+	for name, c := range m.clusters {
+		status := c.status
+		if h, ok := health[name]; ok {
+			status.Health = &h
+		}
+		statuses = append(statuses, status)
+	}
+	m.Lock.Unlock()
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
+
 func ObjToV1beta1Cluster(obj interface{}) *v1beta1.Cluster {
 	cluster, ok := obj.(*v1beta1.Cluster)
 	if ok {
@@ -0,0 +1,381 @@
+package clustermesh
+
+import (
+	"context"
+	"fmt"
+	"github.com/cespare/xxhash"
+	"github.com/crain-cn/event-mesh/pkg/k8s/kubeutil"
+	"github.com/prometheus/client_golang/prometheus"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	ShardMembershipLease   = "lease"
+	ShardMembershipService = "service"
+
+	// shardLabel marks the member Leases of a shard group, with the group
+	// name as value.
+	shardLabel = "eventmesh.io/shard"
+	// ringReplicas is the number of points of a member on the ring, which
+	// evens out the clusters between the members.
+	ringReplicas = 100
+	// shardTimeout bounds a read or write of the membership.
+	shardTimeout = 10 * time.Second
+)
+
+var (
+	shardMetricsOnce sync.Once
+
+	shardMembers = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "eventmesh",
+		Name:      "shard_members",
+		Help:      "Number of replicas sharing the clusters.",
+	})
+
+	shardRebalances = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "eventmesh",
+		Name:      "shard_rebalances_total",
+		Help:      "Number of times the clusters were rebalanced on a membership change.",
+	})
+)
+
+// ShardOptions configures how the clusters are sharded across the replicas.
+type ShardOptions struct {
+	// Membership is ShardMembershipLease, a Lease per replica, or
+	// ShardMembershipService, the ready endpoints of a headless Service.
+	Membership string
+	// Namespace and Name are those of the Service, or the group of the
+	// Leases, named Name-<identity>.
+	Namespace string
+	Name      string
+	// Identity defaults to the host name, which is the pod name, the one the
+	// endpoints of a Service refer to.
+	Identity string
+	// LeaseDuration is how long the Lease of a replica that died is a
+	// member; Interval how often the membership is read, and the Lease of
+	// the replica renewed.
+	LeaseDuration time.Duration
+	Interval      time.Duration
+	// Handoff is how long a replica waits to start the clusters it gained,
+	// for their previous owner to save their checkpoints: the previous owner
+	// reads the membership up to Interval later, then saves within the
+	// checkpoint timeout of 10s.
+	Handoff time.Duration
+}
+
+var DefaultShardOptions = ShardOptions{
+	Membership:    ShardMembershipLease,
+	Name:          "event-mesh",
+	LeaseDuration: 15 * time.Second,
+	Interval:      5 * time.Second,
+	Handoff:       20 * time.Second,
+}
+
+// Validate checks the handoff leaves the previous owner of a cluster the
+// time to read the membership.
+func (opt ShardOptions) Validate() error {
+	if opt.Interval <= 0 {
+		return fmt.Errorf("shard interval %s is not positive", opt.Interval)
+	}
+	if opt.Handoff <= opt.Interval {
+		return fmt.Errorf("shard handoff %s is not longer than the interval %s", opt.Handoff, opt.Interval)
+	}
+	return nil
+}
+
+// Ring assigns the clusters to the members by consistent hashing: a member
+// joining or leaving moves only the clusters it gains or loses.
+type Ring struct {
+	members []string
+	points  []uint64
+	owners  map[uint64]string
+}
+
+func NewRing(members []string) *Ring {
+	r := &Ring{owners: make(map[uint64]string)}
+	seen := make(map[string]bool, len(members))
+	for _, member := range members {
+		if seen[member] {
+			continue
+		}
+		seen[member] = true
+		r.members = append(r.members, member)
+		for i := 0; i < ringReplicas; i++ {
+			point := xxhash.Sum64String(member + "#" + strconv.Itoa(i))
+			r.owners[point] = member
+			r.points = append(r.points, point)
+		}
+	}
+	sort.Strings(r.members)
+	sort.Slice(r.points, func(i, j int) bool { return r.points[i] < r.points[j] })
+	return r
+}
+
+// Members returns the members, sorted.
+func (r *Ring) Members() []string {
+	return r.members
+}
+
+// Owner returns the member owning the cluster, the first point of the ring
+// from its hash; empty when there are no members.
+func (r *Ring) Owner(cluster string) string {
+	if len(r.points) == 0 {
+		return ""
+	}
+	hash := xxhash.Sum64String(cluster)
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= hash })
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.owners[r.points[i]]
+}
+
+// Membership lists the replicas sharing the clusters.
+type Membership interface {
+	// Members returns the identities of the replicas.
+	Members() ([]string, error)
+	// Leave removes the replica, for the others to take its clusters over
+	// at once.
+	Leave()
+}
+
+// NewMembership returns the membership of opt.
+func NewMembership(kc kubernetes.Interface, opt ShardOptions) (Membership, error) {
+	switch opt.Membership {
+	case ShardMembershipLease, "":
+		return &leaseMembership{kc: kc, opt: opt}, nil
+	case ShardMembershipService:
+		return &serviceMembership{kc: kc, opt: opt}, nil
+	default:
+		return nil, fmt.Errorf("unknown shard membership %q", opt.Membership)
+	}
+}
+
+// leaseMembership keeps a Lease per replica, renewed on every read.
+type leaseMembership struct {
+	kc  kubernetes.Interface
+	opt ShardOptions
+}
+
+func (m *leaseMembership) leaseName() string {
+	return m.opt.Name + "-" + m.opt.Identity
+}
+
+func (m *leaseMembership) Members() ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), shardTimeout)
+	defer cancel()
+	if err := m.renew(ctx); err != nil {
+		return nil, err
+	}
+	leases, err := m.kc.CoordinationV1().Leases(m.opt.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(labels.Set{shardLabel: m.opt.Name}).String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	var members []string
+	for _, lease := range leases.Items {
+		spec := lease.Spec
+		if spec.HolderIdentity == nil || spec.RenewTime == nil || spec.LeaseDurationSeconds == nil {
+			continue
+		}
+		expires := spec.RenewTime.Add(time.Duration(*spec.LeaseDurationSeconds) * time.Second)
+		if now.Before(expires) {
+			members = append(members, *spec.HolderIdentity)
+		}
+	}
+	return members, nil
+}
+
+// renew creates or renews the Lease of the replica.
+func (m *leaseMembership) renew(ctx context.Context) error {
+	leases := m.kc.CoordinationV1().Leases(m.opt.Namespace)
+	now := metav1.NewMicroTime(time.Now())
+	identity := m.opt.Identity
+	seconds := int32(m.opt.LeaseDuration / time.Second)
+	lease, err := leases.Get(ctx, m.leaseName(), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		lease = &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      m.leaseName(),
+				Namespace: m.opt.Namespace,
+				Labels:    map[string]string{shardLabel: m.opt.Name},
+			},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       &identity,
+				LeaseDurationSeconds: &seconds,
+				AcquireTime:          &now,
+				RenewTime:            &now,
+			},
+		}
+		_, err = leases.Create(ctx, lease, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	lease.Spec.HolderIdentity = &identity
+	lease.Spec.LeaseDurationSeconds = &seconds
+	lease.Spec.RenewTime = &now
+	_, err = leases.Update(ctx, lease, metav1.UpdateOptions{})
+	return err
+}
+
+func (m *leaseMembership) Leave() {
+	ctx, cancel := context.WithTimeout(context.Background(), shardTimeout)
+	defer cancel()
+	err := m.kc.CoordinationV1().Leases(m.opt.Namespace).Delete(ctx, m.leaseName(), metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		log.WithError(err).Error("delete shard lease: ", m.leaseName())
+	}
+}
+
+// serviceMembership reads the ready endpoints of a headless Service, named
+// after the pods they refer to.
+type serviceMembership struct {
+	kc  kubernetes.Interface
+	opt ShardOptions
+}
+
+func (m *serviceMembership) Members() ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), shardTimeout)
+	defer cancel()
+	endpoints, err := m.kc.CoreV1().Endpoints(m.opt.Namespace).Get(ctx, m.opt.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	var members []string
+	for _, subset := range endpoints.Subsets {
+		for _, address := range subset.Addresses {
+			switch {
+			case address.TargetRef != nil:
+				members = append(members, address.TargetRef.Name)
+			case len(address.Hostname) > 0:
+				members = append(members, address.Hostname)
+			default:
+				members = append(members, address.IP)
+			}
+		}
+	}
+	return members, nil
+}
+
+// Leave has nothing to do, the endpoint of the replica goes with its pod.
+func (m *serviceMembership) Leave() {}
+
+// Sharder reads the membership and tells the manager of the ring whenever
+// the members change.
+type Sharder struct {
+	opt        ShardOptions
+	membership Membership
+	manager    *ClusterManager
+	ring       *Ring
+	stopCh     chan struct{}
+	done       chan struct{}
+}
+
+// NewSharder returns the sharder of the manager, which reads the membership
+// once before returning, for the manager to start with its shard.
+func NewSharder(kc kubernetes.Interface, opt ShardOptions, manager *ClusterManager) (*Sharder, error) {
+	if err := opt.Validate(); err != nil {
+		return nil, err
+	}
+	if len(opt.Namespace) == 0 {
+		opt.Namespace = kubeutil.PodNamespace()
+	}
+	if len(opt.Identity) == 0 {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, err
+		}
+		opt.Identity = hostname
+	}
+	membership, err := NewMembership(kc, opt)
+	if err != nil {
+		return nil, err
+	}
+	shardMetricsOnce.Do(func() {
+		prometheus.MustRegister(shardMembers, shardRebalances)
+	})
+	s := &Sharder{
+		opt:        opt,
+		membership: membership,
+		manager:    manager,
+		stopCh:     make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	// own nothing until the membership is read, rather than every cluster
+	manager.SetShard(opt.Identity, NewRing(nil), 0)
+	s.sync()
+	return s, nil
+}
+
+// Namespace is the namespace of the membership, where the checkpoints
+// handed over between the replicas are kept too.
+func (s *Sharder) Namespace() string {
+	return s.opt.Namespace
+}
+
+// Name is the name of the shard group.
+func (s *Sharder) Name() string {
+	return s.opt.Name
+}
+
+// Identity is the member of the replica on the ring.
+func (s *Sharder) Identity() string {
+	return s.opt.Identity
+}
+
+// sync reads the membership and rebalances the clusters when it changed.
+// The ring is kept when the membership can not be read.
+func (s *Sharder) sync() {
+	members, err := s.membership.Members()
+	if err != nil {
+		log.WithError(err).Error("read shard membership")
+		return
+	}
+	ring := NewRing(members)
+	if s.ring != nil && reflect.DeepEqual(s.ring.Members(), ring.Members()) {
+		return
+	}
+	s.ring = ring
+	log.Info("shard members: ", ring.Members())
+	shardMembers.Set(float64(len(ring.Members())))
+	shardRebalances.Inc()
+	s.manager.SetShard(s.opt.Identity, ring, s.opt.Handoff)
+}
+
+// Run reads the membership every interval until Stop.
+func (s *Sharder) Run() {
+	defer close(s.done)
+	ticker := time.NewTicker(s.opt.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.sync()
+		case <-s.stopCh:
+			return
+		}
+	}
+}
+
+// Stop stops reading the membership and leaves it. The clusters of the
+// replica are to be stopped before, for the others to resume them from
+// their checkpoints.
+func (s *Sharder) Stop() {
+	close(s.stopCh)
+	<-s.done
+	s.membership.Leave()
+}
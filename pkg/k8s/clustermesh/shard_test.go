@@ -0,0 +1,101 @@
+package clustermesh
+
+import (
+	"fmt"
+	"k8s.io/client-go/kubernetes/fake"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRing(t *testing.T) {
+	var clusters []string
+	for i := 0; i < 300; i++ {
+		clusters = append(clusters, fmt.Sprintf("cluster-%d", i))
+	}
+	owners := func(ring *Ring) map[string]string {
+		owners := make(map[string]string)
+		for _, cluster := range clusters {
+			owners[cluster] = ring.Owner(cluster)
+		}
+		return owners
+	}
+
+	if owner := NewRing(nil).Owner("prod"); owner != "" {
+		t.Errorf("\nexpected:\n%v\ngot:\n%v", "no owner", owner)
+	}
+
+	ring := NewRing([]string{"b", "a", "c", "a"})
+	if !reflect.DeepEqual(ring.Members(), []string{"a", "b", "c"}) {
+		t.Errorf("\nexpected:\n%v\ngot:\n%v", []string{"a", "b", "c"}, ring.Members())
+	}
+	before := owners(ring)
+	count := make(map[string]int)
+	for _, owner := range before {
+		count[owner]++
+	}
+	for _, member := range ring.Members() {
+		if count[member] < len(clusters)/6 {
+			t.Errorf("\nexpected:\n%v\ngot:\n%v", "clusters evened out", count)
+		}
+	}
+
+	// a member leaving moves only its clusters
+	after := owners(NewRing([]string{"a", "b"}))
+	for cluster, owner := range before {
+		if owner != "c" && after[cluster] != owner {
+			t.Errorf("\nexpected:\n%v\ngot:\n%v", cluster+" on "+owner, after[cluster])
+		}
+	}
+}
+
+func TestLeaseMembership(t *testing.T) {
+	kc := fake.NewSimpleClientset()
+	opt := DefaultShardOptions
+	opt.Namespace = "monitoring"
+	a, _ := NewMembership(kc, withIdentity(opt, "a"))
+	b, _ := NewMembership(kc, withIdentity(opt, "b"))
+
+	if _, err := a.Members(); err != nil {
+		t.Fatal(err)
+	}
+	members, err := b.Members()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(NewRing(members).Members(), []string{"a", "b"}) {
+		t.Errorf("\nexpected:\n%v\ngot:\n%v", []string{"a", "b"}, members)
+	}
+
+	b.Leave()
+	members, _ = a.Members()
+	if !reflect.DeepEqual(members, []string{"a"}) {
+		t.Errorf("\nexpected:\n%v\ngot:\n%v", []string{"a"}, members)
+	}
+
+	// a replica that died is a member until its Lease expires
+	opt.LeaseDuration = time.Second
+	c, _ := NewMembership(kc, withIdentity(opt, "c"))
+	c.Members()
+	time.Sleep(1100 * time.Millisecond)
+	members, _ = a.Members()
+	if !reflect.DeepEqual(members, []string{"a"}) {
+		t.Errorf("\nexpected:\n%v\ngot:\n%v", []string{"a"}, members)
+	}
+}
+
+func withIdentity(opt ShardOptions, identity string) ShardOptions {
+	opt.Identity = identity
+	return opt
+}
+
+func TestShardOptionsValidate(t *testing.T) {
+	if err := DefaultShardOptions.Validate(); err != nil {
+		t.Errorf("\nexpected:\n%v\ngot:\n%v", nil, err)
+	}
+	opt := DefaultShardOptions
+	opt.Handoff = opt.Interval
+	if err := opt.Validate(); err == nil {
+		t.Errorf("\nexpected:\n%v\ngot:\n%v", "a handoff not longer than the interval rejected", err)
+	}
+}
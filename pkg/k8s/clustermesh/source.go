@@ -0,0 +1,291 @@
+package clustermesh
+
+import (
+	"fmt"
+	"github.com/crain-cn/cluster-mesh/api/cloud.mesh/v1beta1"
+	"github.com/crain-cn/cluster-mesh/client/clientset/versioned"
+	"github.com/crain-cn/cluster-mesh/client/informers/externalversions"
+	"github.com/crain-cn/event-mesh/pkg/k8s/kubeutil"
+	"github.com/fsnotify/fsnotify"
+	"io/ioutil"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+)
+
+const (
+	ClusterSourceClusterMesh = "clustermesh"
+	ClusterSourceDir         = "dir"
+	ClusterSourceFile        = "file"
+	ClusterSourceLocal       = "local"
+
+	// fileSourceResync is how often the file sources are read again besides
+	// their changes, in case a change was missed.
+	fileSourceResync = time.Minute
+	// fileSourceSettle is how long a file source waits for the changes of a
+	// write to settle before reading it.
+	fileSourceSettle = time.Second
+)
+
+// Cluster is a cluster to collect the events of, as found by a ClusterSource.
+type Cluster struct {
+	Name string
+	// Labels and Annotations give the policy of the cluster, see
+	// AnnotationCollect, AnnotationSinks and AlertLabelPrefix.
+	Labels      map[string]string
+	Annotations map[string]string
+	// KubeConfig connects to the cluster, unless Config is set.
+	KubeConfig string
+	Config     *rest.Config
+}
+
+// sameConnection tells whether the clusters connect the same way.
+func (c *Cluster) sameConnection(other *Cluster) bool {
+	return c.KubeConfig == other.KubeConfig && reflect.DeepEqual(c.Config, other.Config)
+}
+
+// restConfig returns the config of the client of the cluster.
+func (c *Cluster) restConfig() (*rest.Config, error) {
+	if c.Config != nil {
+		return c.Config, nil
+	}
+	if len(c.KubeConfig) == 0 {
+		return nil, fmt.Errorf("cluster %s has no kubeconfig", c.Name)
+	}
+	return kubeutil.LoadConfig(c.KubeConfig)
+}
+
+// ClusterHandler is told of the clusters of a source.
+type ClusterHandler interface {
+	AddCluster(cluster *Cluster) (bool, error)
+	UpdateCluster(old, new *Cluster) (bool, error)
+	DeleteCluster(cluster *Cluster) error
+}
+
+// ClusterSource finds the clusters to collect the events of, and tells the
+// handler of them and of their changes until stopCh is closed.
+type ClusterSource interface {
+	Name() string
+	Run(handler ClusterHandler, stopCh <-chan struct{})
+}
+
+// NewClusterSource returns the source of kind. path is the directory of
+// kubeconfigs of the dir source or the cluster map of the file source;
+// clientConfig reads the Cluster CRs of the clustermesh source, and is the
+// only cluster, named path or "local", of the local source.
+func NewClusterSource(kind, path string, clientConfig *rest.Config) (ClusterSource, error) {
+	switch kind {
+	case ClusterSourceClusterMesh, "":
+		client, err := versioned.NewForConfig(clientConfig)
+		if err != nil {
+			return nil, err
+		}
+		return &clusterMeshSource{client: client}, nil
+	case ClusterSourceDir:
+		return &fileSource{name: ClusterSourceDir, path: path, watch: path, load: loadKubeConfigDir}, nil
+	case ClusterSourceFile:
+		return &fileSource{name: ClusterSourceFile, path: path, watch: filepath.Dir(path), load: loadClusterMap}, nil
+	case ClusterSourceLocal:
+		name := path
+		if len(name) == 0 {
+			name = "local"
+		}
+		return &localSource{cluster: &Cluster{Name: name, Config: clientConfig}}, nil
+	default:
+		return nil, fmt.Errorf("unknown cluster source %q", kind)
+	}
+}
+
+// clusterMeshSource reads the Cluster CRs of cluster-mesh.
+type clusterMeshSource struct {
+	client *versioned.Clientset
+}
+
+func (s *clusterMeshSource) Name() string {
+	return ClusterSourceClusterMesh
+}
+
+func (s *clusterMeshSource) Run(handler ClusterHandler, stopCh <-chan struct{}) {
+	sharedInformerFactory := externalversions.NewSharedInformerFactory(s.client, time.Minute*1)
+	clusterInformer := sharedInformerFactory.Cloud().V1beta1().Clusters()
+	clusterInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if cluster := ObjToV1beta1Cluster(obj); cluster != nil {
+				handler.AddCluster(fromClusterMesh(cluster))
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			if old := ObjToV1beta1Cluster(oldObj); old != nil {
+				if new := ObjToV1beta1Cluster(newObj); new != nil {
+					if reflect.DeepEqual(old, new) {
+						return
+					}
+					handler.UpdateCluster(fromClusterMesh(old), fromClusterMesh(new))
+				}
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			cluster := ObjToV1beta1Cluster(obj)
+			if cluster == nil {
+				return
+			}
+			handler.DeleteCluster(fromClusterMesh(cluster))
+		},
+	})
+	sharedInformerFactory.Start(stopCh)
+	sharedInformerFactory.WaitForCacheSync(stopCh)
+	<-stopCh
+}
+
+func fromClusterMesh(cluster *v1beta1.Cluster) *Cluster {
+	cluster = cluster.DeepCopy()
+	return &Cluster{
+		Name:        cluster.Name,
+		Labels:      cluster.Labels,
+		Annotations: cluster.Annotations,
+		KubeConfig:  cluster.Spec.KubeConfig,
+	}
+}
+
+// localSource is the cluster of the kubeconfig of the process, or the one it
+// runs in.
+type localSource struct {
+	cluster *Cluster
+}
+
+func (s *localSource) Name() string {
+	return ClusterSourceLocal
+}
+
+func (s *localSource) Run(handler ClusterHandler, stopCh <-chan struct{}) {
+	handler.AddCluster(s.cluster)
+	<-stopCh
+}
+
+// fileSource reads the clusters from files, again when they change. A file
+// that can not be read keeps the clusters read before.
+type fileSource struct {
+	name string
+	path string
+	// watch is the path watched for changes
+	watch string
+	load  func(path string) (map[string]*Cluster, error)
+}
+
+func (s *fileSource) Name() string {
+	return s.name
+}
+
+func (s *fileSource) Run(handler ClusterHandler, stopCh <-chan struct{}) {
+	var changes <-chan fsnotify.Event
+	watcher, err := fsnotify.NewWatcher()
+	if err == nil {
+		defer watcher.Close()
+		err = watcher.Add(s.watch)
+	}
+	if err != nil {
+		log.WithError(err).Error("watch cluster source, reading it every ", fileSourceResync, ": ", s.watch)
+	} else {
+		changes = watcher.Events
+	}
+
+	clusters := make(map[string]*Cluster)
+	clusters = s.reload(handler, clusters)
+	resync := time.NewTicker(fileSourceResync)
+	defer resync.Stop()
+	var settle <-chan time.Time
+	for {
+		select {
+		case <-changes:
+			// a write comes as several events, and a ConfigMap update as
+			// the swap of a symlink
+			if settle == nil {
+				settle = time.After(fileSourceSettle)
+			}
+		case <-settle:
+			settle = nil
+			clusters = s.reload(handler, clusters)
+		case <-resync.C:
+			clusters = s.reload(handler, clusters)
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+// reload reads the clusters and tells the handler of the ones added, changed
+// and removed since the clusters read before.
+func (s *fileSource) reload(handler ClusterHandler, before map[string]*Cluster) map[string]*Cluster {
+	clusters, err := s.load(s.path)
+	if err != nil {
+		log.WithError(err).Error("read cluster source: ", s.path)
+		return before
+	}
+	for name, cluster := range clusters {
+		old, ok := before[name]
+		switch {
+		case !ok:
+			handler.AddCluster(cluster)
+		case !reflect.DeepEqual(old, cluster):
+			handler.UpdateCluster(old, cluster)
+		}
+	}
+	for name, cluster := range before {
+		if _, ok := clusters[name]; !ok {
+			handler.DeleteCluster(cluster)
+		}
+	}
+	return clusters
+}
+
+// loadKubeConfigDir reads a kubeconfig per cluster, named after the file
+// without its extension. Hidden files are skipped, such as the ..data links
+// of a mounted Secret.
+func loadKubeConfigDir(dir string) (map[string]*Cluster, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	clusters := make(map[string]*Cluster)
+	for _, file := range files {
+		if strings.HasPrefix(file.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(dir, file.Name())
+		// follow the links of a mounted Secret or ConfigMap
+		info, err := os.Stat(path)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		name := strings.TrimSuffix(file.Name(), filepath.Ext(file.Name()))
+		clusters[name] = &Cluster{Name: name, KubeConfig: string(b)}
+	}
+	return clusters, nil
+}
+
+// loadClusterMap reads a cluster map of kubeutil, the clusters are named
+// after their alias.
+func loadClusterMap(path string) (map[string]*Cluster, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := kubeutil.UnmarshalClusterMap(b)
+	if err != nil {
+		return nil, err
+	}
+	clusters := make(map[string]*Cluster, len(raw))
+	for alias := range raw {
+		c := raw[alias]
+		clusters[alias] = &Cluster{Name: alias, Config: kubeutil.RestConfig(&c)}
+	}
+	return clusters, nil
+}
@@ -0,0 +1,164 @@
+package events
+
+import (
+	"fmt"
+	"github.com/cespare/xxhash"
+	"github.com/crain-cn/event-mesh/cmd/config"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+var digitsRegexp = regexp.MustCompile(`\d+`)
+
+// EventFingerprint identifies repeated occurrences of the same problem: the
+// involved object, the reason and the message with numbers masked, so that
+// "0/12 nodes are available" and "0/13 nodes are available" collapse.
+func EventFingerprint(cluster string, event *v1.Event) string {
+	obj := event.InvolvedObject
+	message := digitsRegexp.ReplaceAllString(event.Message, "#")
+	key := fmt.Sprintf("%s|%s|%s|%s|%s|%s", cluster, obj.Kind, obj.Namespace, obj.Name, event.Reason, message)
+	return fmt.Sprintf("%016x", xxhash.Sum64String(key))
+}
+
+// eventAggregate tracks the occurrences of one fingerprint. Kubernetes bumps
+// Count on the same Event object and creates new objects once its own
+// aggregation window passes, so the total is summed over object UIDs.
+type eventAggregate struct {
+	fingerprint string
+	firstSeen   time.Time
+	lastSeen    time.Time
+	counts      map[types.UID]int32
+	count       int32
+	notified    int32
+
+	// historyLock serializes the history writes of the aggregate. historyID
+	// is the row updated in place, zero until inserted, and written is the
+	// count stored in it.
+	historyLock sync.Mutex
+	historyID   uint
+	written     int32
+}
+
+// eventOccurrence is the state of an aggregate right after an event was
+// observed.
+type eventOccurrence struct {
+	aggregate   *eventAggregate
+	Fingerprint string
+	Count       int32
+	FirstSeen   time.Time
+	LastSeen    time.Time
+	// Notify is set when Count reached a notify count for the first time.
+	Notify bool
+}
+
+type eventAggregator struct {
+	lock         sync.Mutex
+	items        map[string]*eventAggregate
+	notifyCounts []int32
+	idleTimeout  time.Duration
+}
+
+func newEventAggregator(opt *config.EventAggregationOpt) *eventAggregator {
+	notifyCounts := append([]int32(nil), opt.NotifyCounts...)
+	sort.Slice(notifyCounts, func(i, j int) bool { return notifyCounts[i] < notifyCounts[j] })
+	return &eventAggregator{
+		items:        make(map[string]*eventAggregate),
+		notifyCounts: notifyCounts,
+		idleTimeout:  opt.IdleTimeout,
+	}
+}
+
+// Observe records the event seen at t. Observing the same version of an event
+// twice does not change the count, so retried events are not counted again.
+func (a *eventAggregator) Observe(cluster string, event *v1.Event, t time.Time) *eventOccurrence {
+	fp := EventFingerprint(cluster, event)
+	count := eventCount(event)
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	agg, ok := a.items[fp]
+	if !ok || t.Sub(agg.lastSeen) > a.idleTimeout {
+		agg = &eventAggregate{
+			fingerprint: fp,
+			firstSeen:   t,
+			counts:      make(map[types.UID]int32),
+		}
+		a.items[fp] = agg
+	}
+	if prev := agg.counts[event.UID]; count > prev {
+		agg.count += count - prev
+		agg.counts[event.UID] = count
+	}
+	if t.After(agg.lastSeen) {
+		agg.lastSeen = t
+	}
+
+	occurrence := &eventOccurrence{
+		aggregate:   agg,
+		Fingerprint: fp,
+		Count:       agg.count,
+		FirstSeen:   agg.firstSeen,
+		LastSeen:    agg.lastSeen,
+	}
+	for _, n := range a.notifyCounts {
+		if n > agg.notified && n <= agg.count {
+			occurrence.Notify = true
+			agg.notified = n
+		}
+	}
+	return occurrence
+}
+
+// gc forgets aggregates that have been idle longer than idleTimeout.
+func (a *eventAggregator) gc(now time.Time) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	for fp, agg := range a.items {
+		if now.Sub(agg.lastSeen) > a.idleTimeout {
+			delete(a.items, fp)
+		}
+	}
+}
+
+func (a *eventAggregator) Run(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(a.idleTimeout)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			a.gc(time.Now())
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+// saveHistory inserts the history row of the aggregate once and updates it in
+// place afterwards. An occurrence older than the stored one is not written,
+// so the stored count never goes down.
+func (o *eventOccurrence) saveHistory(add func() (uint, error), update func(id uint) error) error {
+	agg := o.aggregate
+	agg.historyLock.Lock()
+	defer agg.historyLock.Unlock()
+	if agg.historyID == 0 {
+		id, err := add()
+		if err != nil {
+			return err
+		}
+		agg.historyID = id
+		agg.written = o.Count
+		return nil
+	}
+	if o.Count <= agg.written {
+		return nil
+	}
+	if err := update(agg.historyID); err != nil {
+		return err
+	}
+	agg.written = o.Count
+	return nil
+}
@@ -0,0 +1,114 @@
+package events
+
+import (
+	"github.com/crain-cn/event-mesh/cmd/config"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"testing"
+	"time"
+)
+
+func newTestAggregator() *eventAggregator {
+	return newEventAggregator(&config.EventAggregationOpt{
+		NotifyCounts: []int32{5, 1, 20},
+		IdleTimeout:  time.Hour,
+	})
+}
+
+func newCountedEvent(uid types.UID, count int32, message string) *v1.Event {
+	event := newTestEvent("Warning", "BackOff", "kubelet", "Pod", "default", "pod", message)
+	event.UID = uid
+	event.Count = count
+	return event
+}
+
+func TestAggregatorNotifyCounts(t *testing.T) {
+	aggregator := newTestAggregator()
+	now := time.Now()
+
+	var notified []int32
+	for count := int32(1); count <= 25; count++ {
+		o := aggregator.Observe("test", newCountedEvent("a", count, "Back-off restarting failed container"), now)
+		if o.Notify {
+			notified = append(notified, o.Count)
+		}
+	}
+	expected := []int32{1, 5, 20}
+	if len(notified) != len(expected) {
+		t.Fatalf("\nexpected:\n%v\ngot:\n%v", expected, notified)
+	}
+	for i := range expected {
+		if notified[i] != expected[i] {
+			t.Errorf("\nexpected:\n%v\ngot:\n%v", expected, notified)
+		}
+	}
+}
+
+func TestAggregatorCountsAcrossObjects(t *testing.T) {
+	aggregator := newTestAggregator()
+	now := time.Now()
+
+	aggregator.Observe("test", newCountedEvent("a", 3, "0/12 nodes are available"), now)
+	// observing the same version again, e.g. on retry, does not count
+	aggregator.Observe("test", newCountedEvent("a", 3, "0/12 nodes are available"), now)
+	// a new object for the same problem adds to the total
+	o := aggregator.Observe("test", newCountedEvent("b", 2, "0/13 nodes are available"), now.Add(time.Minute))
+
+	expected := int32(5)
+	if o.Count != expected {
+		t.Errorf("\nexpected:\n%v\ngot:\n%v", expected, o.Count)
+	}
+	if !o.FirstSeen.Equal(now) || !o.LastSeen.Equal(now.Add(time.Minute)) {
+		t.Errorf("unexpected first/last seen: %v %v", o.FirstSeen, o.LastSeen)
+	}
+
+	other := aggregator.Observe("test", newCountedEvent("c", 1, "Liveness probe failed"), now)
+	if other.Fingerprint == o.Fingerprint {
+		t.Errorf("expected a different fingerprint for a different message")
+	}
+}
+
+func TestAggregatorIdleTimeout(t *testing.T) {
+	aggregator := newTestAggregator()
+	now := time.Now()
+
+	aggregator.Observe("test", newCountedEvent("a", 4, "Back-off"), now)
+	o := aggregator.Observe("test", newCountedEvent("b", 1, "Back-off"), now.Add(2*time.Hour))
+	if o.Count != 1 || !o.Notify {
+		t.Errorf("expected a new aggregate after the idle timeout, got count %d", o.Count)
+	}
+
+	aggregator.gc(now.Add(4 * time.Hour))
+	if len(aggregator.items) != 0 {
+		t.Errorf("expected idle aggregates to be collected, got %d", len(aggregator.items))
+	}
+}
+
+func TestAggregatorSaveHistory(t *testing.T) {
+	aggregator := newTestAggregator()
+	now := time.Now()
+
+	var adds, updates int
+	add := func() (uint, error) {
+		adds++
+		return 42, nil
+	}
+	update := func(id uint) error {
+		if id != 42 {
+			t.Errorf("\nexpected:\n%v\ngot:\n%v", 42, id)
+		}
+		updates++
+		return nil
+	}
+
+	first := aggregator.Observe("test", newCountedEvent("a", 1, "Back-off"), now)
+	second := aggregator.Observe("test", newCountedEvent("a", 2, "Back-off"), now)
+	for _, o := range []*eventOccurrence{first, second, first} {
+		if err := o.saveHistory(add, update); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if adds != 1 || updates != 1 {
+		t.Errorf("expected 1 insert and 1 update, got %d and %d", adds, updates)
+	}
+}
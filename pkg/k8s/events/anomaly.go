@@ -0,0 +1,275 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/crain-cn/event-mesh/cmd/config"
+	"github.com/crain-cn/event-mesh/pkg/provider"
+	"github.com/prometheus/alertmanager/types"
+	common_model "github.com/prometheus/common/model"
+	"io/ioutil"
+	corev1 "k8s.io/api/core/v1"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	EventRateAnomaly = "EventRateAnomaly"
+	// anomalyAlertLifetimes is how many intervals an anomaly alert fires
+	// without being put again.
+	anomalyAlertLifetimes = 2
+	// forgetBaseline is the mean under which an idle baseline is dropped;
+	// a warmed one is remembered as quiet.
+	forgetBaseline = 0.01
+)
+
+// rateBaseline is the EWMA of the number of events per interval.
+type rateBaseline struct {
+	Mean     float64 `json:"mean"`
+	Variance float64 `json:"variance"`
+	Samples  int     `json:"samples"`
+}
+
+// update adds an interval to the baseline.
+func (b *rateBaseline) update(observed, alpha float64) {
+	if b.Samples == 0 {
+		b.Mean = observed
+	} else {
+		diff := observed - b.Mean
+		b.Mean += alpha * diff
+		b.Variance = (1 - alpha) * (b.Variance + alpha*diff*diff)
+	}
+	b.Samples++
+}
+
+type anomalyFile struct {
+	Baselines map[string]*rateBaseline `json:"baselines"`
+	Warmed    []string                 `json:"warmed,omitempty"`
+}
+
+// rateDetector learns the event rate of every namespace, and of every reason
+// in it, and alerts when an interval has far more events than its baseline,
+// e.g. a bad rollout, even when no single reason crosses a count rule. The
+// baselines are checkpointed to the data directory, so a restart does not
+// learn them again.
+type rateDetector struct {
+	cluster  string
+	path     string
+	opt      *config.EventAnomalyOpt
+	types    stringSet
+	alerts   provider.Alerts
+	mentions *ownerMentions
+
+	lock      sync.Mutex
+	counts    map[string]int
+	baselines map[string]*rateBaseline
+	// warmed are the keys whose baseline was warmed up then dropped as
+	// idle: their next events are compared to a quiet baseline rather than
+	// learnt again.
+	warmed map[string]bool
+	firing map[string]*types.Alert
+}
+
+// rateKey is the namespace and the reason, or the namespace alone for all of
+// its events.
+func rateKey(namespace, reason string) string {
+	return namespace + "/" + reason
+}
+
+func splitRateKey(key string) (namespace, reason string) {
+	i := strings.Index(key, "/")
+	return key[:i], key[i+1:]
+}
+
+// loadRateDetector reads the baselines of the cluster from dataDir. An empty
+// dataDir keeps them in memory only.
+func loadRateDetector(dataDir, cluster string, opt *config.EventAnomalyOpt, alerts provider.Alerts, mentions *ownerMentions) *rateDetector {
+	d := &rateDetector{
+		cluster:   cluster,
+		opt:       opt,
+		types:     newStringSet(opt.Types),
+		alerts:    alerts,
+		mentions:  mentions,
+		counts:    make(map[string]int),
+		baselines: make(map[string]*rateBaseline),
+		warmed:    make(map[string]bool),
+		firing:    make(map[string]*types.Alert),
+	}
+	if len(dataDir) == 0 {
+		return d
+	}
+	d.path = filepath.Join(dataDir, "anomaly", cluster+".json")
+
+	b, err := ioutil.ReadFile(d.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.WithError(err).Error("read event rate baselines: ", d.path)
+		}
+		return d
+	}
+	var f anomalyFile
+	if err := json.Unmarshal(b, &f); err != nil {
+		log.WithError(err).Error("decode event rate baselines: ", d.path)
+		return d
+	}
+	if f.Baselines != nil {
+		d.baselines = f.Baselines
+	}
+	for _, key := range f.Warmed {
+		d.warmed[key] = true
+	}
+	return d
+}
+
+// Observe counts the event into the current interval.
+func (d *rateDetector) Observe(event *corev1.Event) {
+	if d == nil || !d.types.match(event.Type) {
+		return
+	}
+	namespace := event.InvolvedObject.Namespace
+	d.lock.Lock()
+	d.counts[rateKey(namespace, event.Reason)]++
+	d.counts[rateKey(namespace, "")]++
+	d.lock.Unlock()
+}
+
+// Run closes an interval every Interval, and saves the baselines after it and
+// once more when stopCh is closed.
+func (d *rateDetector) Run(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(d.opt.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			d.evaluate(time.Now())
+		case <-stopCh:
+			if err := d.Save(); err != nil {
+				log.WithError(err).Error("save event rate baselines: ", d.path)
+			}
+			return
+		}
+		if err := d.Save(); err != nil {
+			log.WithError(err).Error("save event rate baselines: ", d.path)
+		}
+	}
+}
+
+// evaluate compares the interval that ends now to the baselines, then adds
+// it to them. A lasting change of rate becomes the new baseline.
+func (d *rateDetector) evaluate(now time.Time) {
+	var alerts []*types.Alert
+	d.lock.Lock()
+	counts := d.counts
+	d.counts = make(map[string]int)
+	for key := range counts {
+		if _, ok := d.baselines[key]; ok {
+			continue
+		}
+		if d.warmed[key] {
+			// quiet, with a mean of 0 which MinEvents bounds
+			d.baselines[key] = &rateBaseline{Samples: d.opt.Warmup}
+			delete(d.warmed, key)
+		} else {
+			d.baselines[key] = &rateBaseline{}
+		}
+	}
+	for key, b := range d.baselines {
+		observed := float64(counts[key])
+		if b.Samples >= d.opt.Warmup && counts[key] >= d.opt.MinEvents && observed > d.opt.Factor*b.Mean {
+			alert := d.alert(key, observed, b, now)
+			if last, ok := d.firing[key]; ok {
+				alert.StartsAt = last.StartsAt
+			}
+			d.firing[key] = alert
+			alerts = append(alerts, alert)
+		} else if last, ok := d.firing[key]; ok {
+			resolved := *last
+			resolved.EndsAt = now
+			resolved.UpdatedAt = now
+			alerts = append(alerts, &resolved)
+			delete(d.firing, key)
+		}
+		b.update(observed, d.opt.Alpha)
+		if observed == 0 && b.Mean < forgetBaseline {
+			if b.Samples >= d.opt.Warmup {
+				d.warmed[key] = true
+			}
+			delete(d.baselines, key)
+		}
+	}
+	d.lock.Unlock()
+
+	if len(alerts) == 0 {
+		return
+	}
+	if err := d.alerts.Put(alerts...); err != nil {
+		log.WithError(err).Error("put event rate alerts: ", d.cluster)
+	}
+}
+
+func (d *rateDetector) alert(key string, observed float64, b *rateBaseline, now time.Time) *types.Alert {
+	namespace, reason := splitRateKey(key)
+	labelSet := objectLabels(d.cluster, &corev1.ObjectReference{Kind: "Namespace", Namespace: namespace, Name: namespace}, "")
+	labelSet["alertname"] = EventRateAnomaly
+	labelSet["severity"] = config.SeverityWarning
+	labelSet["event_type"] = EVENT_TYPE_WARRNIGN
+	labelSet["event_reason"] = EventRateAnomaly
+	if len(reason) > 0 {
+		labelSet["rate_reason"] = common_model.LabelValue(reason)
+	}
+	addOwnerLabels(labelSet, d.mentions, namespace, nil)
+
+	what := "events"
+	if len(reason) > 0 {
+		what = reason + " events"
+	}
+	return &types.Alert{
+		Alert: common_model.Alert{
+			Labels: labelSet,
+			Annotations: common_model.LabelSet{
+				"message":  common_model.LabelValue(fmt.Sprintf("%.0f %s in %s, %.1f expected", observed, what, d.opt.Interval, b.Mean)),
+				"observed": common_model.LabelValue(strconv.FormatFloat(observed, 'f', 0, 64)),
+				"expected": common_model.LabelValue(strconv.FormatFloat(b.Mean, 'f', 2, 64)),
+				"stddev":   common_model.LabelValue(strconv.FormatFloat(math.Sqrt(b.Variance), 'f', 2, 64)),
+				"interval": common_model.LabelValue(d.opt.Interval.String()),
+			},
+			StartsAt: now,
+			EndsAt:   now.Add(anomalyAlertLifetimes * d.opt.Interval),
+		},
+		UpdatedAt: now,
+	}
+}
+
+// Save writes the baselines.
+func (d *rateDetector) Save() error {
+	if len(d.path) == 0 {
+		return nil
+	}
+	d.lock.Lock()
+	f := &anomalyFile{Baselines: d.baselines}
+	for key := range d.warmed {
+		f.Warmed = append(f.Warmed, key)
+	}
+	sort.Strings(f.Warmed)
+	b, err := json.Marshal(f)
+	d.lock.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(d.path), 0755); err != nil {
+		return err
+	}
+	// write and rename, so a crash never leaves truncated baselines
+	tmp := d.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, d.path)
+}
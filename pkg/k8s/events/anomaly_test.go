@@ -0,0 +1,132 @@
+package events
+
+import (
+	"github.com/crain-cn/event-mesh/cmd/config"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestRateDetector(t *testing.T) {
+	dir, err := ioutil.TempDir("", "anomaly")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	opt := config.DefaultEventAnomalyOpt
+	opt.Warmup = 3
+	opt.MinEvents = 10
+	alerts := &putAlerts{}
+	d := loadRateDetector(dir, "prod", &opt, alerts, nil)
+
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		d.Observe(newTestEvent("Warning", "BackOff", "kubelet", "Pod", "shop", "web-1", ""))
+		d.Observe(newTestEvent("Warning", "BackOff", "kubelet", "Pod", "shop", "web-2", ""))
+		// normal events are not counted
+		d.Observe(newTestEvent("Normal", "Pulled", "kubelet", "Pod", "shop", "web-1", ""))
+		d.evaluate(now)
+	}
+	if len(alerts.put) != 0 {
+		t.Errorf("\nexpected:\n%v\ngot:\n%v", 0, alerts.put)
+	}
+
+	// the baselines are checkpointed and learnt on
+	if err := d.Save(); err != nil {
+		t.Fatal(err)
+	}
+	d = loadRateDetector(dir, "prod", &opt, alerts, nil)
+	if b := d.baselines[rateKey("shop", "BackOff")]; b == nil || b.Samples != 3 || b.Mean != 2 {
+		t.Fatalf("\nexpected:\n%v\ngot:\n%v", "3 samples of 2 events", b)
+	}
+
+	// a bad rollout
+	for i := 0; i < 40; i++ {
+		d.Observe(newTestEvent("Warning", "BackOff", "kubelet", "Pod", "shop", "web-1", ""))
+	}
+	for i := 0; i < 5; i++ {
+		d.Observe(newTestEvent("Warning", "FailedMount", "kubelet", "Pod", "shop", "web-1", ""))
+	}
+	later := now.Add(opt.Interval)
+	d.evaluate(later)
+	if len(alerts.put) != 2 {
+		t.Fatalf("\nexpected:\n%v\ngot:\n%v", "the namespace and BackOff alerts", alerts.put)
+	}
+	for _, alert := range alerts.put {
+		if alert.Labels["alertname"] != EventRateAnomaly || alert.Labels["namespace"] != "shop" || !alert.StartsAt.Equal(later) || !alert.EndsAt.After(later) {
+			t.Errorf("\nexpected:\n%v\ngot:\n%v", "a firing shop anomaly", alert)
+		}
+		switch alert.Labels["rate_reason"] {
+		case "BackOff":
+			if alert.Annotations["observed"] != "40" || alert.Annotations["expected"] != "2.00" {
+				t.Errorf("\nexpected:\n%v\ngot:\n%v", "40 observed, 2 expected", alert.Annotations)
+			}
+		case "":
+			if alert.Annotations["observed"] != "45" {
+				t.Errorf("\nexpected:\n%v\ngot:\n%v", "45 observed", alert.Annotations)
+			}
+		default:
+			t.Errorf("\nexpected:\n%v\ngot:\n%v", "no FailedMount alert", alert.Labels)
+		}
+	}
+
+	// the rate is back to normal
+	alerts.put = nil
+	last := later.Add(opt.Interval)
+	d.evaluate(last)
+	if len(alerts.put) != 2 || !alerts.put[0].ResolvedAt(last) || !alerts.put[1].ResolvedAt(last) {
+		t.Errorf("\nexpected:\n%v\ngot:\n%v", "both alerts resolved", alerts.put)
+	}
+}
+
+func TestRateDetectorForgetsQuietBaseline(t *testing.T) {
+	dir, err := ioutil.TempDir("", "anomaly")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	opt := config.DefaultEventAnomalyOpt
+	opt.Warmup = 3
+	opt.MinEvents = 10
+	opt.Alpha = 0.5
+	alerts := &putAlerts{}
+	d := loadRateDetector(dir, "prod", &opt, alerts, nil)
+
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		d.Observe(newTestEvent("Warning", "BackOff", "kubelet", "Pod", "shop", "web-1", ""))
+		d.evaluate(now)
+	}
+	// quiet until the baseline is dropped
+	for i := 0; i < 20; i++ {
+		d.evaluate(now)
+	}
+	key := rateKey("shop", "BackOff")
+	if _, ok := d.baselines[key]; ok || !d.warmed[key] {
+		t.Fatalf("\nexpected:\n%v\ngot:\n%v", "a warmed key without baseline", d.baselines[key])
+	}
+
+	// the warmed keys are checkpointed
+	if err := d.Save(); err != nil {
+		t.Fatal(err)
+	}
+	d = loadRateDetector(dir, "prod", &opt, alerts, nil)
+
+	// a burst alerts at once, as a new namespace does not
+	for i := 0; i < 15; i++ {
+		d.Observe(newTestEvent("Warning", "BackOff", "kubelet", "Pod", "shop", "web-1", ""))
+		d.Observe(newTestEvent("Warning", "BackOff", "kubelet", "Pod", "blog", "web-1", ""))
+	}
+	d.evaluate(now.Add(opt.Interval))
+	if len(alerts.put) != 2 {
+		t.Fatalf("\nexpected:\n%v\ngot:\n%v", "the shop namespace and BackOff alerts", alerts.put)
+	}
+	for _, alert := range alerts.put {
+		if alert.Labels["namespace"] != "shop" || alert.Annotations["observed"] != "15" || alert.Annotations["expected"] != "0.00" {
+			t.Errorf("\nexpected:\n%v\ngot:\n%v", "15 shop events, 0 expected", alert)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package events
+
+import (
+	"encoding/json"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	checkpointInterval = 10 * time.Second
+	// handledRetention outlives the default one hour event TTL of the
+	// apiserver, so an event is forgotten only after it is gone.
+	handledRetention = 3 * time.Hour
+	// maxHandledEvents bounds the handled UIDs kept, the oldest are
+	// forgotten first.
+	maxHandledEvents = 10000
+)
+
+// eventCheckpoint persists where the event watch of a cluster can resume.
+//
+// Events are handled concurrently, so the resourceVersion stored is the low
+// watermark: every event received up to it is done. Events received after it
+// are delivered again on resume, and the handled UIDs tell which of them were
+// already done. Only the events handed to the queue are recorded: the others
+// are filtered or shed again on resume.
+type eventCheckpoint struct {
+	store CheckpointStore
+	name  string
+
+	lock            sync.Mutex
+	resourceVersion string
+	handled         map[types.UID]*handledEvent
+	inflight        []*inflightEvent
+	dirty           bool
+}
+
+type handledEvent struct {
+	Count int32     `json:"count"`
+	Seen  time.Time `json:"seen"`
+}
+
+type checkpointFile struct {
+	ResourceVersion string                      `json:"resourceVersion"`
+	Handled         map[types.UID]*handledEvent `json:"handled"`
+}
+
+// inflightEvent is an event received from the watch and not done yet.
+type inflightEvent struct {
+	checkpoint      *eventCheckpoint
+	resourceVersion string
+	uid             types.UID
+	count           int32
+	done            bool
+}
+
+// loadEventCheckpoint reads the checkpoint name from store. A nil store
+// keeps the checkpoint in memory only.
+func loadEventCheckpoint(store CheckpointStore, name string) *eventCheckpoint {
+	c := &eventCheckpoint{
+		store:   store,
+		name:    name,
+		handled: make(map[types.UID]*handledEvent),
+	}
+	if store == nil {
+		return c
+	}
+
+	b, err := store.Load(name)
+	if err != nil {
+		log.WithError(err).Error("read event checkpoint: ", name)
+		return c
+	}
+	if b == nil {
+		return c
+	}
+	var f checkpointFile
+	if err := json.Unmarshal(b, &f); err != nil {
+		log.WithError(err).Error("decode event checkpoint: ", name)
+		return c
+	}
+	c.resourceVersion = f.ResourceVersion
+	if f.Handled != nil {
+		c.handled = f.Handled
+	}
+	return c
+}
+
+func (c *eventCheckpoint) ResourceVersion() string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.resourceVersion
+}
+
+// Seen reports whether this or a later version of the event is done.
+func (c *eventCheckpoint) Seen(event *v1.Event) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	h, ok := c.handled[event.UID]
+	return ok && h.Count >= eventCount(event)
+}
+
+// Track registers an event received at resourceVersion; event is nil for
+// bookmarks. The checkpoint moves past resourceVersion once the returned
+// entry and all entries tracked before it are done. Listed events are
+// tracked with an empty resourceVersion, as a list is not ordered.
+func (c *eventCheckpoint) Track(resourceVersion string, event *v1.Event) *inflightEvent {
+	i := &inflightEvent{
+		checkpoint:      c,
+		resourceVersion: resourceVersion,
+	}
+	if event != nil {
+		i.uid = event.UID
+		i.count = eventCount(event)
+	}
+	c.lock.Lock()
+	c.inflight = append(c.inflight, i)
+	c.lock.Unlock()
+	return i
+}
+
+// Done marks the event as handled. Calling it or Skip again has no effect.
+func (i *inflightEvent) Done() {
+	i.finish(true)
+}
+
+// Skip marks the event as done without recording it as handled, for the
+// events filtered, shed or handled before.
+func (i *inflightEvent) Skip() {
+	i.finish(false)
+}
+
+func (i *inflightEvent) finish(handled bool) {
+	c := i.checkpoint
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if i.done {
+		return
+	}
+	i.done = true
+	if handled && len(i.uid) > 0 {
+		if h, ok := c.handled[i.uid]; !ok || h.Count < i.count {
+			c.handled[i.uid] = &handledEvent{Count: i.count}
+		}
+		c.handled[i.uid].Seen = time.Now()
+	}
+	n := 0
+	for ; n < len(c.inflight) && c.inflight[n].done; n++ {
+		if rv := c.inflight[n].resourceVersion; len(rv) > 0 {
+			c.resourceVersion = rv
+		}
+	}
+	c.inflight = c.inflight[n:]
+	c.dirty = true
+}
+
+// Save writes the checkpoint if it changed since the last save.
+func (c *eventCheckpoint) Save() error {
+	if c.store == nil {
+		return nil
+	}
+	c.lock.Lock()
+	if !c.dirty {
+		c.lock.Unlock()
+		return nil
+	}
+	c.forgetHandledLocked(time.Now())
+	c.dirty = false
+	c.lock.Unlock()
+	for {
+		c.lock.Lock()
+		b, err := json.Marshal(&checkpointFile{
+			ResourceVersion: c.resourceVersion,
+			Handled:         c.handled,
+		})
+		c.lock.Unlock()
+		if err != nil {
+			return err
+		}
+		err = c.store.Save(c.name, b)
+		if err == errCheckpointTooLarge && c.shrink() {
+			continue
+		}
+		if err != nil {
+			// save again on the next tick
+			c.lock.Lock()
+			c.dirty = true
+			c.lock.Unlock()
+			return err
+		}
+		return nil
+	}
+}
+
+// shrink forgets the oldest quarter of the handled UIDs, for the checkpoint
+// to fit its store. It is false when there are none left to forget.
+func (c *eventCheckpoint) shrink() bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	n := len(c.handled)
+	if n == 0 {
+		return false
+	}
+	c.forgetOldestLocked((n + 3) / 4)
+	log.Warning("event checkpoint too large, forgot the oldest handled events: ", c.name, ", ", len(c.handled), " kept")
+	return true
+}
+
+// forgetHandledLocked drops the handled UIDs past their retention, and the
+// oldest ones beyond maxHandledEvents.
+func (c *eventCheckpoint) forgetHandledLocked(now time.Time) {
+	for uid, h := range c.handled {
+		if now.Sub(h.Seen) > handledRetention {
+			delete(c.handled, uid)
+		}
+	}
+	c.forgetOldestLocked(len(c.handled) - maxHandledEvents)
+}
+
+// forgetOldestLocked drops the n handled UIDs seen first.
+func (c *eventCheckpoint) forgetOldestLocked(n int) {
+	if n <= 0 {
+		return
+	}
+	uids := make([]types.UID, 0, len(c.handled))
+	for uid := range c.handled {
+		uids = append(uids, uid)
+	}
+	sort.Slice(uids, func(i, j int) bool { return c.handled[uids[i]].Seen.Before(c.handled[uids[j]].Seen) })
+	if n > len(uids) {
+		n = len(uids)
+	}
+	for _, uid := range uids[:n] {
+		delete(c.handled, uid)
+	}
+}
+
+// Run saves the checkpoint periodically and once more when stopCh is closed.
+func (c *eventCheckpoint) Run(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(checkpointInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-stopCh:
+			if err := c.Save(); err != nil {
+				log.WithError(err).Error("save event checkpoint: ", c.name)
+			}
+			return
+		}
+		if err := c.Save(); err != nil {
+			log.WithError(err).Error("save event checkpoint: ", c.name)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package events
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io/ioutil"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// checkpointKey is the key of the checkpoint in its ConfigMap.
+	checkpointKey = "checkpoint.json.gz"
+	// checkpointLabel marks the ConfigMaps of the checkpoints.
+	checkpointLabel = "eventmesh.io/checkpoint"
+	// checkpointTimeout bounds a read or write of a ConfigMap.
+	checkpointTimeout = 10 * time.Second
+	// maxConfigMapCheckpoint is the largest compressed checkpoint saved,
+	// below the 1MiB limit of a ConfigMap with room for its metadata.
+	maxConfigMapCheckpoint = 1000 * 1024
+)
+
+// errCheckpointTooLarge is returned by a store that can not keep a
+// checkpoint that large; the checkpoint forgets its oldest handled events.
+var errCheckpointTooLarge = errors.New("event checkpoint too large")
+
+// CheckpointStore keeps the event checkpoints, by name.
+type CheckpointStore interface {
+	// Load returns nil when there is no checkpoint name.
+	Load(name string) ([]byte, error)
+	Save(name string, b []byte) error
+}
+
+// fileCheckpointStore keeps a file per checkpoint, on the disk of the replica.
+type fileCheckpointStore struct {
+	dir string
+}
+
+// NewFileCheckpointStore keeps the checkpoints under dataDir. An empty
+// dataDir returns nil, which keeps the checkpoints in memory only.
+func NewFileCheckpointStore(dataDir string) CheckpointStore {
+	if len(dataDir) == 0 {
+		return nil
+	}
+	return &fileCheckpointStore{dir: filepath.Join(dataDir, "events")}
+}
+
+func (s *fileCheckpointStore) Load(name string) ([]byte, error) {
+	b, err := ioutil.ReadFile(filepath.Join(s.dir, name+".json"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return b, err
+}
+
+func (s *fileCheckpointStore) Save(name string, b []byte) error {
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return err
+	}
+	path := filepath.Join(s.dir, name+".json")
+	// write and rename, so a crash never leaves a truncated checkpoint
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// configMapCheckpointStore keeps a ConfigMap per checkpoint, so the replica
+// taking over the leadership resumes where the previous leader stopped.
+type configMapCheckpointStore struct {
+	kc        kubernetes.Interface
+	namespace string
+	prefix    string
+	// limit is the largest compressed checkpoint saved.
+	limit int
+}
+
+// NewConfigMapCheckpointStore keeps the checkpoints in ConfigMaps of
+// namespace, named prefix-<checkpoint>.
+func NewConfigMapCheckpointStore(kc kubernetes.Interface, namespace, prefix string) CheckpointStore {
+	return &configMapCheckpointStore{kc: kc, namespace: namespace, prefix: prefix, limit: maxConfigMapCheckpoint}
+}
+
+var invalidConfigMapName = regexp.MustCompile(`[^a-z0-9.-]+`)
+
+// configMapName returns a valid object name for the checkpoint; cluster
+// and namespace names may hold upper case letters and underscores.
+func (s *configMapCheckpointStore) configMapName(name string) string {
+	name = invalidConfigMapName.ReplaceAllString(strings.ToLower(s.prefix+"-"+name), "-")
+	if len(name) > 253 {
+		name = name[:253]
+	}
+	return strings.Trim(name, "-.")
+}
+
+func (s *configMapCheckpointStore) Load(name string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), checkpointTimeout)
+	defer cancel()
+	cm, err := s.kc.CoreV1().ConfigMaps(s.namespace).Get(ctx, s.configMapName(name), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	data, ok := cm.BinaryData[checkpointKey]
+	if !ok {
+		return nil, nil
+	}
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// Save compresses the checkpoint, as the handled events of a busy cluster
+// would come close to the size limit of a ConfigMap, and returns
+// errCheckpointTooLarge when it is still over the limit.
+func (s *configMapCheckpointStore) Save(name string, b []byte) error {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(b); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	if buf.Len() > s.limit {
+		return errCheckpointTooLarge
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), checkpointTimeout)
+	defer cancel()
+	configMaps := s.kc.CoreV1().ConfigMaps(s.namespace)
+	cm, err := configMaps.Get(ctx, s.configMapName(name), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		cm = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      s.configMapName(name),
+				Namespace: s.namespace,
+				Labels:    map[string]string{checkpointLabel: "true"},
+			},
+			BinaryData: map[string][]byte{checkpointKey: buf.Bytes()},
+		}
+		_, err = configMaps.Create(ctx, cm, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if cm.BinaryData == nil {
+		cm.BinaryData = make(map[string][]byte)
+	}
+	cm.BinaryData[checkpointKey] = buf.Bytes()
+	_, err = configMaps.Update(ctx, cm, metav1.UpdateOptions{})
+	return err
+}
+
+// seededCheckpointStore loads a checkpoint missing from store from seed,
+// and saves to store only.
+type seededCheckpointStore struct {
+	store CheckpointStore
+	seed  CheckpointStore
+}
+
+// NewSeededCheckpointStore keeps the checkpoints in store, starting from
+// the ones of seed it does not have yet, e.g. the files of a replica that
+// moves to ConfigMap checkpoints. A nil seed returns store.
+func NewSeededCheckpointStore(store, seed CheckpointStore) CheckpointStore {
+	if seed == nil {
+		return store
+	}
+	return &seededCheckpointStore{store: store, seed: seed}
+}
+
+func (s *seededCheckpointStore) Load(name string) ([]byte, error) {
+	b, err := s.store.Load(name)
+	if err != nil || b != nil {
+		return b, err
+	}
+	return s.seed.Load(name)
+}
+
+func (s *seededCheckpointStore) Save(name string, b []byte) error {
+	return s.store.Save(name, b)
+}
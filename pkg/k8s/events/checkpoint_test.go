@@ -0,0 +1,208 @@
+package events
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestCheckpointWatermark(t *testing.T) {
+	checkpoint := loadEventCheckpoint(nil, "test")
+
+	first := checkpoint.Track("10", newCountedEvent("a", 1, ""))
+	second := checkpoint.Track("11", newCountedEvent("b", 1, ""))
+	bookmark := checkpoint.Track("12", nil)
+
+	// the later events are done first, the watermark waits for the first
+	second.Done()
+	bookmark.Done()
+	if rv := checkpoint.ResourceVersion(); rv != "" {
+		t.Errorf("\nexpected:\n%q\ngot:\n%q", "", rv)
+	}
+	first.Done()
+	if rv := checkpoint.ResourceVersion(); rv != "12" {
+		t.Errorf("\nexpected:\n%q\ngot:\n%q", "12", rv)
+	}
+
+	// listed events do not move the watermark
+	checkpoint.Track("", newCountedEvent("c", 1, "")).Done()
+	if rv := checkpoint.ResourceVersion(); rv != "12" {
+		t.Errorf("\nexpected:\n%q\ngot:\n%q", "12", rv)
+	}
+}
+
+func TestCheckpointSeen(t *testing.T) {
+	checkpoint := loadEventCheckpoint(nil, "test")
+
+	tracked := checkpoint.Track("10", newCountedEvent("a", 2, ""))
+	if checkpoint.Seen(newCountedEvent("a", 2, "")) {
+		t.Errorf("expected an event in flight not to be seen")
+	}
+	tracked.Done()
+	tracked.Done()
+
+	tests := []struct {
+		count    int32
+		expected bool
+	}{
+		{1, true},
+		{2, true},
+		{3, false},
+	}
+	for _, test := range tests {
+		if got := checkpoint.Seen(newCountedEvent("a", test.count, "")); got != test.expected {
+			t.Errorf("count %d:\nexpected:\n%v\ngot:\n%v", test.count, test.expected, got)
+		}
+	}
+}
+
+func TestCheckpointSkipped(t *testing.T) {
+	checkpoint := loadEventCheckpoint(nil, "test")
+
+	// a filtered event moves the watermark but is not recorded
+	checkpoint.Track("10", newCountedEvent("a", 1, "")).Skip()
+	if rv := checkpoint.ResourceVersion(); rv != "10" {
+		t.Errorf("\nexpected:\n%q\ngot:\n%q", "10", rv)
+	}
+	if checkpoint.Seen(newCountedEvent("a", 1, "")) || len(checkpoint.handled) != 0 {
+		t.Errorf("\nexpected:\n%v\ngot:\n%v", 0, len(checkpoint.handled))
+	}
+
+	// the handled UIDs are capped, the oldest forgotten first
+	now := time.Now()
+	for i := 0; i < maxHandledEvents+10; i++ {
+		uid := types.UID(strconv.Itoa(i))
+		checkpoint.handled[uid] = &handledEvent{Count: 1, Seen: now.Add(time.Duration(i) * time.Millisecond)}
+	}
+	checkpoint.forgetHandledLocked(now)
+	if len(checkpoint.handled) != maxHandledEvents {
+		t.Errorf("\nexpected:\n%v\ngot:\n%v", maxHandledEvents, len(checkpoint.handled))
+	}
+	if _, ok := checkpoint.handled["9"]; ok {
+		t.Errorf("expected the oldest handled event to be forgotten")
+	}
+	if _, ok := checkpoint.handled["10"]; !ok {
+		t.Errorf("expected the newer handled events to be kept")
+	}
+}
+
+func TestCheckpointSaveLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	checkpoint := loadEventCheckpoint(NewFileCheckpointStore(dir), "test")
+	checkpoint.Track("42", newCountedEvent("a", 3, "")).Done()
+	if err := checkpoint.Save(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	loaded := loadEventCheckpoint(NewFileCheckpointStore(dir), "test")
+	if rv := loaded.ResourceVersion(); rv != "42" {
+		t.Errorf("\nexpected:\n%q\ngot:\n%q", "42", rv)
+	}
+	if !loaded.Seen(newCountedEvent("a", 3, "")) {
+		t.Errorf("expected the handled event to survive a restart")
+	}
+	if other := loadEventCheckpoint(NewFileCheckpointStore(dir), "other"); other.ResourceVersion() != "" {
+		t.Errorf("expected no checkpoint for another cluster")
+	}
+}
+
+func TestCheckpointConfigMapHandover(t *testing.T) {
+	kc := fake.NewSimpleClientset()
+	// the leader saves, the replica taking over loads from the same ConfigMap
+	leader := loadEventCheckpoint(NewConfigMapCheckpointStore(kc, "ops", "event-mesh"), "Prod_kube-system")
+	leader.Track("42", newCountedEvent("a", 3, "")).Done()
+	if err := leader.Save(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	leader.Track("43", nil).Done()
+	if err := leader.Save(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := kc.CoreV1().ConfigMaps("ops").Get(context.TODO(), "event-mesh-prod-kube-system", metav1.GetOptions{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	next := loadEventCheckpoint(NewConfigMapCheckpointStore(kc, "ops", "event-mesh"), "Prod_kube-system")
+	if rv := next.ResourceVersion(); rv != "43" {
+		t.Errorf("\nexpected:\n%q\ngot:\n%q", "43", rv)
+	}
+	if !next.Seen(newCountedEvent("a", 3, "")) {
+		t.Errorf("expected the handled event to survive the handover")
+	}
+}
+
+func TestCheckpointSeededFromFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// a replica checkpointed to its files before moving to ConfigMaps
+	file := loadEventCheckpoint(NewFileCheckpointStore(dir), "prod")
+	file.Track("42", newCountedEvent("a", 3, "")).Done()
+	if err := file.Save(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	kc := fake.NewSimpleClientset()
+	store := NewSeededCheckpointStore(NewConfigMapCheckpointStore(kc, "ops", "event-mesh"), NewFileCheckpointStore(dir))
+	seeded := loadEventCheckpoint(store, "prod")
+	if rv := seeded.ResourceVersion(); rv != "42" {
+		t.Errorf("\nexpected:\n%q\ngot:\n%q", "42", rv)
+	}
+	seeded.Track("43", nil).Done()
+	if err := seeded.Save(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the ConfigMap wins once saved
+	next := loadEventCheckpoint(NewConfigMapCheckpointStore(kc, "ops", "event-mesh"), "prod")
+	if rv := next.ResourceVersion(); rv != "43" {
+		t.Errorf("\nexpected:\n%q\ngot:\n%q", "43", rv)
+	}
+	if rv := loadEventCheckpoint(store, "prod").ResourceVersion(); rv != "43" {
+		t.Errorf("\nexpected:\n%q\ngot:\n%q", "43", rv)
+	}
+}
+
+func TestCheckpointConfigMapTooLarge(t *testing.T) {
+	kc := fake.NewSimpleClientset()
+	store := &configMapCheckpointStore{kc: kc, namespace: "ops", prefix: "event-mesh", limit: 4096}
+	checkpoint := loadEventCheckpoint(store, "prod")
+	now := time.Now()
+	for i := 0; i < 1000; i++ {
+		uid := types.UID(fmt.Sprintf("%x", sha256.Sum256([]byte(strconv.Itoa(i)))))
+		checkpoint.handled[uid] = &handledEvent{Count: 1, Seen: now.Add(time.Duration(i) * time.Millisecond)}
+	}
+	newest := types.UID(fmt.Sprintf("%x", sha256.Sum256([]byte("999"))))
+	checkpoint.Track("42", nil).Done()
+	if err := checkpoint.Save(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the oldest handled events are forgotten until the checkpoint fits
+	next := loadEventCheckpoint(store, "prod")
+	if rv := next.ResourceVersion(); rv != "42" {
+		t.Errorf("\nexpected:\n%q\ngot:\n%q", "42", rv)
+	}
+	if n := len(next.handled); n == 0 || n >= 1000 {
+		t.Errorf("\nexpected:\n%v\ngot:\n%v", "fewer handled events", n)
+	}
+	if _, ok := next.handled[newest]; !ok {
+		t.Errorf("expected the newest handled event to be kept")
+	}
+}
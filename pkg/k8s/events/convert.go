@@ -0,0 +1,67 @@
+package events
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	eventsv1 "k8s.io/api/events/v1"
+	"time"
+)
+
+// EventsV1ToCore converts an events.k8s.io/v1 event to the core/v1 shape the
+// handlers work on, the way the apiserver serves it on the core API.
+func EventsV1ToCore(in *eventsv1.Event) *corev1.Event {
+	out := &corev1.Event{
+		ObjectMeta:          in.ObjectMeta,
+		InvolvedObject:      in.Regarding,
+		Related:             in.Related,
+		Reason:              in.Reason,
+		Message:             in.Note,
+		Type:                in.Type,
+		Action:              in.Action,
+		EventTime:           in.EventTime,
+		ReportingController: in.ReportingController,
+		ReportingInstance:   in.ReportingInstance,
+		Source:              in.DeprecatedSource,
+		FirstTimestamp:      in.DeprecatedFirstTimestamp,
+		LastTimestamp:       in.DeprecatedLastTimestamp,
+		Count:               in.DeprecatedCount,
+	}
+	if in.Series != nil {
+		out.Series = &corev1.EventSeries{
+			Count:            in.Series.Count,
+			LastObservedTime: in.Series.LastObservedTime,
+		}
+	}
+	// filter rules match components, which new style events only carry as
+	// the reporting controller
+	if len(out.Source.Component) == 0 {
+		out.Source.Component = in.ReportingController
+	}
+	return out
+}
+
+// eventCount is the number of occurrences of the event, from the series of
+// new style events or the deprecated count.
+func eventCount(event *corev1.Event) int32 {
+	count := event.Count
+	if event.Series != nil && event.Series.Count > count {
+		count = event.Series.Count
+	}
+	if count < 1 {
+		return 1
+	}
+	return count
+}
+
+// eventTime is when the event was last observed.
+func eventTime(event *corev1.Event) time.Time {
+	switch {
+	case event.Series != nil && !event.Series.LastObservedTime.IsZero():
+		return event.Series.LastObservedTime.Time
+	case !event.LastTimestamp.IsZero():
+		return event.LastTimestamp.Time
+	case !event.EventTime.IsZero():
+		return event.EventTime.Time
+	default:
+		return event.FirstTimestamp.Time
+	}
+}
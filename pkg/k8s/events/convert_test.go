@@ -0,0 +1,63 @@
+package events
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	eventsv1 "k8s.io/api/events/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"testing"
+	"time"
+)
+
+func TestEventsV1ToCore(t *testing.T) {
+	observed := time.Date(2021, 3, 3, 22, 0, 0, 0, time.UTC)
+	in := &eventsv1.Event{
+		ObjectMeta: metav1.ObjectMeta{Name: "pod.1", Namespace: "default", UID: "uid"},
+		Regarding:  corev1.ObjectReference{Kind: "Pod", Namespace: "default", Name: "pod"},
+		Related:    &corev1.ObjectReference{Kind: "Node", Name: "node-1"},
+		Reason:     "BackOff",
+		Note:       "Back-off restarting failed container",
+		Type:       "Warning",
+		Series: &eventsv1.EventSeries{
+			Count:            7,
+			LastObservedTime: metav1.NewMicroTime(observed),
+		},
+		ReportingController: "kubelet",
+		ReportingInstance:   "kubelet-node-1",
+		EventTime:           metav1.NewMicroTime(observed.Add(-time.Hour)),
+	}
+	out := EventsV1ToCore(in)
+
+	if out.InvolvedObject.Name != "pod" || out.Message != in.Note || out.UID != "uid" {
+		t.Errorf("unexpected event: %+v", out)
+	}
+	if out.Related == nil || out.Related.Name != "node-1" {
+		t.Errorf("\nexpected:\n%v\ngot:\n%v", in.Related, out.Related)
+	}
+	if out.Source.Component != "kubelet" || out.ReportingInstance != "kubelet-node-1" {
+		t.Errorf("unexpected reporter: %v %v", out.Source.Component, out.ReportingInstance)
+	}
+	if count := eventCount(out); count != 7 {
+		t.Errorf("\nexpected:\n%v\ngot:\n%v", 7, count)
+	}
+	if got := eventTime(out); !got.Equal(observed) {
+		t.Errorf("\nexpected:\n%v\ngot:\n%v", observed, got)
+	}
+}
+
+func TestEventTime(t *testing.T) {
+	first := time.Date(2021, 3, 3, 21, 0, 0, 0, time.UTC)
+	last := first.Add(time.Hour)
+	tests := []struct {
+		name     string
+		event    *corev1.Event
+		expected time.Time
+	}{
+		{"core", &corev1.Event{FirstTimestamp: metav1.NewTime(first), LastTimestamp: metav1.NewTime(last), Count: 3}, last},
+		{"event time", &corev1.Event{EventTime: metav1.NewMicroTime(first)}, first},
+	}
+	for _, test := range tests {
+		if got := eventTime(test.event); !got.Equal(test.expected) {
+			t.Errorf("%s:\nexpected:\n%v\ngot:\n%v", test.name, test.expected, got)
+		}
+	}
+}
@@ -0,0 +1,364 @@
+package events
+
+import (
+	"fmt"
+	"github.com/crain-cn/event-mesh/cmd/config"
+	"github.com/crain-cn/event-mesh/pkg/provider"
+	"github.com/prometheus/alertmanager/types"
+	common_model "github.com/prometheus/common/model"
+	corev1 "k8s.io/api/core/v1"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// countEvalInterval is how often the counts are compared to the
+	// thresholds. Firing count alerts are put again at every evaluation.
+	countEvalInterval = 15 * time.Second
+	// countAlertLifetimes is how many evaluations a count alert fires
+	// without being put again.
+	countAlertLifetimes = 4
+	countRuleRefresh    = time.Minute
+	countQueueSize      = 10000
+	defaultCountWindow  = 10 * time.Minute
+)
+
+// countLabels are the labels a count rule can group by.
+var countLabels = map[string]bool{
+	"cluster":          true,
+	"namespace":        true,
+	"obj_kind":         true,
+	"obj_name":         true,
+	"event_reason":     true,
+	"source_host":      true,
+	"source_component": true,
+	"workload_kind":    true,
+	"workload_name":    true,
+}
+
+type countRule struct {
+	name        string
+	match       *filterRule
+	groupBy     []string
+	workload    bool
+	threshold   int
+	window      time.Duration
+	forDuration time.Duration
+	severity    string
+	// reason is the event_reason of the alerts of a rule with one reason
+	reason string
+}
+
+func compileCountRule(in *config.CountRule) (*countRule, error) {
+	filter := in.FilterRule
+	filter.Action = config.FilterActionInclude
+	match, err := compileFilterRule(&filter)
+	if err != nil {
+		return nil, err
+	}
+	r := &countRule{
+		name:        in.Name,
+		match:       match,
+		groupBy:     append([]string(nil), in.GroupBy...),
+		threshold:   in.Threshold,
+		window:      in.Window,
+		forDuration: in.For,
+		severity:    in.Severity,
+	}
+	if len(r.name) == 0 {
+		return nil, fmt.Errorf("count rule without a name")
+	}
+	if r.threshold <= 0 {
+		return nil, fmt.Errorf("count rule %q: threshold %d", r.name, r.threshold)
+	}
+	if r.window <= 0 {
+		r.window = defaultCountWindow
+	}
+	switch r.severity {
+	case "":
+		r.severity = config.SeverityWarning
+	case config.SeverityCritical, config.SeverityWarning, config.SeverityInfo:
+	default:
+		return nil, fmt.Errorf("count rule %q: unknown severity %q", r.name, r.severity)
+	}
+	sort.Strings(r.groupBy)
+	for _, label := range r.groupBy {
+		if !countLabels[label] {
+			return nil, fmt.Errorf("count rule %q: can not group by %q", r.name, label)
+		}
+		r.workload = r.workload || label == "workload_kind" || label == "workload_name"
+	}
+	if len(in.Reasons) == 1 {
+		r.reason = in.Reasons[0]
+	}
+	return r, nil
+}
+
+// countSeries counts the events of a rule for one value of its labels.
+type countSeries struct {
+	rule   string
+	labels common_model.LabelSet
+	// seen are the event times within the window, oldest first
+	seen []time.Time
+	// pending is when the count went over the threshold, zero while it is
+	// not over it
+	pending time.Time
+	firing  *types.Alert
+}
+
+// eventCounter evaluates the count rules of a cluster over sliding windows
+// and puts their alerts into the alert provider. Events are counted apart
+// from the watch, as grouping by workload reads the owners.
+type eventCounter struct {
+	cluster  string
+	alerts   provider.Alerts
+	owners   *ownerResolver
+	mentions *ownerMentions
+	static   []*config.CountRule
+	// load reads the rules defined out of the config file, when set
+	load   func() ([]*config.CountRule, error)
+	events chan *corev1.Event
+
+	lock   sync.Mutex
+	rules  map[string]*countRule
+	series map[string]*countSeries
+}
+
+func newEventCounter(cluster string, alerts provider.Alerts, owners *ownerResolver, mentions *ownerMentions, static []*config.CountRule, load func() ([]*config.CountRule, error)) *eventCounter {
+	c := &eventCounter{
+		cluster:  cluster,
+		alerts:   alerts,
+		owners:   owners,
+		mentions: mentions,
+		static:   static,
+		load:     load,
+		events:   make(chan *corev1.Event, countQueueSize),
+		series:   make(map[string]*countSeries),
+	}
+	c.refresh()
+	return c
+}
+
+// refresh compiles the static rules and the loaded ones. Invalid rules are
+// left out; a failed load keeps the loaded rules.
+func (c *eventCounter) refresh() {
+	all := append([]*config.CountRule(nil), c.static...)
+	if c.load != nil {
+		loaded, err := c.load()
+		if err != nil {
+			log.WithError(err).Error("load count rules: ", c.cluster)
+			return
+		}
+		all = append(all, loaded...)
+	}
+	rules := make(map[string]*countRule, len(all))
+	for _, in := range all {
+		rule, err := compileCountRule(in)
+		if err != nil {
+			log.WithError(err).Error("invalid count rule: ", c.cluster)
+			continue
+		}
+		if _, ok := rules[rule.name]; ok {
+			log.Error("duplicate count rule: ", c.cluster, " ", rule.name)
+			continue
+		}
+		rules[rule.name] = rule
+	}
+	c.lock.Lock()
+	c.rules = rules
+	c.lock.Unlock()
+}
+
+// Observe hands the event to Run to be counted. It does not block the watch:
+// when Run falls behind the event is not counted.
+func (c *eventCounter) Observe(event *corev1.Event) {
+	if c == nil {
+		return
+	}
+	select {
+	case c.events <- event:
+	default:
+		countDropped.WithLabelValues(c.cluster).Inc()
+	}
+}
+
+// Run counts the events and evaluates the rules until stopCh is closed.
+func (c *eventCounter) Run(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(countEvalInterval)
+	defer ticker.Stop()
+	refresh := time.NewTicker(countRuleRefresh)
+	defer refresh.Stop()
+	for {
+		select {
+		case event := <-c.events:
+			c.count(event, eventTime(event))
+		case <-ticker.C:
+			c.evaluate(time.Now())
+		case <-refresh.C:
+			if c.load != nil {
+				c.refresh()
+			}
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+func (c *eventCounter) count(event *corev1.Event, at time.Time) {
+	c.lock.Lock()
+	rules := make([]*countRule, 0, len(c.rules))
+	for _, rule := range c.rules {
+		if rule.match.match(event) {
+			rules = append(rules, rule)
+		}
+	}
+	c.lock.Unlock()
+	if len(rules) == 0 {
+		return
+	}
+
+	var workload *Workload
+	for _, rule := range rules {
+		if rule.workload && workload == nil && c.owners != nil {
+			workload = c.owners.Resolve(&event.InvolvedObject)
+		}
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for _, rule := range rules {
+		labels := c.groupLabels(rule, event, workload)
+		key := rule.name + labels.String()
+		s, ok := c.series[key]
+		if !ok {
+			s = &countSeries{rule: rule.name, labels: labels}
+			c.series[key] = s
+		}
+		// events are mostly in order, a late one is put in its place
+		i := sort.Search(len(s.seen), func(i int) bool { return s.seen[i].After(at) })
+		s.seen = append(s.seen, time.Time{})
+		copy(s.seen[i+1:], s.seen[i:])
+		s.seen[i] = at
+	}
+}
+
+func (c *eventCounter) groupLabels(rule *countRule, event *corev1.Event, workload *Workload) common_model.LabelSet {
+	labels := common_model.LabelSet{}
+	for _, name := range rule.groupBy {
+		var value string
+		switch name {
+		case "cluster":
+			value = c.cluster
+		case "namespace":
+			value = event.InvolvedObject.Namespace
+		case "obj_kind":
+			value = event.InvolvedObject.Kind
+		case "obj_name":
+			value = event.InvolvedObject.Name
+		case "event_reason":
+			value = event.Reason
+		case "source_host":
+			value = event.Source.Host
+		case "source_component":
+			value = event.Source.Component
+		case "workload_kind":
+			if workload != nil {
+				value = workload.Kind
+			}
+		case "workload_name":
+			if workload != nil {
+				value = workload.Name
+			}
+		}
+		labels[common_model.LabelName(name)] = common_model.LabelValue(value)
+	}
+	return labels
+}
+
+// evaluate drops the events out of the windows and puts the alerts of the
+// series over their threshold for long enough. Series back under it are
+// resolved.
+func (c *eventCounter) evaluate(now time.Time) {
+	var alerts []*types.Alert
+	c.lock.Lock()
+	for key, s := range c.series {
+		rule, ok := c.rules[s.rule]
+		if ok {
+			i := sort.Search(len(s.seen), func(i int) bool { return now.Sub(s.seen[i]) <= rule.window })
+			s.seen = s.seen[i:]
+		}
+		if !ok || len(s.seen) <= rule.threshold {
+			s.pending = time.Time{}
+			if s.firing != nil {
+				resolved := *s.firing
+				resolved.EndsAt = now
+				resolved.UpdatedAt = now
+				alerts = append(alerts, &resolved)
+				s.firing = nil
+			}
+			if len(s.seen) == 0 || !ok {
+				delete(c.series, key)
+			}
+			continue
+		}
+		if s.pending.IsZero() {
+			s.pending = now
+		}
+		if now.Sub(s.pending) < rule.forDuration {
+			continue
+		}
+		s.firing = c.alert(rule, s, now)
+		alerts = append(alerts, s.firing)
+	}
+	c.lock.Unlock()
+
+	if len(alerts) == 0 {
+		return
+	}
+	if err := c.alerts.Put(alerts...); err != nil {
+		log.WithError(err).Error("put count alerts: ", c.cluster)
+	}
+}
+
+func (c *eventCounter) alert(rule *countRule, s *countSeries, now time.Time) *types.Alert {
+	labelSet := s.labels.Clone()
+	labelSet["cluster"] = common_model.LabelValue(c.cluster)
+	labelSet["count_rule"] = common_model.LabelValue(rule.name)
+	labelSet["severity"] = common_model.LabelValue(rule.severity)
+	labelSet["event_type"] = EVENT_TYPE_WARRNIGN
+	if _, ok := labelSet["event_reason"]; !ok && len(rule.reason) > 0 {
+		labelSet["event_reason"] = common_model.LabelValue(rule.reason)
+	}
+	if c.mentions != nil {
+		var workload *Workload
+		if name, ok := s.labels["workload_name"]; ok && len(name) > 0 {
+			workload = &Workload{Kind: string(s.labels["workload_kind"]), Name: string(name)}
+		}
+		if namespace, ok := s.labels["namespace"]; ok {
+			addOwnerLabels(labelSet, c.mentions, string(namespace), workload)
+		}
+	}
+
+	count := len(s.seen)
+	startsAt := s.pending
+	if s.firing != nil {
+		startsAt = s.firing.StartsAt
+	}
+	return &types.Alert{
+		Alert: common_model.Alert{
+			Labels: labelSet,
+			Annotations: common_model.LabelSet{
+				"message":    common_model.LabelValue(fmt.Sprintf("%d events in %s, more than %d", count, rule.window, rule.threshold)),
+				"count":      common_model.LabelValue(strconv.Itoa(count)),
+				"threshold":  common_model.LabelValue(strconv.Itoa(rule.threshold)),
+				"window":     common_model.LabelValue(rule.window.String()),
+				"first_seen": common_model.LabelValue(s.seen[0].Local().Format("2006-01-02 15:04:05")),
+				"last_seen":  common_model.LabelValue(s.seen[count-1].Local().Format("2006-01-02 15:04:05")),
+			},
+			StartsAt: startsAt,
+			EndsAt:   now.Add(countAlertLifetimes * countEvalInterval),
+		},
+		UpdatedAt: now,
+	}
+}
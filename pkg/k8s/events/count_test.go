@@ -0,0 +1,106 @@
+package events
+
+import (
+	"github.com/crain-cn/event-mesh/cmd/config"
+	common_model "github.com/prometheus/common/model"
+	"gopkg.in/yaml.v2"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"testing"
+	"time"
+)
+
+func TestEventCounter(t *testing.T) {
+	var rules []*config.CountRule
+	data := `
+- name: crashloop
+  reasons: [BackOff]
+  groupBy: [namespace, workload_name]
+  threshold: 5
+  window: 10m
+  severity: critical
+- name: mounts
+  reasons: [FailedMount]
+  groupBy: [namespace]
+  threshold: 2
+  window: 1h
+  for: 5m
+`
+	if err := yaml.Unmarshal([]byte(data), &rules); err != nil {
+		t.Fatal(err)
+	}
+	isController := true
+	kc := fake.NewSimpleClientset(
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name: "web-1", Namespace: "shop",
+			OwnerReferences: []metav1.OwnerReference{{Kind: "StatefulSet", Name: "web", Controller: &isController}},
+		}},
+		&appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "shop"}},
+	)
+	alerts := &putAlerts{}
+	c := newEventCounter("prod", alerts, newOwnerResolver(kc), nil, rules, nil)
+
+	now := time.Now()
+	for i := 0; i < 6; i++ {
+		c.count(newTestEvent("Warning", "BackOff", "kubelet", "Pod", "shop", "web-1", ""), now.Add(time.Duration(i-6)*time.Minute))
+	}
+	c.count(newTestEvent("Warning", "BackOff", "kubelet", "Pod", "blog", "post-1", ""), now)
+	c.evaluate(now)
+	if len(alerts.put) != 1 {
+		t.Fatalf("\nexpected:\n%v\ngot:\n%v", 1, len(alerts.put))
+	}
+	alert := alerts.put[0]
+	expected := common_model.LabelSet{
+		"cluster":       "prod",
+		"namespace":     "shop",
+		"workload_name": "web",
+		"count_rule":    "crashloop",
+		"severity":      config.SeverityCritical,
+		"event_type":    EVENT_TYPE_WARRNIGN,
+		"event_reason":  "BackOff",
+	}
+	if alert.Labels.String() != expected.String() {
+		t.Errorf("\nexpected:\n%v\ngot:\n%v", expected, alert.Labels)
+	}
+	if alert.Annotations["count"] != "6" || !alert.StartsAt.Equal(now) || !alert.EndsAt.After(now) {
+		t.Errorf("\nexpected:\n%v\ngot:\n%v %v - %v", "6 events firing from now", alert.Annotations, alert.StartsAt, alert.EndsAt)
+	}
+
+	// the oldest events slide out of the window and the alert resolves
+	alerts.put = nil
+	later := now.Add(5 * time.Minute)
+	c.evaluate(later)
+	if len(alerts.put) != 1 || !alerts.put[0].ResolvedAt(later) {
+		t.Errorf("\nexpected:\n%v\ngot:\n%v", "a resolved alert", alerts.put)
+	}
+
+	// over the threshold, but not for long enough yet
+	alerts.put = nil
+	for i := 0; i < 3; i++ {
+		c.count(newTestEvent("Warning", "FailedMount", "kubelet", "Pod", "shop", "web-1", ""), later)
+	}
+	c.evaluate(later)
+	if len(alerts.put) != 0 {
+		t.Errorf("\nexpected:\n%v\ngot:\n%v", 0, len(alerts.put))
+	}
+	c.evaluate(later.Add(5 * time.Minute))
+	if len(alerts.put) != 1 || alerts.put[0].Labels["count_rule"] != "mounts" || !alerts.put[0].StartsAt.Equal(later) {
+		t.Errorf("\nexpected:\n%v\ngot:\n%v", "the mounts alert pending since later", alerts.put)
+	}
+}
+
+func TestCompileCountRule(t *testing.T) {
+	invalid := []*config.CountRule{
+		{FilterRule: config.FilterRule{Name: "no-threshold"}},
+		{FilterRule: config.FilterRule{Name: "label"}, Threshold: 1, GroupBy: []string{"pod_ip"}},
+		{FilterRule: config.FilterRule{Name: "severity"}, Threshold: 1, Severity: "page"},
+		{Threshold: 1},
+	}
+	for _, rule := range invalid {
+		if _, err := compileCountRule(rule); err == nil {
+			t.Errorf("%s:\nexpected:\nan error\ngot:\n%v", rule.Name, err)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"github.com/crain-cn/event-mesh/cmd/config"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	diagnoseTimeout = 5 * time.Second
+	// maxLogReadBytes bounds what is read from the apiserver before the tail
+	// is redacted and cut down to MaxBytes.
+	maxLogReadBytes = 64 * 1024
+	redacted        = "***"
+)
+
+// containerFieldPath matches the fieldPath kubelet sets on container events,
+// e.g. spec.containers{app}.
+var containerFieldPath = regexp.MustCompile(`^spec\.(?:initContainers|containers|ephemeralContainers)\{(.+)\}$`)
+
+// logRedactor masks a match, keeping the text of group 1 when the pattern has
+// one, e.g. the "password=" before the password.
+type logRedactor struct {
+	re   *regexp.Regexp
+	repl string
+}
+
+var defaultLogRedactors = []*logRedactor{
+	{regexp.MustCompile(`(?i)((?:password|passwd|pwd|secret|token|api[_-]?key|access[_-]?key|private[_-]?key|authorization)["']?\s*[:=]\s*["']?(?:bearer\s+)?)[^\s"',;&]+`), "${1}" + redacted},
+	{regexp.MustCompile(`(?i)(bearer\s+)[a-z0-9\-._~+/]+=*`), "${1}" + redacted},
+	{regexp.MustCompile(`(://[^:/@\s]+:)[^@/\s]+@`), "${1}" + redacted + "@"},
+	{regexp.MustCompile(`\b(AKIA)[0-9A-Z]{16}\b`), "${1}" + redacted},
+}
+
+// diagnoser reads what on-call looks at first for a crashing pod: the state of
+// the container and the tail of its previous log.
+type diagnoser struct {
+	kc        kubernetes.Interface
+	opt       *config.EventDiagnosticsOpt
+	reasons   map[string]bool
+	redactors []*logRedactor
+}
+
+func newDiagnoser(kc kubernetes.Interface, opt *config.EventDiagnosticsOpt) *diagnoser {
+	d := &diagnoser{
+		kc:        kc,
+		opt:       opt,
+		reasons:   make(map[string]bool),
+		redactors: append([]*logRedactor(nil), defaultLogRedactors...),
+	}
+	for _, reason := range opt.Reasons {
+		d.reasons[reason] = true
+	}
+	for _, expr := range opt.Redact {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			log.WithError(err).Error("invalid log redaction regex: ", expr)
+			continue
+		}
+		d.redactors = append(d.redactors, &logRedactor{re: re, repl: redacted})
+	}
+	return d
+}
+
+// Diagnose returns the annotations for a pod event with one of the configured
+// reasons, or nil. Lookups that fail leave their annotations out.
+func (d *diagnoser) Diagnose(event *corev1.Event) map[string]string {
+	ref := event.InvolvedObject
+	if ref.Kind != "Pod" || !d.reasons[event.Reason] {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), diagnoseTimeout)
+	defer cancel()
+	pod, err := d.kc.CoreV1().Pods(ref.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil
+	}
+	status := crashedContainer(pod, ref.FieldPath)
+	if status == nil {
+		return nil
+	}
+
+	annotations := map[string]string{
+		"container":     status.Name,
+		"restart_count": fmt.Sprintf("%d", status.RestartCount),
+	}
+	terminated := status.LastTerminationState.Terminated
+	previous := terminated != nil
+	if terminated == nil {
+		terminated = status.State.Terminated
+	}
+	if terminated != nil {
+		annotations["exit_code"] = fmt.Sprintf("%d", terminated.ExitCode)
+		annotations["exit_reason"] = terminated.Reason
+	}
+	if waiting := status.State.Waiting; waiting != nil {
+		annotations["container_state"] = waiting.Reason
+	}
+
+	tailLines, limitBytes := d.opt.TailLines, int64(maxLogReadBytes)
+	raw, err := d.kc.CoreV1().Pods(ref.Namespace).GetLogs(ref.Name, &corev1.PodLogOptions{
+		Container:  status.Name,
+		Previous:   previous,
+		TailLines:  &tailLines,
+		LimitBytes: &limitBytes,
+	}).DoRaw(ctx)
+	if err == nil && len(raw) > 0 {
+		annotations["log_tail"] = tailBytes(d.redact(string(raw)), d.opt.MaxBytes)
+	}
+	return annotations
+}
+
+func (d *diagnoser) redact(s string) string {
+	for _, r := range d.redactors {
+		s = r.re.ReplaceAllString(s, r.repl)
+	}
+	return s
+}
+
+// crashedContainer returns the status of the container named by the event
+// fieldPath, or else the container that restarted most.
+func crashedContainer(pod *corev1.Pod, fieldPath string) *corev1.ContainerStatus {
+	statuses := make([]corev1.ContainerStatus, 0, len(pod.Status.InitContainerStatuses)+len(pod.Status.ContainerStatuses))
+	statuses = append(statuses, pod.Status.InitContainerStatuses...)
+	statuses = append(statuses, pod.Status.ContainerStatuses...)
+
+	if m := containerFieldPath.FindStringSubmatch(fieldPath); m != nil {
+		for i := range statuses {
+			if statuses[i].Name == m[1] {
+				return &statuses[i]
+			}
+		}
+	}
+	var crashed *corev1.ContainerStatus
+	for i := range statuses {
+		if crashed == nil || statuses[i].RestartCount > crashed.RestartCount {
+			crashed = &statuses[i]
+		}
+	}
+	return crashed
+}
+
+// tailBytes keeps at most the last max bytes of s and marks the cut. The kept
+// part starts on a line when it holds more than one.
+func tailBytes(s string, max int) string {
+	s = strings.TrimRight(s, "\n")
+	if len(s) <= max {
+		return s
+	}
+	s = s[len(s)-max:]
+	if i := strings.IndexByte(s, '\n'); i >= 0 && i < len(s)-1 {
+		s = s[i+1:]
+	}
+	for len(s) > 0 && !utf8.RuneStart(s[0]) {
+		s = s[1:]
+	}
+	return "...\n" + s
+}
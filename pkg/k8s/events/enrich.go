@@ -0,0 +1,148 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"github.com/crain-cn/event-mesh/cmd/config"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"regexp"
+)
+
+// labelNameInvalid matches the characters not allowed in alert label names.
+var labelNameInvalid = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+func enrichLabelName(key string) string {
+	name := labelNameInvalid.ReplaceAllString(key, "_")
+	if len(name) > 0 && name[0] >= '0' && name[0] <= '9' {
+		name = "_" + name
+	}
+	return name
+}
+
+// enricher copies allowlisted labels and annotations of the objects around an
+// event into alert labels. Lookups are cached, so busy objects do not cost an
+// apiserver request per event.
+type enricher struct {
+	kc    kubernetes.Interface
+	opt   *config.EventEnrichmentOpt
+	cache *ttlCache
+}
+
+// enrichedObject is what the cache keeps of an object: the allowlisted
+// metadata, already named as alert labels, and the node of a pod.
+type enrichedObject struct {
+	labels   map[string]string
+	nodeName string
+}
+
+func newEnricher(kc kubernetes.Interface, opt *config.EventEnrichmentOpt) *enricher {
+	return &enricher{
+		kc:    kc,
+		opt:   opt,
+		cache: newTTLCache(opt.CacheTTL),
+	}
+}
+
+func (e *enricher) Run(stopCh <-chan struct{}) {
+	e.cache.Run(stopCh)
+}
+
+// Enrich returns the labels for the event. A label found on a more specific
+// object is not overwritten by the same label of a less specific one.
+func (e *enricher) Enrich(event *corev1.Event, workload *Workload) map[string]string {
+	ctx, cancel := context.WithTimeout(context.Background(), ownerTimeout)
+	defer cancel()
+
+	labels := make(map[string]string)
+	add := func(o *enrichedObject) {
+		if o == nil {
+			return
+		}
+		for name, value := range o.labels {
+			if _, ok := labels[name]; !ok {
+				labels[name] = value
+			}
+		}
+	}
+
+	ref := event.InvolvedObject
+	nodeName := event.Source.Host
+	if ref.Kind == "Node" {
+		nodeName = ref.Name
+	}
+	// the pod is read for its node even when its own metadata is not copied
+	if e.opt.Object != nil || (ref.Kind == "Pod" && e.opt.Node != nil) {
+		o := e.lookup(ctx, "object", e.opt.Object, ref.Kind, ref.Namespace, ref.Name)
+		add(o)
+		if o != nil && len(o.nodeName) > 0 {
+			nodeName = o.nodeName
+		}
+	}
+	if e.opt.Workload != nil && workload != nil && (workload.Kind != ref.Kind || workload.Name != ref.Name) {
+		add(e.lookup(ctx, "workload", e.opt.Workload, workload.Kind, ref.Namespace, workload.Name))
+	}
+	if e.opt.Namespace != nil && len(ref.Namespace) > 0 {
+		add(e.lookup(ctx, "namespace", e.opt.Namespace, "Namespace", "", ref.Namespace))
+	}
+	if e.opt.Node != nil && len(nodeName) > 0 {
+		add(e.lookup(ctx, "node", e.opt.Node, "Node", "", nodeName))
+	}
+	return labels
+}
+
+func (e *enricher) lookup(ctx context.Context, role string, src *config.EnrichmentSource, kind, namespace, name string) *enrichedObject {
+	key := role + "/" + kind + "/" + namespace + "/" + name
+	if v, ok := e.cache.Get(key); ok {
+		return v.(*enrichedObject)
+	}
+	var o *enrichedObject
+	obj, err := getObjectMeta(ctx, e.kc, kind, namespace, name)
+	if err == nil {
+		o = extractEnrichment(obj, src)
+	}
+	e.cache.Set(key, o)
+	return o
+}
+
+func extractEnrichment(obj metav1.Object, src *config.EnrichmentSource) *enrichedObject {
+	o := &enrichedObject{
+		labels: make(map[string]string),
+	}
+	if pod, ok := obj.(*corev1.Pod); ok {
+		o.nodeName = pod.Spec.NodeName
+	}
+	if src == nil {
+		return o
+	}
+	copyKeys := func(from map[string]string, keys []string) {
+		for _, key := range keys {
+			name := enrichLabelName(key)
+			if _, ok := o.labels[name]; ok {
+				continue
+			}
+			if value, ok := from[key]; ok {
+				o.labels[name] = value
+			}
+		}
+	}
+	copyKeys(obj.GetLabels(), src.Labels)
+	copyKeys(obj.GetAnnotations(), src.Annotations)
+	return o
+}
+
+// getObjectMeta reads the kinds events are commonly about, their workloads,
+// namespaces and nodes.
+func getObjectMeta(ctx context.Context, kc kubernetes.Interface, kind, namespace, name string) (metav1.Object, error) {
+	switch kind {
+	case "Node":
+		return kc.CoreV1().Nodes().Get(ctx, name, metav1.GetOptions{})
+	case "Namespace":
+		return kc.CoreV1().Namespaces().Get(ctx, name, metav1.GetOptions{})
+	}
+	if get, ok := ownerGetters[kind]; ok {
+		return get(ctx, kc, namespace, name)
+	}
+	return nil, fmt.Errorf("unsupported kind %q", kind)
+}
@@ -0,0 +1,80 @@
+package events
+
+import (
+	"github.com/crain-cn/event-mesh/cmd/config"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"reflect"
+	"testing"
+)
+
+func TestEnrichLabelName(t *testing.T) {
+	tests := map[string]string{
+		"team":                   "team",
+		"app.kubernetes.io/name": "app_kubernetes_io_name",
+		"9lives":                 "_9lives",
+	}
+	for key, expected := range tests {
+		if got := enrichLabelName(key); got != expected {
+			t.Errorf("%s:\nexpected:\n%v\ngot:\n%v", key, expected, got)
+		}
+	}
+}
+
+func TestEnricher(t *testing.T) {
+	kc := fake.NewSimpleClientset(
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "web-5d4f8-abcde", Namespace: "default", Labels: map[string]string{"team": "pod-team", "version": "v2"}},
+			Spec:       corev1.PodSpec{NodeName: "node-1"},
+		},
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", Labels: map[string]string{"team": "web-team", "tier": "frontend"}},
+		},
+		&corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{Name: "default", Annotations: map[string]string{"example.com/owner": "ops"}},
+		},
+		&corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "node-1", Labels: map[string]string{"topology.kubernetes.io/zone": "zone-a"}},
+		},
+	)
+	e := newEnricher(kc, &config.EventEnrichmentOpt{
+		Object:    &config.EnrichmentSource{Labels: []string{"team", "version"}},
+		Workload:  &config.EnrichmentSource{Labels: []string{"team", "tier"}},
+		Namespace: &config.EnrichmentSource{Annotations: []string{"example.com/owner"}},
+		Node:      &config.EnrichmentSource{Labels: []string{"topology.kubernetes.io/zone"}},
+		CacheTTL:  config.DefaultEnrichmentCacheTTL,
+	})
+
+	event := &corev1.Event{
+		InvolvedObject: corev1.ObjectReference{Kind: "Pod", Namespace: "default", Name: "web-5d4f8-abcde"},
+	}
+	expected := map[string]string{
+		// the pod wins over its deployment
+		"team":                        "pod-team",
+		"version":                     "v2",
+		"tier":                        "frontend",
+		"example_com_owner":           "ops",
+		"topology_kubernetes_io_zone": "zone-a",
+	}
+	got := e.Enrich(event, &Workload{Kind: "Deployment", Name: "web"})
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("\nexpected:\n%v\ngot:\n%v", expected, got)
+	}
+
+	// a deleted pod still gets the labels of its namespace and of the node
+	// that reported it
+	event = &corev1.Event{
+		InvolvedObject: corev1.ObjectReference{Kind: "Pod", Namespace: "default", Name: "gone"},
+		Source:         corev1.EventSource{Host: "node-1"},
+	}
+	expected = map[string]string{
+		"example_com_owner":           "ops",
+		"topology_kubernetes_io_zone": "zone-a",
+	}
+	got = e.Enrich(event, nil)
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("\nexpected:\n%v\ngot:\n%v", expected, got)
+	}
+}
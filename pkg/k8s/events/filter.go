@@ -1,165 +1,264 @@
 package events
 
 import (
-	"github.com/linvon/cuckoo-filter"
+	"fmt"
+	"github.com/crain-cn/event-mesh/cmd/config"
 	v1 "k8s.io/api/core/v1"
+	"regexp"
+	"sort"
 	"time"
 )
 
-var (
-	filterNormalResons = FilterList{
-		"SuccessfulCreate",
-		"Pulled",
-		"Created",
-		"Started",
-		"Scheduled",
-		"Pulling",
-		"SuccessfulDelete",
-		"SawCompletedJob",
-		"SandboxChanged",
-		"Provisioning",
-		"SuccessfulAttachVolume",
-		"ProvisioningSucceeded",
-		"ExternalProvisioning",
-		"NodeReady",
-	}
-	filterWarnningResons = FilterList{
-		"PipelineRunFailed",
-	}
-	notFilterNormalResons = FilterList{
-		"TaintManagerEviction",
-		"ScalingReplicaSet",
-		"Killing",
-		"BackOff",
-		"NodeNotReady",
-	}
-	notFilterWarnningResons = FilterList{
-		"FailedScheduling",
-		"FailedMount",
-		"FailedCreatePodSandBox",
-		"DeadlineExceeded",
-		"Failed",
-		"BackoffLimitExceeded",
-		"BackOff",
-		"Unhealthy",
-		"FailedComputeMetricsReplicas",
-		"FailedGetResourceMetric",
-		"FailedCreatePodContainer",
-		"FailedGetScale",
-		"FailedSync",
-		"FailedToUpdateEndpoint",
-	}
-	filterComponents = FilterList{
-		//"job-controller",
-		//"cronjob-controller",
-		"pipeline-controller",
-		"taskrun-controller",
+// DefaultFilterRules are used when the config file does not define
+// eventFilterRules. The events of the noisy components are excluded first,
+// whatever their reason; then the reasons worth alerting on are included
+// before the noisy lifecycle reasons are excluded.
+var DefaultFilterRules = []*config.FilterRule{
+	{
+		Name:   "default-drop-components",
+		Action: config.FilterActionExclude,
+		Components: []string{
+			"pipeline-controller",
+			"taskrun-controller",
+		},
+	},
+	{
+		Name:   "default-keep-reasons",
+		Action: config.FilterActionInclude,
+		Reasons: []string{
+			"TaintManagerEviction",
+			"ScalingReplicaSet",
+			"Killing",
+			"BackOff",
+			"NodeNotReady",
+			"FailedScheduling",
+			"FailedMount",
+			"FailedCreatePodSandBox",
+			"DeadlineExceeded",
+			"Failed",
+			"BackoffLimitExceeded",
+			"Unhealthy",
+			"FailedComputeMetricsReplicas",
+			"FailedGetResourceMetric",
+			"FailedCreatePodContainer",
+			"FailedGetScale",
+			"FailedSync",
+			"FailedToUpdateEndpoint",
+		},
+	},
+	{
+		Name:   "default-drop-reasons",
+		Action: config.FilterActionExclude,
+		Reasons: []string{
+			"SuccessfulCreate",
+			"Pulled",
+			"Created",
+			"Started",
+			"Scheduled",
+			"Pulling",
+			"SuccessfulDelete",
+			"SawCompletedJob",
+			"SandboxChanged",
+			"Provisioning",
+			"SuccessfulAttachVolume",
+			"ProvisioningSucceeded",
+			"ExternalProvisioning",
+			"NodeReady",
+			"PipelineRunFailed",
+		},
+	},
+}
+
+type stringSet map[string]struct{}
+
+func newStringSet(items []string) stringSet {
+	if len(items) == 0 {
+		return nil
 	}
-)
+	set := make(stringSet, len(items))
+	for _, item := range items {
+		set[item] = struct{}{}
+	}
+	return set
+}
 
-const DefaultFilterCount = 2
+// match reports whether v is in the set. An empty set matches everything.
+func (s stringSet) match(v string) bool {
+	if s == nil {
+		return true
+	}
+	_, ok := s[v]
+	return ok
+}
 
-type FilterList []string
-type eventFilter struct {
-	cf         *cuckoo.Filter
-	filters    map[string]FilterList
-	notFilters map[string]FilterList
-	startTime  time.Time
+// has reports whether v is in the set. An empty set has nothing.
+func (s stringSet) has(v string) bool {
+	_, ok := s[v]
+	return ok
 }
 
-func NewEventFilter(startTime time.Time, filterList FilterList, notFilterList FilterList) *eventFilter {
-	defaultFilterList := map[string]FilterList{
-		"Components": filterComponents,
-		"Warnning":   filterWarnningResons,
-		"Normal":     filterNormalResons,
+type filterRule struct {
+	name           string
+	include        bool
+	types          stringSet
+	reasons        stringSet
+	components     stringSet
+	kinds          stringSet
+	namespaces     stringSet
+	nameRegex      *regexp.Regexp
+	namespaceRegex *regexp.Regexp
+	messageRegex   *regexp.Regexp
+}
+
+func compileFilterRule(in *config.FilterRule) (*filterRule, error) {
+	r := &filterRule{
+		name:       in.Name,
+		types:      newStringSet(in.Types),
+		reasons:    newStringSet(in.Reasons),
+		components: newStringSet(in.Components),
+		kinds:      newStringSet(in.Kinds),
+		namespaces: newStringSet(in.Namespaces),
 	}
-	defaultNotFilterList := map[string]FilterList{
-		"Warnning": notFilterWarnningResons,
-		"Normal":   notFilterNormalResons,
+	switch in.Action {
+	case config.FilterActionInclude:
+		r.include = true
+	case config.FilterActionExclude:
+	default:
+		return nil, fmt.Errorf("filter rule %q: invalid action %q", in.Name, in.Action)
 	}
 
-	cf := cuckoo.NewFilter(1, 9, 10, cuckoo.TableTypePacked)
-	eventFilter := &eventFilter{
-		cf:         cf,
-		filters:    defaultFilterList,
-		notFilters: defaultNotFilterList,
-		startTime:  startTime,
+	var err error
+	if r.nameRegex, err = compileRuleRegex(in.Name, in.NameRegex, true); err != nil {
+		return nil, err
 	}
-	eventFilter.InitDefault()
-	eventFilter.AppendFilterList(filterList)
-	eventFilter.AppendNotFilterList(notFilterList)
-	return eventFilter
-}
-
-func ToFilterList(filters []string) FilterList {
-	var list FilterList
-	for _, filter := range filters {
-		list = append(list, filter)
+	if r.namespaceRegex, err = compileRuleRegex(in.Name, in.NamespaceRegex, true); err != nil {
+		return nil, err
 	}
-	return list
+	// Messages are free text, so the expression is not anchored.
+	if r.messageRegex, err = compileRuleRegex(in.Name, in.MessageRegex, false); err != nil {
+		return nil, err
+	}
+	return r, nil
 }
 
-func (f *eventFilter) InitDefault() {
-	for _, filterList := range f.filters {
-		for _, filter := range filterList {
-			f.cf.AddUnique([]byte(filter))
-		}
+func compileRuleRegex(rule, expr string, anchored bool) (*regexp.Regexp, error) {
+	if len(expr) == 0 {
+		return nil, nil
 	}
-	for _, filterList := range f.notFilters {
-		for _, notFilter := range filterList {
-			f.cf.Delete([]byte(notFilter))
-		}
+	if anchored {
+		expr = "^(?:" + expr + ")$"
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("filter rule %q: %v", rule, err)
 	}
+	return re, nil
 }
 
-func (f *eventFilter) AppendFilterList(filterList FilterList) {
-	for _, filter := range filterList {
-		f.cf.AddUnique([]byte(filter))
-	}
+func (r *filterRule) match(event *v1.Event) bool {
+	obj := event.InvolvedObject
+	return r.types.match(event.Type) &&
+		r.reasons.match(event.Reason) &&
+		r.components.match(event.Source.Component) &&
+		r.kinds.match(obj.Kind) &&
+		r.namespaces.match(obj.Namespace) &&
+		(r.nameRegex == nil || r.nameRegex.MatchString(obj.Name)) &&
+		(r.namespaceRegex == nil || r.namespaceRegex.MatchString(obj.Namespace)) &&
+		(r.messageRegex == nil || r.messageRegex.MatchString(event.Message))
 }
 
-func (f *eventFilter) AppendNotFilterList(filterList FilterList) {
-	for _, notFilter := range filterList {
-		f.cf.Delete([]byte(notFilter))
-	}
+type eventFilter struct {
+	rules     []*filterRule
+	startTime time.Time
 }
 
-func (f *eventFilter) Filter(event *v1.Event) bool {
-	if f.filterTime(event) {
-		return true
+// NewEventFilter compiles rules in order. Events matching no rule are kept.
+func NewEventFilter(startTime time.Time, rules []*config.FilterRule) (*eventFilter, error) {
+	f := &eventFilter{
+		startTime: startTime,
 	}
-	if f.filterComponent(event.Source.Component) {
-		return true
+	for _, in := range rules {
+		r, err := compileFilterRule(in)
+		if err != nil {
+			return nil, err
+		}
+		f.rules = append(f.rules, r)
 	}
+	return f, nil
+}
 
-	//if f.filterCount(event.Count) {
-	//	return true
-	//}
+// FilterRulesFor returns the cluster's rules followed by the global rules,
+// or by DefaultFilterRules when no global rules are configured.
+func FilterRulesFor(configResolver *config.ConfigResolver, cluster string) []*config.FilterRule {
+	rules := configResolver.GetEventFilterRules(cluster)
+	if len(configResolver.EventFilterRules) > 0 {
+		return append(rules, configResolver.EventFilterRules...)
+	}
+	return append(rules, DefaultFilterRules...)
+}
 
-	return f.filterReason(event.Reason)
+// watchScope derives what the watch can leave out without changing what the
+// rules keep. When a catch-all exclude rule ends the rules, nothing outside
+// the namespaces and types of the include rules before it is kept.
+func watchScope(rules []*config.FilterRule) (namespaces []string, eventType string) {
+	nsSet := make(map[string]struct{})
+	typeSet := make(map[string]struct{})
+	nsLimited, typeLimited := true, true
+	for _, r := range rules {
+		if r.Action == config.FilterActionInclude {
+			nsLimited = nsLimited && len(r.Namespaces) > 0
+			typeLimited = typeLimited && len(r.Types) > 0
+			for _, ns := range r.Namespaces {
+				nsSet[ns] = struct{}{}
+			}
+			for _, t := range r.Types {
+				typeSet[t] = struct{}{}
+			}
+			continue
+		}
+		if !isCatchAll(r) {
+			continue
+		}
+		if nsLimited {
+			for ns := range nsSet {
+				namespaces = append(namespaces, ns)
+			}
+			sort.Strings(namespaces)
+		}
+		if typeLimited && len(typeSet) == 1 {
+			for t := range typeSet {
+				eventType = t
+			}
+		}
+		return namespaces, eventType
+	}
+	return nil, ""
 }
 
-func (f *eventFilter) filterComponent(component string) bool {
-	return f.cf.Contain([]byte(component))
+func isCatchAll(r *config.FilterRule) bool {
+	return len(r.Types) == 0 && len(r.Reasons) == 0 && len(r.Components) == 0 &&
+		len(r.Kinds) == 0 && len(r.Namespaces) == 0 &&
+		len(r.NameRegex) == 0 && len(r.NamespaceRegex) == 0 && len(r.MessageRegex) == 0
 }
 
-func (f *eventFilter) filterReason(Reason string) bool {
-	return f.cf.Contain([]byte(Reason))
+// Filter reports whether the rules drop the event.
+func (f *eventFilter) Filter(event *v1.Event) bool {
+	return !f.include(event)
 }
 
-func (f *eventFilter) filterTime(event *v1.Event) bool {
-	if !event.FirstTimestamp.Time.IsZero() && f.startTime.After(event.LastTimestamp.Time) {
-		return true
-	}
-	if !event.EventTime.Time.IsZero() && f.startTime.After(event.EventTime.Time) {
-		return true
+// include returns the action of the first matching rule.
+func (f *eventFilter) include(event *v1.Event) bool {
+	for _, r := range f.rules {
+		if r.match(event) {
+			return r.include
+		}
 	}
-	return false
+	return true
 }
 
-func (f *eventFilter) filterCount(count int32) bool {
-	if count >= DefaultFilterCount {
-		return true
-	}
-	return false
+// filterTime reports whether the event happened before startTime. It only
+// applies to the first list of a cluster, which has no checkpoint yet.
+func (f *eventFilter) filterTime(event *v1.Event) bool {
+	t := eventTime(event)
+	return !t.IsZero() && f.startTime.After(t)
 }
@@ -1,53 +1,204 @@
 package events
 
 import (
+	"fmt"
+	"github.com/crain-cn/event-mesh/cmd/config"
+	v1 "k8s.io/api/core/v1"
 	"testing"
 	"time"
 )
 
+func newTestEvent(eventType, reason, component, kind, namespace, name, message string) *v1.Event {
+	return &v1.Event{
+		Type:    eventType,
+		Reason:  reason,
+		Message: message,
+		Source:  v1.EventSource{Component: component},
+		InvolvedObject: v1.ObjectReference{
+			Kind:      kind,
+			Namespace: namespace,
+			Name:      name,
+		},
+	}
+}
+
+func newTestFilter(t *testing.T, rules []*config.FilterRule) *eventFilter {
+	eventFilter, err := NewEventFilter(time.Now(), rules)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return eventFilter
+}
+
 func TestFilter(t *testing.T) {
-	filterLists := FilterList{
-		"cronjob-controller",
-		"job-controller",
+	configResolver := &config.ConfigResolver{
+		EventSinks: []*config.EventSinks{
+			{
+				Cluster: "test",
+				Filters: []string{"cronjob-controller", "job-controller"},
+			},
+		},
 	}
-	notFilterLists := FilterList{}
-	eventFilter := NewEventFilter(time.Now(), filterLists, notFilterLists)
-	expected1 := true
-	filter1Result := eventFilter.filterComponent("cronjob-controller")
+	eventFilter := newTestFilter(t, FilterRulesFor(configResolver, "test"))
+	expected1 := false
+	filter1Result := eventFilter.include(newTestEvent("Normal", "Completed", "cronjob-controller", "Job", "default", "job", ""))
 	if filter1Result != expected1 {
 		t.Errorf("\nexpected:\n%v\ngot:\n%v", expected1, filter1Result)
 	}
-	expected2 := true
-	filter2Result := eventFilter.filterComponent("job-controller")
+	expected2 := false
+	filter2Result := eventFilter.include(newTestEvent("Normal", "Completed", "job-controller", "Job", "default", "job", ""))
 	if filter2Result != expected2 {
 		t.Errorf("\nexpected:\n%v\ngot:\n%v", expected2, filter2Result)
 	}
-	expected3 := false
-	filter3Result := eventFilter.filterComponent("cronjob1-controller")
+	expected3 := true
+	filter3Result := eventFilter.include(newTestEvent("Normal", "Completed", "cronjob1-controller", "Job", "default", "job", ""))
 	if filter3Result != expected3 {
 		t.Errorf("\nexpected:\n%v\ngot:\n%v", expected3, filter3Result)
 	}
 }
 
 func TestKillingFilter(t *testing.T) {
-	filterLists := FilterList{
-		"SuccessfulCreate",
-	}
-	notFilterLists := FilterList{
-		"Killing",
+	configResolver := &config.ConfigResolver{
+		EventSinks: []*config.EventSinks{
+			{
+				Cluster:    "test",
+				Filters:    []string{"SuccessfulCreate"},
+				NotFilters: []string{"Killing"},
+			},
+		},
 	}
-
-	eventFilter := NewEventFilter(time.Now(), filterLists, notFilterLists)
-	expected1 := false
-	filter1Result := eventFilter.filterReason("Killing")
+	eventFilter := newTestFilter(t, FilterRulesFor(configResolver, "test"))
+	expected1 := true
+	filter1Result := eventFilter.include(newTestEvent("Normal", "Killing", "kubelet", "Pod", "default", "pod", ""))
 	if filter1Result != expected1 {
 		t.Errorf("\nexpected:\n%v\ngot:\n%v", expected1, filter1Result)
 	}
 
-	expected2 := true
-	filter2Result := eventFilter.filterReason("SuccessfulCreate")
+	expected2 := false
+	filter2Result := eventFilter.include(newTestEvent("Normal", "SuccessfulCreate", "replicaset-controller", "ReplicaSet", "default", "rs", ""))
 	if filter2Result != expected2 {
-		t.Errorf("\nexpected:\n%v\ngot:\n%v", expected1, filter1Result)
+		t.Errorf("\nexpected:\n%v\ngot:\n%v", expected2, filter2Result)
 	}
+}
+
+func TestFilterRulePrecedence(t *testing.T) {
+	rules := []*config.FilterRule{
+		{Name: "keep-prod-backoff", Action: config.FilterActionInclude, Reasons: []string{"BackOff"}, NamespaceRegex: "prod-.*"},
+		{Name: "drop-backoff", Action: config.FilterActionExclude, Reasons: []string{"BackOff"}},
+		{Name: "drop-probe-noise", Action: config.FilterActionExclude, Types: []string{"Warning"}, MessageRegex: "connection refused"},
+		{Name: "keep-warnings", Action: config.FilterActionInclude, Types: []string{"Warning"}},
+		{Name: "drop-all", Action: config.FilterActionExclude},
+	}
+	eventFilter := newTestFilter(t, rules)
 
+	tests := []struct {
+		name     string
+		event    *v1.Event
+		expected bool
+	}{
+		{"first match wins", newTestEvent("Warning", "BackOff", "kubelet", "Pod", "prod-pay", "pay-1", ""), true},
+		{"regex is anchored", newTestEvent("Warning", "BackOff", "kubelet", "Pod", "preprod-pay", "pay-1", ""), false},
+		{"exclude before include", newTestEvent("Warning", "Unhealthy", "kubelet", "Pod", "dev", "a", "dial tcp: connection refused"), false},
+		{"later include", newTestEvent("Warning", "Unhealthy", "kubelet", "Pod", "dev", "a", "probe timeout"), true},
+		{"catch-all", newTestEvent("Normal", "Pulled", "kubelet", "Pod", "dev", "a", ""), false},
+	}
+	for _, test := range tests {
+		if got := eventFilter.include(test.event); got != test.expected {
+			t.Errorf("%s:\nexpected:\n%v\ngot:\n%v", test.name, test.expected, got)
+		}
+	}
+}
+
+func TestFilterReasonComponentCollision(t *testing.T) {
+	rules := []*config.FilterRule{
+		{Name: "drop-component", Action: config.FilterActionExclude, Components: []string{"Failed"}},
+	}
+	eventFilter := newTestFilter(t, rules)
+	// A reason named like an excluded component must not be dropped.
+	expected := true
+	got := eventFilter.include(newTestEvent("Warning", "Failed", "kubelet", "Pod", "default", "pod", ""))
+	if got != expected {
+		t.Errorf("\nexpected:\n%v\ngot:\n%v", expected, got)
+	}
+}
+
+func TestFilterDefaultRules(t *testing.T) {
+	eventFilter := newTestFilter(t, FilterRulesFor(&config.ConfigResolver{}, "test"))
+	tests := []struct {
+		event    *v1.Event
+		expected bool
+	}{
+		{newTestEvent("Warning", "BackOff", "kubelet", "Pod", "default", "pod", ""), true},
+		{newTestEvent("Normal", "Scheduled", "default-scheduler", "Pod", "default", "pod", ""), false},
+		{newTestEvent("Normal", "Started", "pipeline-controller", "PipelineRun", "default", "run", ""), false},
+		{newTestEvent("Warning", "Failed", "pipeline-controller", "PipelineRun", "default", "run", ""), false},
+		{newTestEvent("Warning", "BackOff", "taskrun-controller", "TaskRun", "default", "run", ""), false},
+		{newTestEvent("Warning", "FailedAttachVolume", "attachdetach-controller", "Pod", "default", "pod", ""), true},
+	}
+	for _, test := range tests {
+		if got := eventFilter.include(test.event); got != test.expected {
+			t.Errorf("%s:\nexpected:\n%v\ngot:\n%v", test.event.Reason, test.expected, got)
+		}
+	}
+}
+
+func TestFilterInvalidRule(t *testing.T) {
+	_, err := NewEventFilter(time.Now(), []*config.FilterRule{
+		{Name: "bad", Action: config.FilterActionExclude, NameRegex: "("},
+	})
+	if err == nil {
+		t.Errorf("expected error for invalid regex")
+	}
+	_, err = NewEventFilter(time.Now(), []*config.FilterRule{
+		{Name: "bad", Action: "drop"},
+	})
+	if err == nil {
+		t.Errorf("expected error for invalid action")
+	}
+}
+
+func TestWatchScope(t *testing.T) {
+	tests := []struct {
+		name       string
+		rules      []*config.FilterRule
+		namespaces []string
+		eventType  string
+	}{
+		{
+			name: "limited includes",
+			rules: []*config.FilterRule{
+				{Action: config.FilterActionExclude, Reasons: []string{"Pulled"}},
+				{Action: config.FilterActionInclude, Types: []string{"Warning"}, Namespaces: []string{"prod"}},
+				{Action: config.FilterActionInclude, Types: []string{"Warning"}, Namespaces: []string{"pay", "prod"}, Reasons: []string{"BackOff"}},
+				{Action: config.FilterActionExclude},
+			},
+			namespaces: []string{"pay", "prod"},
+			eventType:  "Warning",
+		},
+		{
+			name: "include without namespaces",
+			rules: []*config.FilterRule{
+				{Action: config.FilterActionInclude, Types: []string{"Warning"}, Namespaces: []string{"prod"}},
+				{Action: config.FilterActionInclude, Types: []string{"Normal"}, Reasons: []string{"Killing"}},
+				{Action: config.FilterActionExclude},
+			},
+		},
+		{
+			name: "no catch-all",
+			rules: []*config.FilterRule{
+				{Action: config.FilterActionInclude, Types: []string{"Warning"}, Namespaces: []string{"prod"}},
+				{Action: config.FilterActionExclude, Namespaces: []string{"dev"}},
+			},
+		},
+		{
+			name:  "default rules",
+			rules: DefaultFilterRules,
+		},
+	}
+	for _, test := range tests {
+		namespaces, eventType := watchScope(test.rules)
+		if fmt.Sprint(namespaces) != fmt.Sprint(test.namespaces) || eventType != test.eventType {
+			t.Errorf("%s:\nexpected:\n%v %q\ngot:\n%v %q", test.name, test.namespaces, test.eventType, namespaces, eventType)
+		}
+	}
 }
@@ -7,12 +7,13 @@ import (
 	"github.com/crain-cn/event-mesh/pkg/config"
 	"github.com/crain-cn/event-mesh/pkg/dispatch"
 	"github.com/crain-cn/event-mesh/pkg/notify"
+	"github.com/crain-cn/event-mesh/pkg/owner"
 	"github.com/crain-cn/event-mesh/pkg/provider"
+	"github.com/crain-cn/event-mesh/pkg/reason"
 	"github.com/prometheus/alertmanager/types"
 	common_model "github.com/prometheus/common/model"
 	"github.com/sirupsen/logrus"
 	v1 "k8s.io/api/core/v1"
-	"regexp"
 	"strings"
 	"time"
 )
@@ -26,9 +27,27 @@ type ElEvent struct {
 	StartTime time.Time
 	Alerts    provider.Alerts
 	T         time.Time
-	Reasons   map[string]string
-	Workcodes   map[string]string
+	Reasons   *reason.Dictionary
 	ENV       string
+
+	aggregator *eventAggregator
+	occurrence *eventOccurrence
+	owners     *ownerResolver
+	workload   *Workload
+	enricher   *enricher
+	enriched   map[string]string
+	diagnoser  *diagnoser
+	diagnosed  map[string]string
+	mentions   *ownerMentions
+	severities *severityClassifier
+	severity   string
+	resolver   *eventResolver
+	alerted    bool
+	// clusterLabels are the static labels of the cluster policy
+	clusterLabels map[string]string
+	// tracked is the checkpoint entry, done once the queue is finished
+	// with the event.
+	tracked *inflightEvent
 }
 
 type EventResult struct {
@@ -41,38 +60,69 @@ const (
 	EVENT_TYPE_ERROR    = "Error"
 )
 
+// Handle is the queue worker function. Alerts are sent once; a failed history
+// insert is reported on res so the queue can retry it.
 func (e *ElEvent) Handle(res chan interface{}) {
-	if e.Event.FirstTimestamp.Time.IsZero() {
-		e.T = e.Event.EventTime.Time.Local()
-	} else {
-		e.T = e.Event.LastTimestamp.Time.Local()
+	e.T = eventTime(e.Event).Local()
+	if !e.alerted {
+		e.observe()
+		if e.owners != nil {
+			e.workload = e.owners.Resolve(&e.Event.InvolvedObject)
+		}
+		e.classify()
+		e.log()
+		if e.occurrence.Notify {
+			if e.enricher != nil {
+				e.enriched = e.enricher.Enrich(e.Event, e.workload)
+			}
+			if e.diagnoser != nil {
+				e.diagnosed = e.diagnoser.Diagnose(e.Event)
+			}
+			e.insertAlerts()
+		}
+		e.alerted = true
 	}
-	e.log()
-	e.insertAlerts()
-
-	e.insertMysql()
 	res <- &EventResult{
-		err: nil,
+		err: e.insertMysql(),
 	}
 }
 
-func (e *ElEvent) Handle2() {
-	if e.Event.FirstTimestamp.Time.IsZero() {
-		e.T = e.Event.EventTime.Time.Local()
-	} else {
-		e.T = e.Event.LastTimestamp.Time.Local()
+// observe counts the event into its aggregate. Without an aggregator every
+// event stands alone and is notified.
+func (e *ElEvent) observe() {
+	if e.aggregator == nil {
+		e.occurrence = &eventOccurrence{
+			Count:     eventCount(e.Event),
+			FirstSeen: e.T,
+			LastSeen:  e.T,
+			Notify:    true,
+		}
+		return
 	}
-	e.insertMysql()
-	go e.insertAlerts()
+	e.occurrence = e.aggregator.Observe(e.Cluster, e.Event, e.T)
 }
 
+// classify sets the severity before the alert is routed.
+func (e *ElEvent) classify() {
+	if e.severities == nil {
+		e.severity = typeSeverity(e.Event.Type)
+		return
+	}
+	e.severity = e.severities.Classify(e.Event, e.occurrence)
+}
+
+func (e *ElEvent) done() {
+	if e.tracked != nil {
+		e.tracked.Done()
+	}
+}
 
 func (e *ElEvent) log() {
 	event := e.Event
 	logger := log.WithTime(e.T).
 		WithFields(logrus.Fields{
 			"type":             event.Type,
-			"count":            event.Count,
+			"count":            e.occurrence.Count,
 			"event_reason":     event.Reason,
 			"source_component": event.Source.Component,
 			"source_host":      event.Source.Host,
@@ -132,40 +182,55 @@ func (e *ElEvent) log() {
 
 func (e *ElEvent) insertAlerts() {
 	event := e.Event
-	labelSet := common_model.LabelSet{
-		"cluster":      common_model.LabelValue(e.Cluster),
-		"namespace":    common_model.LabelValue(event.InvolvedObject.Namespace),
-		"obj_kind":     common_model.LabelValue(event.InvolvedObject.Kind),
-		"obj_name":     common_model.LabelValue(event.InvolvedObject.Name),
-		"severity":     common_model.LabelValue(event.Type),
-		"event_reason": common_model.LabelValue(event.Reason),
-		"cn_reason":   common_model.LabelValue(e.Reasons[event.Reason]),
-		"source_host": common_model.LabelValue(event.Source.Host),
+	info := e.Reasons.Lookup(event.Reason)
+	var cnReason string
+	if info != nil {
+		cnReason = info.Label
 	}
+	labelSet := objectLabels(e.Cluster, &event.InvolvedObject, event.Source.Host)
+	labelSet["severity"] = common_model.LabelValue(e.severity)
+	labelSet["event_type"] = common_model.LabelValue(event.Type)
+	labelSet["event_reason"] = common_model.LabelValue(event.Reason)
+	labelSet["cn_reason"] = common_model.LabelValue(cnReason)
 
-	switch event.InvolvedObject.Kind {
-	case "Pod":
-		labelSet["pod"] = common_model.LabelValue(event.InvolvedObject.Name)
-		reg := regexp.MustCompile(`(.*)-[a-fA-F\d]{1,28}-\w{5}`)
-		name := event.InvolvedObject.Name
-		dy := reg.FindStringSubmatch(name)
-		if dy != nil {
-			labelSet["workcode"] = common_model.LabelValue(e.Workcodes[event.InvolvedObject.Namespace + "|" + dy[1]])
+	if info != nil && len(info.Class) > 0 {
+		labelSet["reason_class"] = common_model.LabelValue(info.Class)
+	}
+
+	// set by events.k8s.io/v1 events
+	if len(event.ReportingController) > 0 {
+		labelSet["reporting_controller"] = common_model.LabelValue(event.ReportingController)
+	}
+	if len(event.ReportingInstance) > 0 {
+		labelSet["reporting_instance"] = common_model.LabelValue(event.ReportingInstance)
+	}
+	if event.Related != nil {
+		labelSet["related_kind"] = common_model.LabelValue(event.Related.Kind)
+		labelSet["related_name"] = common_model.LabelValue(event.Related.Name)
+	}
+
+	addOwnerLabels(labelSet, e.mentions, event.InvolvedObject.Namespace, e.workload)
+	// enriched labels never replace the built-in ones
+	for name, value := range e.enriched {
+		if _, ok := labelSet[common_model.LabelName(name)]; !ok {
+			labelSet[common_model.LabelName(name)] = common_model.LabelValue(value)
 		}
-	case "Node":
-		labelSet["node"] = common_model.LabelValue(event.InvolvedObject.Name)
-	case "Deployment":
-		labelSet["deployment"] = common_model.LabelValue(event.InvolvedObject.Name)
-		labelSet["workcode"] = common_model.LabelValue(e.Workcodes[event.InvolvedObject.Namespace + "|" + event.InvolvedObject.Name])
-	case "ReplicaSet":
-		labelSet["replicaSet"] = common_model.LabelValue(event.InvolvedObject.Name)
-	case "HorizontalPodAutoscaler":
-		name := strings.Replace(event.InvolvedObject.Name,"-hpa","",-1)
-		labelSet["workcode"] = common_model.LabelValue(e.Workcodes[event.InvolvedObject.Namespace + "|" +name])
 	}
+	addClusterLabels(labelSet, e.clusterLabels)
 
 	annotations := common_model.LabelSet{
-		"message": common_model.LabelValue(event.Message),
+		"message":    common_model.LabelValue(event.Message),
+		"count":      common_model.LabelValue(fmt.Sprintf("%d", e.occurrence.Count)),
+		"first_seen": common_model.LabelValue(e.occurrence.FirstSeen.Format("2006-01-02 15:04:05")),
+		"last_seen":  common_model.LabelValue(e.occurrence.LastSeen.Format("2006-01-02 15:04:05")),
+	}
+	if info != nil && len(info.Doc) > 0 {
+		annotations["reason_doc"] = common_model.LabelValue(info.Doc)
+	}
+	for name, value := range e.diagnosed {
+		if _, ok := annotations[common_model.LabelName(name)]; !ok {
+			annotations[common_model.LabelName(name)] = common_model.LabelValue(value)
+		}
 	}
 
 	typeAlert := &types.Alert{
@@ -181,6 +246,55 @@ func (e *ElEvent) insertAlerts() {
 	//inputAlert = append(inputAlert, typeAlert)
 	//e.Alerts.Put(inputAlert...)
 
+	// problems that can recover fire until they do
+	e.resolver.Track(event, typeAlert)
+	sendAlert(typeAlert)
+}
+
+// objectLabels are the labels of every alert of an object, from an event or
+// from a state watcher.
+func objectLabels(cluster string, ref *v1.ObjectReference, host string) common_model.LabelSet {
+	labelSet := common_model.LabelSet{
+		"cluster":     common_model.LabelValue(cluster),
+		"namespace":   common_model.LabelValue(ref.Namespace),
+		"obj_kind":    common_model.LabelValue(ref.Kind),
+		"obj_name":    common_model.LabelValue(ref.Name),
+		"source_host": common_model.LabelValue(host),
+	}
+	switch ref.Kind {
+	case "Pod":
+		labelSet["pod"] = common_model.LabelValue(ref.Name)
+	case "Node":
+		labelSet["node"] = common_model.LabelValue(ref.Name)
+	case "Deployment":
+		labelSet["deployment"] = common_model.LabelValue(ref.Name)
+	case "ReplicaSet":
+		labelSet["replicaSet"] = common_model.LabelValue(ref.Name)
+	}
+	return labelSet
+}
+
+// addOwnerLabels labels the workload of the object and the owners to mention.
+func addOwnerLabels(labelSet common_model.LabelSet, mentions *ownerMentions, namespace string, workload *Workload) {
+	if workload != nil {
+		labelSet["workload_kind"] = common_model.LabelValue(workload.Kind)
+		labelSet["workload_name"] = common_model.LabelValue(workload.Name)
+	}
+	if mentions != nil {
+		owners := mentions.Lookup(namespace, workload)
+		if workcodes := owner.Workcodes(owners); len(workcodes) > 0 {
+			labelSet["workcode"] = common_model.LabelValue(strings.Join(workcodes, ","))
+		}
+		if mobiles := owner.Mobiles(owners); len(mobiles) > 0 {
+			labelSet["mobile"] = common_model.LabelValue(strings.Join(mobiles, ","))
+		}
+	}
+}
+
+// sendAlert executes the pipeline for every route matching the alert. The
+// resolver sends the resolved alerts through here too, so they share the
+// group key of the alert they resolve.
+func sendAlert(typeAlert *types.Alert) {
 	route := config.StaticRoute
 	routes := dispatch.NewRoute(route, nil)
 	for _, r := range routes.Match(typeAlert.Labels) {
@@ -190,17 +304,15 @@ func (e *ElEvent) insertAlerts() {
 		ctx = notify.WithGroupLabels(ctx, typeAlert.Labels)
 		_, _, err := nt.Exec(ctx,typeAlert)
 		if err != nil {
-			log.WithTime(e.T).
+			log.WithTime(typeAlert.StartsAt).
 				WithFields(logrus.Fields{
 					"message":   err.Error(),
 				}).Error()
 		}
 	}
-
-
 }
 
-func (e *ElEvent) insertMysql() {
+func (e *ElEvent) insertMysql() error {
 	event := e.Event
 	if e.ENV == "" || e.ENV  == "dev" {
 		//fmt.Println(model.EventHistory{
@@ -218,7 +330,7 @@ func (e *ElEvent) insertMysql() {
 		log.WithTime(time.Now()).
 			WithFields(logrus.Fields{
 				"errtype":           "local event ",
-				"Severity":        strings.ToLower(event.Type),
+				"Severity":        e.severity,
 				"Message":         event.Message,
 				"Reason":          event.Reason,
 				"Datetime":        e.T,
@@ -230,18 +342,50 @@ func (e *ElEvent) insertMysql() {
 				"SourceHost":      event.Source.Host,
 			}).Info()
 	} else {
-		err,id := model.AddEventHistory(&model.EventHistory{
-			Severity:        strings.ToLower(event.Type),
-			Message:         event.Message,
-			Reason:          event.Reason,
-			Datetime:        e.T,
-			Namespace:       event.InvolvedObject.Namespace,
-			Cluster:         e.Cluster,
-			ObjKind:         event.InvolvedObject.Kind,
-			ObjName:         event.InvolvedObject.Name,
-			SourceComponent: event.Source.Component,
-			SourceHost:      event.Source.Host,
-		})
+		var id uint
+		var relatedKind, relatedName, workloadKind, workloadName string
+		if e.workload != nil {
+			workloadKind, workloadName = e.workload.Kind, e.workload.Name
+		}
+		if event.Related != nil {
+			relatedKind, relatedName = event.Related.Kind, event.Related.Name
+		}
+		add := func() (uint, error) {
+			var err error
+			err, id = model.AddEventHistory(&model.EventHistory{
+				Severity:            e.severity,
+				EventType:           event.Type,
+				Message:             event.Message,
+				Reason:              event.Reason,
+				Datetime:            e.T,
+				Namespace:           event.InvolvedObject.Namespace,
+				Cluster:             e.Cluster,
+				ObjKind:             event.InvolvedObject.Kind,
+				ObjName:             event.InvolvedObject.Name,
+				SourceComponent:     event.Source.Component,
+				SourceHost:          event.Source.Host,
+				Fingerprint:         e.occurrence.Fingerprint,
+				ReportingController: event.ReportingController,
+				ReportingInstance:   event.ReportingInstance,
+				RelatedKind:         relatedKind,
+				RelatedName:         relatedName,
+				WorkloadKind:        workloadKind,
+				WorkloadName:        workloadName,
+				Count:               e.occurrence.Count,
+				FirstSeen:           e.occurrence.FirstSeen,
+			})
+			return id, err
+		}
+		var err error
+		if e.occurrence.aggregate == nil {
+			_, err = add()
+		} else {
+			// repeated occurrences update the row of the first one
+			err = e.occurrence.saveHistory(add, func(historyID uint) error {
+				id = historyID
+				return model.UpdateEventHistory(historyID, e.occurrence.Count, e.occurrence.LastSeen, event.Message, e.severity)
+			})
+		}
 		if err != nil {
 			log.WithTime(time.Now()).
 				WithFields(logrus.Fields{
@@ -253,7 +397,7 @@ func (e *ElEvent) insertMysql() {
 			log.WithTime(time.Now()).
 				WithFields(logrus.Fields{
 					"errtype":           "mysql insert ",
-					"Severity":        strings.ToLower(event.Type),
+					"Severity":        e.severity,
 					"Message":         event.Message,
 					"Reason":          event.Reason,
 					"Datetime":        e.T,
@@ -266,6 +410,7 @@ func (e *ElEvent) insertMysql() {
 					"id" : fmt.Sprintf("%d",id),
 				}).Info()
 		}
+		return err
 	}
-
+	return nil
 }
@@ -0,0 +1,357 @@
+package events
+
+import (
+	"fmt"
+	"github.com/crain-cn/event-mesh/cmd/config"
+	"github.com/crain-cn/event-mesh/pkg/provider"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/client_golang/prometheus"
+	common_model "github.com/prometheus/common/model"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	ClusterEventSourceDown = "ClusterEventSourceDown"
+	// Watchdog always fires while the process runs, a receiver that stops
+	// getting it knows the process is down.
+	Watchdog = "Watchdog"
+	// healthAlertLifetimes is how many intervals a health alert fires
+	// without being put again.
+	healthAlertLifetimes = 3
+
+	HealthOpClient = "client"
+	HealthOpList   = "list"
+	HealthOpWatch  = "watch"
+)
+
+// ClusterHealth tracks the event source of a cluster: its watches, its last
+// event and contact with the apiserver, and its client, list and watch
+// errors. A nil ClusterHealth tracks nothing.
+type ClusterHealth struct {
+	cluster   string
+	silentFor time.Duration
+
+	lock        sync.Mutex
+	since       time.Time
+	watches     int
+	lastEvent   time.Time
+	lastContact time.Time
+	// failing counts the errors since the last contact
+	failing   int
+	errors    map[string]int
+	lastError error
+	firing    *types.Alert
+}
+
+// ClusterHealthStatus is the state of the event source of a cluster.
+type ClusterHealthStatus struct {
+	Cluster     string         `json:"cluster"`
+	Watches     int            `json:"watches"`
+	LastEvent   time.Time      `json:"last_event"`
+	LastContact time.Time      `json:"last_contact"`
+	Errors      map[string]int `json:"errors"`
+	LastError   string         `json:"last_error,omitempty"`
+	Down        bool           `json:"down"`
+	DownReason  string         `json:"down_reason,omitempty"`
+}
+
+func newClusterHealth(cluster string, silentFor time.Duration, now time.Time) *ClusterHealth {
+	return &ClusterHealth{
+		cluster:   cluster,
+		silentFor: silentFor,
+		since:     now,
+		errors:    make(map[string]int),
+	}
+}
+
+// Failed records an error of op, HealthOpClient, HealthOpList or
+// HealthOpWatch.
+func (h *ClusterHealth) Failed(op string, err error) {
+	if h == nil {
+		return
+	}
+	clusterErrors.WithLabelValues(h.cluster, op).Inc()
+	h.lock.Lock()
+	h.errors[op]++
+	h.failing++
+	h.lastError = err
+	h.lock.Unlock()
+}
+
+// Contact records an answer of the apiserver: a list, an event or a
+// bookmark.
+func (h *ClusterHealth) Contact() {
+	if h == nil {
+		return
+	}
+	h.lock.Lock()
+	h.lastContact = time.Now()
+	h.failing = 0
+	h.lock.Unlock()
+}
+
+// Observed records an event.
+func (h *ClusterHealth) Observed() {
+	if h == nil {
+		return
+	}
+	now := time.Now()
+	clusterLastEvent.WithLabelValues(h.cluster).Set(float64(now.Unix()))
+	h.lock.Lock()
+	h.lastEvent = now
+	h.lastContact = now
+	h.failing = 0
+	h.lock.Unlock()
+}
+
+// Watching records a watch opened, when delta is 1, or closed.
+func (h *ClusterHealth) Watching(delta int) {
+	if h == nil {
+		return
+	}
+	h.lock.Lock()
+	h.watches += delta
+	clusterWatches.WithLabelValues(h.cluster).Set(float64(h.watches))
+	h.lock.Unlock()
+}
+
+// downLocked tells why the event source is down at now: it failed since its
+// last contact for failingFor, or it has no event for silentFor. Times
+// before the tracking started count from its start.
+func (h *ClusterHealth) downLocked(now time.Time, failingFor time.Duration) string {
+	lastContact := h.lastContact
+	if lastContact.Before(h.since) {
+		lastContact = h.since
+	}
+	if h.failing > 0 && now.Sub(lastContact) >= failingFor {
+		return fmt.Sprintf("%d errors in %s: %v", h.failing, now.Sub(lastContact).Round(time.Second), h.lastError)
+	}
+	lastEvent := h.lastEvent
+	if lastEvent.Before(h.since) {
+		lastEvent = h.since
+	}
+	if now.Sub(lastEvent) >= h.silentFor {
+		return fmt.Sprintf("no events in %s", now.Sub(lastEvent).Round(time.Second))
+	}
+	return ""
+}
+
+func (h *ClusterHealth) statusLocked(now time.Time, failingFor time.Duration) ClusterHealthStatus {
+	status := ClusterHealthStatus{
+		Cluster:     h.cluster,
+		Watches:     h.watches,
+		LastEvent:   h.lastEvent,
+		LastContact: h.lastContact,
+		Errors:      make(map[string]int, len(h.errors)),
+		DownReason:  h.downLocked(now, failingFor),
+	}
+	for op, n := range h.errors {
+		status.Errors[op] = n
+	}
+	if h.lastError != nil {
+		status.LastError = h.lastError.Error()
+	}
+	status.Down = len(status.DownReason) > 0
+	return status
+}
+
+// HealthMonitor checks the event sources of the clusters every Interval and
+// puts ClusterEventSourceDown alerts for the ones down, and the Watchdog
+// alert of the process, into the alert provider.
+type HealthMonitor struct {
+	configResolver *config.ConfigResolver
+	opt            *config.ClusterHealthOpt
+	alerts         provider.Alerts
+	started        time.Time
+	// Replica labels the Watchdog when the clusters are sharded, for each
+	// replica to fire its own.
+	Replica string
+
+	lock     sync.Mutex
+	clusters map[string]*ClusterHealth
+}
+
+func NewHealthMonitor(configResolver *config.ConfigResolver, alerts provider.Alerts) *HealthMonitor {
+	registerHealthMetrics(prometheus.DefaultRegisterer)
+	return &HealthMonitor{
+		configResolver: configResolver,
+		opt:            configResolver.GetClusterHealthOpt(),
+		alerts:         alerts,
+		started:        time.Now(),
+		clusters:       make(map[string]*ClusterHealth),
+	}
+}
+
+// Cluster returns the health of the cluster, tracked from now on when it was
+// not yet.
+func (m *HealthMonitor) Cluster(cluster string) *ClusterHealth {
+	if m == nil {
+		return nil
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	h, ok := m.clusters[cluster]
+	if !ok {
+		h = newClusterHealth(cluster, m.configResolver.GetClusterSilentFor(cluster), time.Now())
+		m.clusters[cluster] = h
+	}
+	return h
+}
+
+// Remove stops tracking the cluster and resolves its alert.
+func (m *HealthMonitor) Remove(cluster string) {
+	if m == nil {
+		return
+	}
+	m.lock.Lock()
+	h, ok := m.clusters[cluster]
+	delete(m.clusters, cluster)
+	m.lock.Unlock()
+	if !ok {
+		return
+	}
+	clusterUp.DeleteLabelValues(cluster)
+	clusterWatches.DeleteLabelValues(cluster)
+	clusterLastEvent.DeleteLabelValues(cluster)
+
+	h.lock.Lock()
+	firing := h.firing
+	h.firing = nil
+	h.lock.Unlock()
+	if firing == nil {
+		return
+	}
+	now := time.Now()
+	resolved := *firing
+	resolved.EndsAt = now
+	resolved.UpdatedAt = now
+	if err := m.alerts.Put(&resolved); err != nil {
+		log.WithError(err).Error("put cluster health alert: ", cluster)
+	}
+}
+
+// Status returns the state of the event sources, by cluster name.
+func (m *HealthMonitor) Status() []ClusterHealthStatus {
+	if m == nil {
+		return nil
+	}
+	now := time.Now()
+	m.lock.Lock()
+	statuses := make([]ClusterHealthStatus, 0, len(m.clusters))
+	for _, h := range m.clusters {
+		h.lock.Lock()
+		statuses = append(statuses, h.statusLocked(now, m.opt.FailingFor))
+		h.lock.Unlock()
+	}
+	m.lock.Unlock()
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Cluster < statuses[j].Cluster })
+	return statuses
+}
+
+// Run checks the clusters every Interval until stopCh is closed.
+func (m *HealthMonitor) Run(stopCh <-chan struct{}) {
+	m.check(time.Now())
+	ticker := time.NewTicker(m.opt.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			m.check(now)
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+func (m *HealthMonitor) check(now time.Time) {
+	alerts := []*types.Alert{m.watchdog(now)}
+	m.lock.Lock()
+	for _, h := range m.clusters {
+		h.lock.Lock()
+		status := h.statusLocked(now, m.opt.FailingFor)
+		if status.Down {
+			clusterUp.WithLabelValues(h.cluster).Set(0)
+			alert := m.alert(status, now)
+			if h.firing != nil {
+				alert.StartsAt = h.firing.StartsAt
+			}
+			h.firing = alert
+			alerts = append(alerts, alert)
+		} else {
+			clusterUp.WithLabelValues(h.cluster).Set(1)
+			if h.firing != nil {
+				resolved := *h.firing
+				resolved.EndsAt = now
+				resolved.UpdatedAt = now
+				alerts = append(alerts, &resolved)
+				h.firing = nil
+			}
+		}
+		h.lock.Unlock()
+	}
+	m.lock.Unlock()
+
+	if err := m.alerts.Put(alerts...); err != nil {
+		log.WithError(err).Error("put cluster health alerts")
+	}
+}
+
+func (m *HealthMonitor) alert(status ClusterHealthStatus, now time.Time) *types.Alert {
+	annotations := common_model.LabelSet{
+		"message":    common_model.LabelValue("event source of cluster " + status.Cluster + " is down: " + status.DownReason),
+		"watches":    common_model.LabelValue(strconv.Itoa(status.Watches)),
+		"last_error": common_model.LabelValue(status.LastError),
+	}
+	if !status.LastEvent.IsZero() {
+		annotations["last_event"] = common_model.LabelValue(status.LastEvent.Local().Format("2006-01-02 15:04:05"))
+	}
+	if !status.LastContact.IsZero() {
+		annotations["last_contact"] = common_model.LabelValue(status.LastContact.Local().Format("2006-01-02 15:04:05"))
+	}
+	for op, n := range status.Errors {
+		annotations[common_model.LabelName(op+"_errors")] = common_model.LabelValue(strconv.Itoa(n))
+	}
+	labelSet := common_model.LabelSet{
+		"alertname":    ClusterEventSourceDown,
+		"cluster":      common_model.LabelValue(status.Cluster),
+		"obj_kind":     "Cluster",
+		"obj_name":     common_model.LabelValue(status.Cluster),
+		"severity":     config.SeverityCritical,
+		"event_type":   EVENT_TYPE_WARRNIGN,
+		"event_reason": ClusterEventSourceDown,
+	}
+	addClusterLabels(labelSet, m.configResolver.GetClusterPolicy(status.Cluster).Labels)
+	return &types.Alert{
+		Alert: common_model.Alert{
+			Labels:      labelSet,
+			Annotations: annotations,
+			StartsAt:    now,
+			EndsAt:      now.Add(healthAlertLifetimes * m.opt.Interval),
+		},
+		UpdatedAt: now,
+	}
+}
+
+func (m *HealthMonitor) watchdog(now time.Time) *types.Alert {
+	labels := common_model.LabelSet{
+		"alertname": Watchdog,
+		"severity":  config.SeverityInfo,
+	}
+	if len(m.Replica) > 0 {
+		labels["replica"] = common_model.LabelValue(m.Replica)
+	}
+	return &types.Alert{
+		Alert: common_model.Alert{
+			Labels: labels,
+			Annotations: common_model.LabelSet{
+				"message": "event-mesh is running, this alert always fires",
+			},
+			StartsAt: m.started,
+			EndsAt:   now.Add(healthAlertLifetimes * m.opt.Interval),
+		},
+		UpdatedAt: now,
+	}
+}
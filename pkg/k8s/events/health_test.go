@@ -0,0 +1,71 @@
+package events
+
+import (
+	"errors"
+	"github.com/crain-cn/event-mesh/cmd/config"
+	"testing"
+	"time"
+)
+
+func TestHealthMonitor(t *testing.T) {
+	configResolver := &config.ConfigResolver{
+		EventSinks: []*config.EventSinks{{Cluster: "quiet", SilentFor: 2 * time.Hour}},
+	}
+	alerts := &putAlerts{}
+	m := NewHealthMonitor(configResolver, alerts)
+	prod := m.Cluster("prod")
+	quiet := m.Cluster("quiet")
+	broken := m.Cluster("broken")
+	broken.Failed(HealthOpClient, errors.New("invalid kubeconfig"))
+	prod.Watching(1)
+	prod.Observed()
+	quiet.Watching(1)
+
+	now := time.Now()
+	m.check(now)
+	if len(alerts.put) != 1 || alerts.put[0].Labels["alertname"] != Watchdog {
+		t.Errorf("\nexpected:\n%v\ngot:\n%v", "the watchdog alone", alerts.put)
+	}
+
+	alerts.put = nil
+	later := now.Add(config.DefaultClusterHealthOpt.SilentFor)
+	m.check(later)
+	down := make(map[string]bool)
+	for _, alert := range alerts.put {
+		if alert.Labels["alertname"] != ClusterEventSourceDown {
+			continue
+		}
+		down[string(alert.Labels["cluster"])] = true
+		if alert.Labels["cluster"] == "broken" && alert.Annotations["client_errors"] != "1" {
+			t.Errorf("\nexpected:\n%v\ngot:\n%v", "1 client error", alert.Annotations)
+		}
+	}
+	// prod is silent, broken failing; quiet is allowed two hours of silence
+	if len(down) != 2 || !down["prod"] || !down["broken"] {
+		t.Errorf("\nexpected:\n%v\ngot:\n%v", "prod and broken down", down)
+	}
+
+	// an event brings prod back, a removed cluster is resolved
+	alerts.put = nil
+	prod.Observed()
+	m.Remove("broken")
+	if len(alerts.put) != 1 || !alerts.put[0].Resolved() || alerts.put[0].Labels["cluster"] != "broken" {
+		t.Errorf("\nexpected:\n%v\ngot:\n%v", "broken resolved", alerts.put)
+	}
+	alerts.put = nil
+	m.check(time.Now())
+	resolved := 0
+	for _, alert := range alerts.put {
+		if alert.Labels["alertname"] == ClusterEventSourceDown && alert.Labels["cluster"] == "prod" && alert.Resolved() {
+			resolved++
+		}
+	}
+	if resolved != 1 {
+		t.Errorf("\nexpected:\n%v\ngot:\n%v", "prod resolved", alerts.put)
+	}
+
+	statuses := m.Status()
+	if len(statuses) != 2 || statuses[0].Cluster != "prod" || statuses[0].Down || statuses[0].Watches != 1 {
+		t.Errorf("\nexpected:\n%v\ngot:\n%v", "prod up with a watch, then quiet", statuses)
+	}
+}
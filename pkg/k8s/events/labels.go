@@ -0,0 +1,44 @@
+package events
+
+import (
+	"github.com/crain-cn/event-mesh/pkg/provider"
+	"github.com/prometheus/alertmanager/types"
+	common_model "github.com/prometheus/common/model"
+)
+
+// addClusterLabels adds the static labels of the cluster policy. They never
+// replace the labels of the alert.
+func addClusterLabels(labelSet common_model.LabelSet, labels map[string]string) {
+	for name, value := range labels {
+		if _, ok := labelSet[common_model.LabelName(name)]; !ok {
+			labelSet[common_model.LabelName(name)] = common_model.LabelValue(value)
+		}
+	}
+}
+
+// labeledAlerts adds the static labels of a cluster to the alerts put into
+// the provider.
+type labeledAlerts struct {
+	provider.Alerts
+	labels map[string]string
+}
+
+// withClusterLabels returns alerts adding labels to the alerts put, or alerts
+// when there are none.
+func withClusterLabels(alerts provider.Alerts, labels map[string]string) provider.Alerts {
+	if len(labels) == 0 {
+		return alerts
+	}
+	return &labeledAlerts{Alerts: alerts, labels: labels}
+}
+
+func (a *labeledAlerts) Put(alerts ...*types.Alert) error {
+	labeled := make([]*types.Alert, 0, len(alerts))
+	for _, alert := range alerts {
+		copied := *alert
+		copied.Labels = alert.Labels.Clone()
+		addClusterLabels(copied.Labels, a.labels)
+		labeled = append(labeled, &copied)
+	}
+	return a.Alerts.Put(labeled...)
+}
@@ -0,0 +1,77 @@
+package events
+
+import (
+	"github.com/crain-cn/event-mesh/cmd/config"
+	"github.com/prometheus/alertmanager/types"
+	common_model "github.com/prometheus/common/model"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestClusterPolicyEnv(t *testing.T) {
+	off := false
+	configResolver := &config.ConfigResolver{
+		ClusterPolicies: []*config.ClusterPolicy{
+			{Cluster: "k8s-dev", Env: "dev"},
+			{Cluster: "*", Collect: &off, Env: "dev"},
+		},
+	}
+	defer os.Setenv("env", os.Getenv("env"))
+
+	os.Setenv("env", "test")
+	if !configResolver.GetClusterPolicy("local").Collected() {
+		t.Errorf("\nexpected:\n%v\ngot:\n%v", "local collected out of dev", false)
+	}
+	os.Setenv("env", "dev")
+	if configResolver.GetClusterPolicy("local").Collected() || !configResolver.GetClusterPolicy("k8s-dev").Collected() {
+		t.Errorf("\nexpected:\n%v\ngot:\n%v", "only k8s-dev collected in dev", configResolver.GetClusterPolicy("local"))
+	}
+}
+
+func TestClusterPolicyLabels(t *testing.T) {
+	off := false
+	configResolver := &config.ConfigResolver{
+		EventSinks: []*config.EventSinks{
+			{Cluster: "online", Source: "core/v1", Filters: []string{"Pulled"}},
+			{Cluster: "prod", Filters: []string{"Killing"}},
+		},
+		ClusterPolicies: []*config.ClusterPolicy{
+			{Cluster: "*", Sinks: "online", Labels: map[string]string{"env": "online"}},
+			{Cluster: "dev", Collect: &off, Labels: map[string]string{"env": "dev"}},
+		},
+	}
+	// the Cluster CR overrides the config
+	configResolver.SetClusterPolicy("prod", &config.ClusterPolicy{Labels: map[string]string{"region": "cn-north"}})
+
+	policy := configResolver.GetClusterPolicy("prod")
+	expected := map[string]string{"env": "online", "region": "cn-north"}
+	if !policy.Collected() || policy.Sinks != "online" || !reflect.DeepEqual(policy.Labels, expected) {
+		t.Errorf("\nexpected:\n%v\ngot:\n%v", expected, policy)
+	}
+	if configResolver.GetEventSource("prod") != "core/v1" {
+		t.Errorf("\nexpected:\n%v\ngot:\n%v", "the source of the online sinks", configResolver.GetEventSource("prod"))
+	}
+	// the filters are those of the sinks the policy names too
+	if got := configResolver.GetEventSinksFilters("prod"); !reflect.DeepEqual(got, []string{"Pulled"}) {
+		t.Errorf("\nexpected:\n%v\ngot:\n%v", []string{"Pulled"}, got)
+	}
+	if rules := configResolver.GetEventFilterRules("prod"); len(rules) != 2 || rules[0].Reasons[0] != "Pulled" {
+		t.Errorf("\nexpected:\n%v\ngot:\n%v", "the filter rules of the online sinks", rules)
+	}
+	if configResolver.GetClusterPolicy("dev").Collected() {
+		t.Errorf("\nexpected:\n%v\ngot:\n%v", "dev not collected", true)
+	}
+
+	alerts := &putAlerts{}
+	labeled := withClusterLabels(alerts, policy.Labels)
+	alert := &types.Alert{Alert: common_model.Alert{Labels: common_model.LabelSet{"cluster": "prod", "env": "canary"}}}
+	if err := labeled.Put(alert); err != nil {
+		t.Fatal(err)
+	}
+	// the labels of the alert win, and the alert put is a copy
+	labels := common_model.LabelSet{"cluster": "prod", "env": "canary", "region": "cn-north"}
+	if len(alerts.put) != 1 || !reflect.DeepEqual(alerts.put[0].Labels, labels) || len(alert.Labels) != 2 {
+		t.Errorf("\nexpected:\n%v\ngot:\n%v", labels, alerts.put)
+	}
+}
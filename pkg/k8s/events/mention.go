@@ -0,0 +1,77 @@
+package events
+
+import (
+	"context"
+	"github.com/crain-cn/event-mesh/cmd/config"
+	"github.com/crain-cn/event-mesh/pkg/owner"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ownerMentions finds who to mention in the notifications of a workload: the
+// owners annotated on the workload or its namespace, when annotations are a
+// source, and else the owners in the directory.
+type ownerMentions struct {
+	kc          kubernetes.Interface
+	directory   *owner.Directory
+	annotations bool
+	cache       *ttlCache
+}
+
+func newOwnerMentions(kc kubernetes.Interface, directory *owner.Directory, opt *config.OwnerDirectoryOpt) *ownerMentions {
+	m := &ownerMentions{
+		kc:        kc,
+		directory: directory,
+		cache:     newTTLCache(opt.RefreshInterval),
+	}
+	for _, source := range opt.Sources {
+		if source == config.OwnerSourceAnnotations {
+			m.annotations = true
+		}
+	}
+	return m
+}
+
+func (m *ownerMentions) Run(stopCh <-chan struct{}) {
+	m.cache.Run(stopCh)
+}
+
+// Lookup returns the owners of the workload, or of the namespace for events
+// without a workload.
+func (m *ownerMentions) Lookup(namespace string, w *Workload) []owner.Owner {
+	if len(namespace) == 0 {
+		return nil
+	}
+	var name string
+	if w != nil {
+		name = w.Name
+	}
+	if m.annotations {
+		if w != nil {
+			if owners := m.annotated(w.Kind, namespace, w.Name); len(owners) > 0 {
+				return owners
+			}
+		}
+		if owners := m.annotated("Namespace", "", namespace); len(owners) > 0 {
+			return owners
+		}
+	}
+	if m.directory != nil {
+		return m.directory.Lookup(namespace, name)
+	}
+	return nil
+}
+
+func (m *ownerMentions) annotated(kind, namespace, name string) []owner.Owner {
+	key := kind + "/" + namespace + "/" + name
+	if v, ok := m.cache.Get(key); ok {
+		return v.([]owner.Owner)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), ownerTimeout)
+	defer cancel()
+	var owners []owner.Owner
+	if obj, err := getObjectMeta(ctx, m.kc, kind, namespace, name); err == nil {
+		owners = owner.FromAnnotations(obj.GetAnnotations())
+	}
+	m.cache.Set(key, owners)
+	return owners
+}
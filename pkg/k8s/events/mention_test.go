@@ -0,0 +1,62 @@
+package events
+
+import (
+	"github.com/crain-cn/event-mesh/cmd/config"
+	"github.com/crain-cn/event-mesh/pkg/owner"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"reflect"
+	"testing"
+)
+
+type ownerMap map[string][]owner.Owner
+
+func (m ownerMap) Name() string {
+	return "map"
+}
+
+func (m ownerMap) Load() (map[string][]owner.Owner, error) {
+	return m, nil
+}
+
+func TestOwnerMentions(t *testing.T) {
+	kc := fake.NewSimpleClientset(
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{
+			Name: "cart", Namespace: "shop",
+			Annotations: map[string]string{owner.AnnotationOwner: "100"},
+		}},
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "order", Namespace: "shop"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name:        "blog",
+			Annotations: map[string]string{owner.AnnotationOwner: "200", owner.AnnotationOwnerMobile: "13800000000"},
+		}},
+	)
+	directory := owner.NewDirectory(0, ownerMap{
+		owner.Key("shop", "cart"):  {{Workcode: "1"}},
+		owner.Key("shop", "order"): {{Workcode: "2"}},
+	})
+	directory.Refresh()
+	opt := config.DefaultOwnerDirectoryOpt
+	opt.Sources = []string{config.OwnerSourceAnnotations, config.OwnerSourceDB}
+	m := newOwnerMentions(kc, directory, &opt)
+
+	tests := []struct {
+		namespace string
+		workload  *Workload
+		expected  []owner.Owner
+	}{
+		// annotations come before the directory
+		{"shop", &Workload{"Deployment", "cart"}, []owner.Owner{{Workcode: "100"}}},
+		{"shop", &Workload{"Deployment", "order"}, []owner.Owner{{Workcode: "2"}}},
+		{"blog", &Workload{"Deployment", "post"}, []owner.Owner{{Workcode: "200", Mobile: "13800000000"}}},
+		{"blog", nil, []owner.Owner{{Workcode: "200", Mobile: "13800000000"}}},
+		{"", nil, nil},
+	}
+	for _, test := range tests {
+		if got := m.Lookup(test.namespace, test.workload); !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("%s/%v:\nexpected:\n%v\ngot:\n%v", test.namespace, test.workload, test.expected, got)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package events
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/client-go/util/workqueue"
+	"sync"
+)
+
+const metricsNamespace = "eventmesh"
+
+var (
+	queueMetricsOnce  sync.Once
+	healthMetricsOnce sync.Once
+
+	eventsShed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "event_queue_shed_total",
+		Help:      "Number of events dropped because the cluster event queue was saturated.",
+	}, []string{"cluster", "type"})
+
+	countDropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "event_count_dropped_total",
+		Help:      "Number of events not counted by the count rules because the counter fell behind.",
+	}, []string{"cluster"})
+
+	clusterUp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "cluster_event_source_up",
+		Help:      "Whether the event source of the cluster was up at the last health check.",
+	}, []string{"cluster"})
+
+	clusterWatches = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "cluster_event_watches",
+		Help:      "Number of event watches open on the cluster.",
+	}, []string{"cluster"})
+
+	clusterLastEvent = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "cluster_last_event_timestamp_seconds",
+		Help:      "Unix time of the last event received from the cluster.",
+	}, []string{"cluster"})
+
+	clusterErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "cluster_event_source_errors_total",
+		Help:      "Number of client, list and watch errors of the cluster event source.",
+	}, []string{"cluster", "op"})
+)
+
+// registerHealthMetrics registers the metrics of the cluster event sources.
+func registerHealthMetrics(r prometheus.Registerer) {
+	healthMetricsOnce.Do(func() {
+		r.MustRegister(clusterUp, clusterWatches, clusterLastEvent, clusterErrors)
+	})
+}
+
+// registerQueueMetrics installs the prometheus workqueue metrics provider.
+// client-go only accepts one provider per process, so it runs once.
+func registerQueueMetrics(r prometheus.Registerer) {
+	queueMetricsOnce.Do(func() {
+		p := newQueueMetricsProvider()
+		r.MustRegister(p.depth, p.adds, p.latency, p.workDuration, p.unfinished, p.longestRunning, p.retries, eventsShed, countDropped)
+		workqueue.SetProvider(p)
+	})
+}
+
+// queueMetricsProvider implements workqueue.MetricsProvider. Every metric is
+// labelled with the queue name, which is the cluster name.
+type queueMetricsProvider struct {
+	depth          *prometheus.GaugeVec
+	adds           *prometheus.CounterVec
+	latency        *prometheus.HistogramVec
+	workDuration   *prometheus.HistogramVec
+	unfinished     *prometheus.GaugeVec
+	longestRunning *prometheus.GaugeVec
+	retries        *prometheus.CounterVec
+}
+
+func newQueueMetricsProvider() *queueMetricsProvider {
+	return &queueMetricsProvider{
+		depth: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "event_queue_depth",
+			Help:      "Current depth of the cluster event queue.",
+		}, []string{"cluster"}),
+		adds: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "event_queue_adds_total",
+			Help:      "Number of events added to the cluster event queue.",
+		}, []string{"cluster"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "event_queue_latency_seconds",
+			Help:      "How long an event stays in the queue before it is handled.",
+			Buckets:   prometheus.ExponentialBuckets(0.001, 4, 10),
+		}, []string{"cluster"}),
+		workDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "event_queue_work_duration_seconds",
+			Help:      "How long handling an event takes.",
+			Buckets:   prometheus.ExponentialBuckets(0.001, 4, 10),
+		}, []string{"cluster"}),
+		unfinished: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "event_queue_unfinished_work_seconds",
+			Help:      "Seconds of work in progress that has not been observed by work_duration.",
+		}, []string{"cluster"}),
+		longestRunning: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "event_queue_longest_running_processor_seconds",
+			Help:      "Seconds the longest running event handler has been running.",
+		}, []string{"cluster"}),
+		retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "event_queue_retries_total",
+			Help:      "Number of event retries handled by the cluster event queue.",
+		}, []string{"cluster"}),
+	}
+}
+
+func (p *queueMetricsProvider) NewDepthMetric(name string) workqueue.GaugeMetric {
+	return p.depth.WithLabelValues(name)
+}
+
+func (p *queueMetricsProvider) NewAddsMetric(name string) workqueue.CounterMetric {
+	return p.adds.WithLabelValues(name)
+}
+
+func (p *queueMetricsProvider) NewLatencyMetric(name string) workqueue.HistogramMetric {
+	return p.latency.WithLabelValues(name)
+}
+
+func (p *queueMetricsProvider) NewWorkDurationMetric(name string) workqueue.HistogramMetric {
+	return p.workDuration.WithLabelValues(name)
+}
+
+func (p *queueMetricsProvider) NewUnfinishedWorkSecondsMetric(name string) workqueue.SettableGaugeMetric {
+	return p.unfinished.WithLabelValues(name)
+}
+
+func (p *queueMetricsProvider) NewLongestRunningProcessorSecondsMetric(name string) workqueue.SettableGaugeMetric {
+	return p.longestRunning.WithLabelValues(name)
+}
+
+func (p *queueMetricsProvider) NewRetriesMetric(name string) workqueue.CounterMetric {
+	return p.retries.WithLabelValues(name)
+}
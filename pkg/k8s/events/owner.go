@@ -0,0 +1,134 @@
+package events
+
+import (
+	"context"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"regexp"
+	"time"
+)
+
+const (
+	ownerCacheTTL = 10 * time.Minute
+	ownerTimeout  = 5 * time.Second
+	// maxOwnerDepth bounds the walk up the controller references, e.g.
+	// Pod, ReplicaSet, Deployment and an operator resource above it.
+	maxOwnerDepth = 5
+)
+
+// podHashRegexp matches the pods of a Deployment, name-<replicaset hash>-<id>.
+var podHashRegexp = regexp.MustCompile(`^(.*)-[a-fA-F\d]{1,28}-\w{5}$`)
+
+// Workload is the top controller of an object, e.g. the Deployment of a pod.
+type Workload struct {
+	Kind string
+	Name string
+}
+
+type ownerGetter func(ctx context.Context, kc kubernetes.Interface, namespace, name string) (metav1.Object, error)
+
+// ownerGetters read the kinds that are walked through. Owners of other kinds,
+// e.g. custom resources, end the walk and are the workload.
+var ownerGetters = map[string]ownerGetter{
+	"Pod": func(ctx context.Context, kc kubernetes.Interface, namespace, name string) (metav1.Object, error) {
+		return kc.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+	},
+	"ReplicaSet": func(ctx context.Context, kc kubernetes.Interface, namespace, name string) (metav1.Object, error) {
+		return kc.AppsV1().ReplicaSets(namespace).Get(ctx, name, metav1.GetOptions{})
+	},
+	"Deployment": func(ctx context.Context, kc kubernetes.Interface, namespace, name string) (metav1.Object, error) {
+		return kc.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+	},
+	"StatefulSet": func(ctx context.Context, kc kubernetes.Interface, namespace, name string) (metav1.Object, error) {
+		return kc.AppsV1().StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{})
+	},
+	"DaemonSet": func(ctx context.Context, kc kubernetes.Interface, namespace, name string) (metav1.Object, error) {
+		return kc.AppsV1().DaemonSets(namespace).Get(ctx, name, metav1.GetOptions{})
+	},
+	"Job": func(ctx context.Context, kc kubernetes.Interface, namespace, name string) (metav1.Object, error) {
+		return kc.BatchV1().Jobs(namespace).Get(ctx, name, metav1.GetOptions{})
+	},
+	"CronJob": func(ctx context.Context, kc kubernetes.Interface, namespace, name string) (metav1.Object, error) {
+		return kc.BatchV1beta1().CronJobs(namespace).Get(ctx, name, metav1.GetOptions{})
+	},
+}
+
+// ownerResolver finds the workload of the objects events are about, walking
+// their controller references. Lookups are cached per object.
+type ownerResolver struct {
+	kc    kubernetes.Interface
+	cache *ttlCache
+}
+
+func newOwnerResolver(kc kubernetes.Interface) *ownerResolver {
+	return &ownerResolver{
+		kc:    kc,
+		cache: newTTLCache(ownerCacheTTL),
+	}
+}
+
+func (r *ownerResolver) Run(stopCh <-chan struct{}) {
+	r.cache.Run(stopCh)
+}
+
+// Resolve returns the workload of the object, or nil for objects that do not
+// belong to one, such as nodes.
+func (r *ownerResolver) Resolve(ref *corev1.ObjectReference) *Workload {
+	key := ref.Kind + "/" + ref.Namespace + "/" + ref.Name
+	if v, ok := r.cache.Get(key); ok {
+		return v.(*Workload)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), ownerTimeout)
+	defer cancel()
+	w := r.resolve(ctx, ref.Kind, ref.Namespace, ref.Name)
+	r.cache.Set(key, w)
+	return w
+}
+
+func (r *ownerResolver) resolve(ctx context.Context, kind, namespace, name string) *Workload {
+	if kind == "HorizontalPodAutoscaler" {
+		hpa, err := r.kc.AutoscalingV1().HorizontalPodAutoscalers(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil
+		}
+		kind, name = hpa.Spec.ScaleTargetRef.Kind, hpa.Spec.ScaleTargetRef.Name
+	}
+	get, ok := ownerGetters[kind]
+	if !ok {
+		return nil
+	}
+	obj, err := get(ctx, r.kc, namespace, name)
+	if err != nil {
+		return workloadFromName(kind, name)
+	}
+
+	w := &Workload{Kind: kind, Name: name}
+	for i := 0; i < maxOwnerDepth; i++ {
+		owner := metav1.GetControllerOf(obj)
+		if owner == nil {
+			break
+		}
+		w = &Workload{Kind: owner.Kind, Name: owner.Name}
+		get, ok := ownerGetters[owner.Kind]
+		if !ok {
+			break
+		}
+		if obj, err = get(ctx, r.kc, namespace, owner.Name); err != nil {
+			break
+		}
+	}
+	return w
+}
+
+// workloadFromName guesses the workload of an object that is gone, which
+// happens for the events of deleted pods. Only Deployment pod names carry
+// their workload; other objects are their own workload.
+func workloadFromName(kind, name string) *Workload {
+	if kind == "Pod" {
+		if m := podHashRegexp.FindStringSubmatch(name); m != nil {
+			return &Workload{Kind: "Deployment", Name: m[1]}
+		}
+	}
+	return &Workload{Kind: kind, Name: name}
+}
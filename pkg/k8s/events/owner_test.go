@@ -0,0 +1,62 @@
+package events
+
+import (
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	"testing"
+)
+
+func newOwnedMeta(name, ownerKind, ownerName string) metav1.ObjectMeta {
+	m := metav1.ObjectMeta{Name: name, Namespace: "default"}
+	if len(ownerKind) > 0 {
+		controller := true
+		m.OwnerReferences = []metav1.OwnerReference{{Kind: ownerKind, Name: ownerName, Controller: &controller}}
+	}
+	return m
+}
+
+func TestOwnerResolver(t *testing.T) {
+	objects := []runtime.Object{
+		&corev1.Pod{ObjectMeta: newOwnedMeta("web-5d4f8-abcde", "ReplicaSet", "web-5d4f8")},
+		&appsv1.ReplicaSet{ObjectMeta: newOwnedMeta("web-5d4f8", "Deployment", "web")},
+		&appsv1.Deployment{ObjectMeta: newOwnedMeta("web", "", "")},
+		&corev1.Pod{ObjectMeta: newOwnedMeta("db-0", "StatefulSet", "db")},
+		&appsv1.StatefulSet{ObjectMeta: newOwnedMeta("db", "", "")},
+		&corev1.Pod{ObjectMeta: newOwnedMeta("agent-x1", "DaemonSet", "agent")},
+		&corev1.Pod{ObjectMeta: newOwnedMeta("bare", "", "")},
+		&corev1.Pod{ObjectMeta: newOwnedMeta("op-1", "Rollout", "op")},
+		&autoscalingv1.HorizontalPodAutoscaler{
+			ObjectMeta: newOwnedMeta("web-autoscaler", "", ""),
+			Spec: autoscalingv1.HorizontalPodAutoscalerSpec{
+				ScaleTargetRef: autoscalingv1.CrossVersionObjectReference{Kind: "Deployment", Name: "web"},
+			},
+		},
+	}
+	resolver := newOwnerResolver(fake.NewSimpleClientset(objects...))
+
+	tests := []struct {
+		kind, name string
+		expected   *Workload
+	}{
+		{"Pod", "web-5d4f8-abcde", &Workload{"Deployment", "web"}},
+		{"Pod", "db-0", &Workload{"StatefulSet", "db"}},
+		// the DaemonSet is gone, its reference still names the workload
+		{"Pod", "agent-x1", &Workload{"DaemonSet", "agent"}},
+		{"Pod", "bare", &Workload{"Pod", "bare"}},
+		{"Pod", "op-1", &Workload{"Rollout", "op"}},
+		{"HorizontalPodAutoscaler", "web-autoscaler", &Workload{"Deployment", "web"}},
+		// deleted pods fall back to the name
+		{"Pod", "api-7c9b6d-fghij", &Workload{"Deployment", "api"}},
+		{"Node", "node-1", nil},
+	}
+	for _, test := range tests {
+		got := resolver.Resolve(&corev1.ObjectReference{Kind: test.kind, Namespace: "default", Name: test.name})
+		if (got == nil) != (test.expected == nil) || (got != nil && *got != *test.expected) {
+			t.Errorf("%s/%s:\nexpected:\n%v\ngot:\n%v", test.kind, test.name, test.expected, got)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package events
+
+import (
+	"github.com/crain-cn/event-mesh/cmd/config"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/workqueue"
+	"sync"
+	"time"
+)
+
+// eventQueue is a bounded, rate limited queue between an informer and the
+// event handlers of one cluster.
+//
+// The workqueue holds event keys only; the latest ElEvent of each key waits in
+// pending. A key is never handled by two workers at once, so updates of the
+// same event are handled in order, and repeated updates that pile up while the
+// queue is busy collapse into the latest one.
+type eventQueue struct {
+	cluster string
+	opt     *config.EventQueueOpt
+	queue   workqueue.RateLimitingInterface
+
+	lock    sync.Mutex
+	pending map[string]*ElEvent
+}
+
+func newEventQueue(cluster string, opt *config.EventQueueOpt) *eventQueue {
+	registerQueueMetrics(prometheus.DefaultRegisterer)
+	return &eventQueue{
+		cluster: cluster,
+		opt:     opt,
+		queue:   workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), cluster),
+		pending: make(map[string]*ElEvent),
+	}
+}
+
+func eventKey(e *ElEvent) string {
+	if len(e.Event.UID) > 0 {
+		return string(e.Event.UID)
+	}
+	return e.Event.Namespace + "/" + e.Event.Name
+}
+
+// Enqueue adds the event unless the queue is saturated. Normal events are
+// shed first, at ShedNormalDepth; every event is shed at MaxDepth. The queue
+// marks every event it accepted done, including superseded ones.
+func (q *eventQueue) Enqueue(e *ElEvent) bool {
+	depth := q.queue.Len()
+	if depth >= q.opt.MaxDepth || (depth >= q.opt.ShedNormalDepth && e.Event.Type == EVENT_TYPE_NORMAL) {
+		eventsShed.WithLabelValues(q.cluster, e.Event.Type).Inc()
+		return false
+	}
+	key := eventKey(e)
+	q.lock.Lock()
+	if superseded, ok := q.pending[key]; ok {
+		superseded.done()
+	}
+	q.pending[key] = e
+	q.lock.Unlock()
+	q.queue.Add(key)
+	return true
+}
+
+// Run starts the workers and blocks until stopCh is closed.
+func (q *eventQueue) Run(stopCh <-chan struct{}) {
+	defer q.queue.ShutDown()
+	for i := 0; i < q.opt.Workers; i++ {
+		go wait.Until(q.runWorker, time.Second, stopCh)
+	}
+	<-stopCh
+}
+
+func (q *eventQueue) runWorker() {
+	for q.processNextItem() {
+	}
+}
+
+func (q *eventQueue) processNextItem() bool {
+	item, shutdown := q.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer q.queue.Done(item)
+
+	key := item.(string)
+	q.lock.Lock()
+	e, ok := q.pending[key]
+	delete(q.pending, key)
+	q.lock.Unlock()
+	if !ok {
+		q.queue.Forget(item)
+		return true
+	}
+
+	res := make(chan interface{}, 1)
+	e.Handle(res)
+	result := (<-res).(*EventResult)
+	if result.err == nil {
+		e.done()
+		q.queue.Forget(item)
+		return true
+	}
+
+	if q.queue.NumRequeues(item) < q.opt.MaxRetries {
+		q.lock.Lock()
+		// A newer version of the event supersedes the failed one.
+		if _, ok := q.pending[key]; !ok {
+			q.pending[key] = e
+		} else {
+			e.done()
+		}
+		q.lock.Unlock()
+		q.queue.AddRateLimited(item)
+		return true
+	}
+	log.WithFields(logrus.Fields{
+		"cluster": q.cluster,
+		"key":     key,
+	}).WithError(result.err).Error("dropping event after retries")
+	e.done()
+	q.queue.Forget(item)
+	return true
+}
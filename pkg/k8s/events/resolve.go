@@ -0,0 +1,342 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"github.com/crain-cn/event-mesh/cmd/config"
+	"github.com/prometheus/alertmanager/types"
+	common_model "github.com/prometheus/common/model"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"sync"
+	"time"
+)
+
+const (
+	// resolveCheckInterval is how often open problems are checked for
+	// readiness and expiry.
+	resolveCheckInterval = 30 * time.Second
+	// recoveryMemory is how long a recovery event is remembered for a problem
+	// whose alert is still waiting in the queue.
+	recoveryMemory     = 5 * time.Minute
+	defaultResolveWait = time.Hour
+	resolvedQueueSize  = 1000
+	readyCheckTimeout  = 5 * time.Second
+	// resolvedByReady is the resolved_by annotation of problems resolved by
+	// the Ready condition rather than an event.
+	resolvedByReady = "Ready"
+)
+
+// DefaultResolveRules are used when neither the cluster nor the config file
+// define resolve rules. Their recovery events are only seen when the watch
+// includes Normal events anyway: they do not widen it, and otherwise resolve
+// on Ready or time out.
+var DefaultResolveRules = []*config.ResolveRule{
+	{
+		Name:           "default-backoff-ready",
+		Kinds:          []string{"Pod"},
+		Reasons:        []string{"BackOff"},
+		ResolveOnReady: true,
+		Timeout:        defaultResolveWait,
+	},
+	{
+		Name:           "default-node-ready",
+		Kinds:          []string{"Node"},
+		Reasons:        []string{"NodeNotReady"},
+		ResolvedBy:     []string{"NodeReady"},
+		ResolveOnReady: true,
+		Timeout:        defaultResolveWait,
+	},
+	{
+		Name:       "default-scheduled",
+		Kinds:      []string{"Pod"},
+		Reasons:    []string{"FailedScheduling"},
+		ResolvedBy: []string{"Scheduled"},
+		Timeout:    defaultResolveWait,
+	},
+}
+
+// ResolveRulesFor returns the resolve rules of the cluster followed by the
+// global ones, or DefaultResolveRules when there are none.
+func ResolveRulesFor(configResolver *config.ConfigResolver, cluster string) []*config.ResolveRule {
+	rules := configResolver.GetEventResolveRules(cluster)
+	if len(rules) == 0 {
+		return DefaultResolveRules
+	}
+	return rules
+}
+
+type resolveRule struct {
+	name       string
+	kinds      stringSet
+	reasons    stringSet
+	resolvedBy stringSet
+	onReady    bool
+	timeout    time.Duration
+}
+
+// openProblem is an object whose alerts fire until it recovers. Each distinct
+// label set sent for it, e.g. after the severity rose, is resolved.
+type openProblem struct {
+	rule    *resolveRule
+	ref     corev1.ObjectReference
+	since   time.Time
+	expires time.Time
+	alerts  map[common_model.Fingerprint]*types.Alert
+}
+
+// eventResolver turns event alerts, which otherwise end as they start, into
+// alerts that fire until the object recovers. The recovery is sent through
+// the same route and pipeline as a resolved alert with the same labels, so
+// receivers with send_resolved see it.
+type eventResolver struct {
+	kc    kubernetes.Interface
+	rules []*resolveRule
+	send  func(*types.Alert)
+	// recoveries are the reasons resolving some rule
+	recoveries map[string]bool
+	// observing are the configured rules resolved by an event, which need
+	// the Normal events
+	observing []string
+	resolved  chan *types.Alert
+
+	lock      sync.Mutex
+	problems  map[string]*openProblem
+	recovered map[string]time.Time
+}
+
+func newEventResolver(kc kubernetes.Interface, rules []*config.ResolveRule, send func(*types.Alert)) (*eventResolver, error) {
+	r := &eventResolver{
+		kc:         kc,
+		send:       send,
+		recoveries: make(map[string]bool),
+		resolved:   make(chan *types.Alert, resolvedQueueSize),
+		problems:   make(map[string]*openProblem),
+		recovered:  make(map[string]time.Time),
+	}
+	for i, rule := range rules {
+		if len(rule.Reasons) == 0 {
+			return nil, fmt.Errorf("resolve rule %d %q: no reasons", i, rule.Name)
+		}
+		if len(rule.ResolvedBy) == 0 && !rule.ResolveOnReady {
+			return nil, fmt.Errorf("resolve rule %d %q: neither resolvedBy nor resolveOnReady", i, rule.Name)
+		}
+		compiled := &resolveRule{
+			name:       rule.Name,
+			kinds:      newStringSet(rule.Kinds),
+			reasons:    newStringSet(rule.Reasons),
+			resolvedBy: newStringSet(rule.ResolvedBy),
+			onReady:    rule.ResolveOnReady,
+			timeout:    rule.Timeout,
+		}
+		if len(compiled.name) == 0 {
+			compiled.name = fmt.Sprintf("rule-%d", i)
+		}
+		if compiled.timeout <= 0 {
+			compiled.timeout = defaultResolveWait
+		}
+		for reason := range compiled.resolvedBy {
+			r.recoveries[reason] = true
+		}
+		if len(compiled.resolvedBy) > 0 && !isDefaultResolveRule(rule) {
+			r.observing = append(r.observing, compiled.name)
+		}
+		r.rules = append(r.rules, compiled)
+	}
+	return r, nil
+}
+
+func objectKey(ref *corev1.ObjectReference) string {
+	return ref.Kind + "/" + ref.Namespace + "/" + ref.Name
+}
+
+func isDefaultResolveRule(rule *config.ResolveRule) bool {
+	for _, d := range DefaultResolveRules {
+		if d == rule {
+			return true
+		}
+	}
+	return false
+}
+
+// ObservingRules returns the configured rules resolved by an event. Those
+// are mostly Normal events, so the watch must not be limited to Warning.
+func (r *eventResolver) ObservingRules() []string {
+	if r == nil {
+		return nil
+	}
+	return r.observing
+}
+
+// Track makes the alert of a problem event fire until the object recovers or
+// the rule times out. Alerts of other events are left alone.
+func (r *eventResolver) Track(event *corev1.Event, alert *types.Alert) {
+	if r == nil {
+		return
+	}
+	ref := &event.InvolvedObject
+	var rule *resolveRule
+	for _, candidate := range r.rules {
+		if candidate.reasons.has(event.Reason) && candidate.kinds.match(ref.Kind) {
+			rule = candidate
+			break
+		}
+	}
+	if rule == nil {
+		return
+	}
+	alert.EndsAt = alert.StartsAt.Add(rule.timeout)
+	tracked := *alert
+
+	key := objectKey(ref) + "/" + rule.name
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	p, ok := r.problems[key]
+	if !ok {
+		p = &openProblem{
+			rule:   rule,
+			ref:    *ref,
+			since:  alert.StartsAt,
+			alerts: make(map[common_model.Fingerprint]*types.Alert),
+		}
+		r.problems[key] = p
+	}
+	p.expires = alert.EndsAt
+	p.alerts[alert.Fingerprint()] = &tracked
+
+	// the recovery can be watched before the queue gets to the problem
+	for reason := range rule.resolvedBy {
+		if at, ok := r.recovered[objectKey(ref)+"/"+reason]; ok && !at.Before(alert.StartsAt) {
+			r.resolveLocked(key, p, reason, at)
+			return
+		}
+	}
+}
+
+// Observe resolves the open problems of the object of a recovery event. It
+// sees the events before they are filtered, as recoveries are rarely kept.
+func (r *eventResolver) Observe(event *corev1.Event) {
+	if r == nil || !r.recoveries[event.Reason] {
+		return
+	}
+	ref := &event.InvolvedObject
+	at := eventTime(event).Local()
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.recovered[objectKey(ref)+"/"+event.Reason] = at
+	for _, rule := range r.rules {
+		if !rule.resolvedBy.has(event.Reason) || !rule.kinds.match(ref.Kind) {
+			continue
+		}
+		key := objectKey(ref) + "/" + rule.name
+		if p, ok := r.problems[key]; ok && !at.Before(p.since) {
+			r.resolveLocked(key, p, event.Reason, at)
+		}
+	}
+}
+
+// resolveLocked queues the resolved alerts of the problem. The queue is sent
+// by Run, away from the watch and the queue workers.
+func (r *eventResolver) resolveLocked(key string, p *openProblem, by string, at time.Time) {
+	delete(r.problems, key)
+	if now := time.Now(); at.After(now) {
+		at = now
+	}
+	for _, alert := range p.alerts {
+		resolved := *alert
+		resolved.Annotations = alert.Annotations.Clone()
+		resolved.Annotations["resolved_by"] = common_model.LabelValue(by)
+		resolved.EndsAt = at
+		if resolved.EndsAt.Before(resolved.StartsAt) {
+			resolved.EndsAt = resolved.StartsAt
+		}
+		select {
+		case r.resolved <- &resolved:
+		default:
+			log.Warning("resolved alert queue full, dropping: ", key)
+		}
+	}
+	log.Debug("problem resolved by ", by, ": ", key)
+}
+
+// Run sends the resolved alerts and checks the open problems until stopCh is
+// closed.
+func (r *eventResolver) Run(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(resolveCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case alert := <-r.resolved:
+			r.send(alert)
+		case <-ticker.C:
+			r.check(time.Now())
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+// check forgets the problems that timed out, their alerts end on their own,
+// and resolves the ones whose pod or node is Ready again.
+func (r *eventResolver) check(now time.Time) {
+	waiting := make(map[string]*openProblem)
+	r.lock.Lock()
+	for key, p := range r.problems {
+		switch {
+		case now.After(p.expires):
+			delete(r.problems, key)
+		case p.rule.onReady:
+			waiting[key] = p
+		}
+	}
+	for key, at := range r.recovered {
+		if now.Sub(at) > recoveryMemory {
+			delete(r.recovered, key)
+		}
+	}
+	r.lock.Unlock()
+
+	for key, p := range waiting {
+		if !r.ready(&p.ref) {
+			continue
+		}
+		r.lock.Lock()
+		// a recovery event may have come first
+		if r.problems[key] == p {
+			r.resolveLocked(key, p, resolvedByReady, now)
+		}
+		r.lock.Unlock()
+	}
+}
+
+// ready reports whether the pod or node has the Ready condition. Other kinds
+// and failed lookups are not ready.
+func (r *eventResolver) ready(ref *corev1.ObjectReference) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), readyCheckTimeout)
+	defer cancel()
+	switch ref.Kind {
+	case "Pod":
+		pod, err := r.kc.CoreV1().Pods(ref.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+		if err != nil {
+			return false
+		}
+		for _, c := range pod.Status.Conditions {
+			if c.Type == corev1.PodReady {
+				return c.Status == corev1.ConditionTrue
+			}
+		}
+	case "Node":
+		node, err := r.kc.CoreV1().Nodes().Get(ctx, ref.Name, metav1.GetOptions{})
+		if err != nil {
+			return false
+		}
+		for _, c := range node.Status.Conditions {
+			if c.Type == corev1.NodeReady {
+				return c.Status == corev1.ConditionTrue
+			}
+		}
+	}
+	return false
+}
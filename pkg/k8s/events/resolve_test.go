@@ -0,0 +1,157 @@
+package events
+
+import (
+	"github.com/crain-cn/event-mesh/cmd/config"
+	"github.com/prometheus/alertmanager/types"
+	common_model "github.com/prometheus/common/model"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func newResolveTestAlert(event *corev1.Event, startsAt time.Time) *types.Alert {
+	return &types.Alert{Alert: common_model.Alert{
+		Labels: common_model.LabelSet{
+			"obj_name":     common_model.LabelValue(event.InvolvedObject.Name),
+			"event_reason": common_model.LabelValue(event.Reason),
+		},
+		Annotations: common_model.LabelSet{"message": common_model.LabelValue(event.Message)},
+		StartsAt:    startsAt,
+		EndsAt:      startsAt,
+	}}
+}
+
+func newResolveTestEvent(eventType, reason, kind, name string, at time.Time) *corev1.Event {
+	event := newTestEvent(eventType, reason, "kubelet", kind, "shop", name, "")
+	event.LastTimestamp = metav1.NewTime(at)
+	return event
+}
+
+func resolvedAlerts(r *eventResolver) []*types.Alert {
+	var alerts []*types.Alert
+	for {
+		select {
+		case alert := <-r.resolved:
+			alerts = append(alerts, alert)
+		default:
+			return alerts
+		}
+	}
+}
+
+func TestEventResolver(t *testing.T) {
+	kc := fake.NewSimpleClientset(&corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "web-1", Namespace: "shop"},
+		Status: corev1.PodStatus{Conditions: []corev1.PodCondition{
+			{Type: corev1.PodReady, Status: corev1.ConditionTrue},
+		}},
+	})
+	r, err := newEventResolver(kc, DefaultResolveRules, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the default rules do not widen the watch to the Normal events
+	if got := r.ObservingRules(); len(got) != 0 {
+		t.Errorf("\nexpected:\n%v\ngot:\n%v", nil, got)
+	}
+	configured, err := newEventResolver(kc, []*config.ResolveRule{
+		{Name: "scheduled", Kinds: []string{"Pod"}, Reasons: []string{"FailedScheduling"}, ResolvedBy: []string{"Scheduled"}},
+		{Name: "ready", Kinds: []string{"Pod"}, Reasons: []string{"Unhealthy"}, ResolveOnReady: true},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := configured.ObservingRules(); !reflect.DeepEqual(got, []string{"scheduled"}) {
+		t.Errorf("\nexpected:\n%v\ngot:\n%v", []string{"scheduled"}, got)
+	}
+	start := time.Now().Add(-10 * time.Minute).Truncate(time.Second)
+
+	// FailedScheduling fires until Scheduled
+	problem := newResolveTestEvent("Warning", "FailedScheduling", "Pod", "web-2", start)
+	alert := newResolveTestAlert(problem, start)
+	r.Track(problem, alert)
+	if expected := start.Add(defaultResolveWait); !alert.EndsAt.Equal(expected) {
+		t.Errorf("\nexpected:\n%v\ngot:\n%v", expected, alert.EndsAt)
+	}
+	r.Observe(newResolveTestEvent("Normal", "Scheduled", "Pod", "web-3", start.Add(time.Minute)))
+	if got := resolvedAlerts(r); len(got) != 0 {
+		t.Errorf("another pod:\nexpected:\n%v\ngot:\n%v", 0, len(got))
+	}
+	r.Observe(newResolveTestEvent("Normal", "Scheduled", "Pod", "web-2", start.Add(time.Minute)))
+	got := resolvedAlerts(r)
+	if len(got) != 1 {
+		t.Fatalf("\nexpected:\n%v\ngot:\n%v", 1, len(got))
+	}
+	if !got[0].Resolved() || !got[0].EndsAt.Equal(start.Add(time.Minute)) {
+		t.Errorf("\nexpected:\n%v\ngot:\n%v", start.Add(time.Minute), got[0].EndsAt)
+	}
+	if by := got[0].Annotations["resolved_by"]; by != "Scheduled" {
+		t.Errorf("\nexpected:\n%v\ngot:\n%v", "Scheduled", by)
+	}
+	if got[0].Fingerprint() != alert.Fingerprint() {
+		t.Errorf("\nexpected:\n%v\ngot:\n%v", alert.Labels, got[0].Labels)
+	}
+
+	// a recovery watched before the queue tracks the problem resolves it
+	node := newResolveTestEvent("Warning", "NodeNotReady", "Node", "node-1", start)
+	r.Observe(newResolveTestEvent("Normal", "NodeReady", "Node", "node-1", start.Add(time.Minute)))
+	r.Track(node, newResolveTestAlert(node, start))
+	if got := resolvedAlerts(r); len(got) != 1 {
+		t.Errorf("\nexpected:\n%v\ngot:\n%v", 1, len(got))
+	}
+
+	// BackOff resolves once the pod is Ready
+	backoff := newResolveTestEvent("Warning", "BackOff", "Pod", "web-1", start)
+	r.Track(backoff, newResolveTestAlert(backoff, start))
+	r.check(time.Now())
+	got = resolvedAlerts(r)
+	if len(got) != 1 || got[0].Annotations["resolved_by"] != resolvedByReady {
+		t.Errorf("\nexpected:\n%v\ngot:\n%v", resolvedByReady, got)
+	}
+
+	// timed out problems are forgotten
+	r.Track(problem, newResolveTestAlert(problem, start))
+	r.check(start.Add(2 * defaultResolveWait))
+	r.Observe(newResolveTestEvent("Normal", "Scheduled", "Pod", "web-2", start.Add(time.Minute)))
+	if got := resolvedAlerts(r); len(got) != 0 {
+		t.Errorf("timed out:\nexpected:\n%v\ngot:\n%v", 0, len(got))
+	}
+
+	// other events end as they start
+	other := newResolveTestEvent("Warning", "FailedMount", "Pod", "web-1", start)
+	alert = newResolveTestAlert(other, start)
+	r.Track(other, alert)
+	if !alert.EndsAt.Equal(start) {
+		t.Errorf("\nexpected:\n%v\ngot:\n%v", start, alert.EndsAt)
+	}
+}
+
+func TestEventResolverRules(t *testing.T) {
+	invalid := [][]*config.ResolveRule{
+		{{Name: "no-reasons", ResolvedBy: []string{"Scheduled"}}},
+		{{Name: "no-recovery", Reasons: []string{"FailedScheduling"}}},
+	}
+	for _, rules := range invalid {
+		if _, err := newEventResolver(nil, rules, nil); err == nil {
+			t.Errorf("%s:\nexpected:\nan error\ngot:\n%v", rules[0].Name, err)
+		}
+	}
+
+	configResolver := &config.ConfigResolver{
+		EventSinks: []*config.EventSinks{{
+			Cluster:  "prod",
+			Resolves: []*config.ResolveRule{{Name: "cluster"}},
+		}},
+		EventResolveRules: []*config.ResolveRule{{Name: "global"}},
+	}
+	rules := ResolveRulesFor(configResolver, "prod")
+	if len(rules) != 2 || rules[0].Name != "cluster" || rules[1].Name != "global" {
+		t.Errorf("\nexpected:\n%v\ngot:\n%v", "[cluster global]", rules)
+	}
+	if rules := ResolveRulesFor(&config.ConfigResolver{}, "prod"); len(rules) != len(DefaultResolveRules) {
+		t.Errorf("\nexpected:\n%v\ngot:\n%v", DefaultResolveRules, rules)
+	}
+}
@@ -23,6 +23,11 @@ type EventRouteManager struct {
 	listerSyncedEventRoute bool
 	stopChReceiver         chan struct{}
 	stopChEventRoute       chan struct{}
+
+	// standby is set while another replica leads, which alone writes the
+	// config; lock guards it.
+	lock    sync.Mutex
+	standby bool
 }
 
 func NewEventRouteManager(clientConfig *rest.Config) *EventRouteManager {
@@ -204,7 +209,24 @@ func (s *EventRouteManager) DeleteEventRoute(eventroute *eventmeshv1.EventRoute)
 	return nil
 }
 
+// SetLeading writes the config when leading. A replica that does not lead
+// keeps its informers in sync, to write the config at once when it leads.
+func (s *EventRouteManager) SetLeading(leading bool) {
+	s.lock.Lock()
+	s.standby = !leading
+	s.lock.Unlock()
+	if leading && s.listerSyncedEventRoute && s.listerSyncedReceiver {
+		s.GeneratorConfig()
+	}
+}
+
 func (s *EventRouteManager) GeneratorConfig() error {
+	s.lock.Lock()
+	standby := s.standby
+	s.lock.Unlock()
+	if standby {
+		return nil
+	}
 	yaml, err := s.cfgGenerator.generateYaml()
 	if err != nil {
 		log.Info("generateYaml", err)
@@ -0,0 +1,75 @@
+package events
+
+import (
+	"fmt"
+	"github.com/crain-cn/event-mesh/cmd/config"
+	v1 "k8s.io/api/core/v1"
+	"time"
+)
+
+type severityRule struct {
+	match       *filterRule
+	severity    string
+	minCount    int32
+	minDuration time.Duration
+}
+
+// severityClassifier maps events to the critical, warning and info
+// severities routes and inhibit rules expect. Events matching no rule get the
+// severity of their type.
+type severityClassifier struct {
+	rules []*severityRule
+}
+
+func newSeverityClassifier(rules []*config.SeverityRule) (*severityClassifier, error) {
+	c := &severityClassifier{}
+	for _, in := range rules {
+		switch in.Severity {
+		case config.SeverityCritical, config.SeverityWarning, config.SeverityInfo:
+		default:
+			return nil, fmt.Errorf("severity rule %q: invalid severity %q", in.Name, in.Severity)
+		}
+		matchRule := in.FilterRule
+		matchRule.Action = config.FilterActionInclude
+		match, err := compileFilterRule(&matchRule)
+		if err != nil {
+			return nil, err
+		}
+		c.rules = append(c.rules, &severityRule{
+			match:       match,
+			severity:    in.Severity,
+			minCount:    in.MinCount,
+			minDuration: in.MinDuration,
+		})
+	}
+	return c, nil
+}
+
+// Classify returns the severity of the event, given how often and for how
+// long it was seen.
+func (c *severityClassifier) Classify(event *v1.Event, occurrence *eventOccurrence) string {
+	for _, r := range c.rules {
+		if !r.match.match(event) {
+			continue
+		}
+		if r.minCount > 0 && occurrence.Count < r.minCount {
+			continue
+		}
+		if r.minDuration > 0 && occurrence.LastSeen.Sub(occurrence.FirstSeen) < r.minDuration {
+			continue
+		}
+		return r.severity
+	}
+	return typeSeverity(event.Type)
+}
+
+func typeSeverity(eventType string) string {
+	switch eventType {
+	case EVENT_TYPE_NORMAL:
+		return config.SeverityInfo
+	case EVENT_TYPE_ERROR:
+		return config.SeverityCritical
+	default:
+		return config.SeverityWarning
+	}
+}
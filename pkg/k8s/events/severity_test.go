@@ -0,0 +1,67 @@
+package events
+
+import (
+	"github.com/crain-cn/event-mesh/cmd/config"
+	"gopkg.in/yaml.v2"
+	"testing"
+	"time"
+)
+
+func TestSeverityClassifier(t *testing.T) {
+	var rules []*config.SeverityRule
+	data := `
+- name: prod-unschedulable
+  reasons: [FailedScheduling]
+  namespaceRegex: ".*-prod"
+  minDuration: 10m
+  severity: critical
+- name: crashloop
+  reasons: [BackOff]
+  minCount: 5
+  severity: critical
+- name: noisy-probes
+  reasons: [Unhealthy]
+  messageRegex: "Readiness probe"
+  severity: info
+`
+	if err := yaml.Unmarshal([]byte(data), &rules); err != nil {
+		t.Fatal(err)
+	}
+	c, err := newSeverityClassifier(rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	seen := func(count int32, d time.Duration) *eventOccurrence {
+		return &eventOccurrence{Count: count, FirstSeen: now.Add(-d), LastSeen: now}
+	}
+	tests := []struct {
+		name       string
+		eventType  string
+		reason     string
+		namespace  string
+		message    string
+		occurrence *eventOccurrence
+		expected   string
+	}{
+		{"pending in prod", "Warning", "FailedScheduling", "shop-prod", "", seen(3, 15*time.Minute), config.SeverityCritical},
+		{"pending briefly", "Warning", "FailedScheduling", "shop-prod", "", seen(3, time.Minute), config.SeverityWarning},
+		{"pending in test", "Warning", "FailedScheduling", "shop-test", "", seen(3, 15*time.Minute), config.SeverityWarning},
+		{"crash looping", "Warning", "BackOff", "shop", "", seen(5, 0), config.SeverityCritical},
+		{"first crash", "Warning", "BackOff", "shop", "", seen(1, 0), config.SeverityWarning},
+		{"readiness", "Warning", "Unhealthy", "shop", "Readiness probe failed", seen(1, 0), config.SeverityInfo},
+		{"liveness", "Warning", "Unhealthy", "shop", "Liveness probe failed", seen(1, 0), config.SeverityWarning},
+		{"normal", "Normal", "Killing", "shop", "", seen(1, 0), config.SeverityInfo},
+	}
+	for _, test := range tests {
+		event := newTestEvent(test.eventType, test.reason, "kubelet", "Pod", test.namespace, "web-1", test.message)
+		if got := c.Classify(event, test.occurrence); got != test.expected {
+			t.Errorf("%s:\nexpected:\n%v\ngot:\n%v", test.name, test.expected, got)
+		}
+	}
+
+	if _, err := newSeverityClassifier([]*config.SeverityRule{{Severity: "page"}}); err == nil {
+		t.Errorf("\nexpected:\nan error\ngot:\n%v", err)
+	}
+}
@@ -0,0 +1,103 @@
+package events
+
+import (
+	"context"
+	"github.com/crain-cn/event-mesh/cmd/config"
+	corev1 "k8s.io/api/core/v1"
+	eventsv1 "k8s.io/api/events/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+)
+
+// eventSource lists and watches the events of a cluster, in one namespace or
+// in all of them. Whatever the API, the events come out as core/v1 events.
+type eventSource interface {
+	List(ctx context.Context, namespace string, opts metav1.ListOptions) (runtime.Object, error)
+	Watch(ctx context.Context, namespace string, opts metav1.ListOptions) (watch.Interface, error)
+	Name() string
+}
+
+// newEventSource returns the source configured for the cluster. The auto
+// source asks discovery whether events.k8s.io/v1 is served.
+func newEventSource(kc kubernetes.Interface, source string) eventSource {
+	switch source {
+	case config.EventSourceEventsV1:
+		return &eventsV1Source{kc: kc}
+	case config.EventSourceCoreV1:
+		return &coreV1Source{kc: kc}
+	}
+	if source != config.EventSourceAuto {
+		log.Warning("unknown event source, using auto: ", source)
+	}
+	if eventsV1Served(kc) {
+		return &eventsV1Source{kc: kc}
+	}
+	return &coreV1Source{kc: kc}
+}
+
+func eventsV1Served(kc kubernetes.Interface) bool {
+	resources, err := kc.Discovery().ServerResourcesForGroupVersion(eventsv1.SchemeGroupVersion.String())
+	if err != nil {
+		return false
+	}
+	for _, r := range resources.APIResources {
+		if r.Name == "events" {
+			return true
+		}
+	}
+	return false
+}
+
+type coreV1Source struct {
+	kc kubernetes.Interface
+}
+
+func (s *coreV1Source) Name() string {
+	return config.EventSourceCoreV1
+}
+
+func (s *coreV1Source) List(ctx context.Context, namespace string, opts metav1.ListOptions) (runtime.Object, error) {
+	return s.kc.CoreV1().Events(namespace).List(ctx, opts)
+}
+
+func (s *coreV1Source) Watch(ctx context.Context, namespace string, opts metav1.ListOptions) (watch.Interface, error) {
+	return s.kc.CoreV1().Events(namespace).Watch(ctx, opts)
+}
+
+type eventsV1Source struct {
+	kc kubernetes.Interface
+}
+
+func (s *eventsV1Source) Name() string {
+	return config.EventSourceEventsV1
+}
+
+func (s *eventsV1Source) List(ctx context.Context, namespace string, opts metav1.ListOptions) (runtime.Object, error) {
+	list, err := s.kc.EventsV1().Events(namespace).List(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	out := &corev1.EventList{
+		ListMeta: list.ListMeta,
+		Items:    make([]corev1.Event, 0, len(list.Items)),
+	}
+	for i := range list.Items {
+		out.Items = append(out.Items, *EventsV1ToCore(&list.Items[i]))
+	}
+	return out, nil
+}
+
+func (s *eventsV1Source) Watch(ctx context.Context, namespace string, opts metav1.ListOptions) (watch.Interface, error) {
+	w, err := s.kc.EventsV1().Events(namespace).Watch(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return watch.Filter(w, func(in watch.Event) (watch.Event, bool) {
+		if event, ok := in.Object.(*eventsv1.Event); ok {
+			in.Object = EventsV1ToCore(event)
+		}
+		return in, true
+	}), nil
+}
@@ -0,0 +1,355 @@
+package events
+
+import (
+	"fmt"
+	"github.com/crain-cn/event-mesh/cmd/config"
+	"github.com/crain-cn/event-mesh/pkg/owner"
+	"github.com/crain-cn/event-mesh/pkg/provider"
+	"github.com/crain-cn/event-mesh/pkg/reason"
+	"github.com/prometheus/alertmanager/types"
+	common_model "github.com/prometheus/common/model"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"strconv"
+	"time"
+)
+
+const (
+	// stateAlertLifetimes is how many intervals an alert fires without being
+	// put again, so the alerts of a stopped watcher end on their own.
+	stateAlertLifetimes = 3
+
+	StateReasonOOMKilled    = "OOMKilled"
+	StateReasonNodeNotReady = "NodeNotReady"
+	StateReasonClaimPending = "ClaimPending"
+	StateReasonClaimLost    = "ClaimLost"
+)
+
+// stateProblem is an object in a state worth an alert for as long as it lasts.
+type stateProblem struct {
+	ref       corev1.ObjectReference
+	host      string
+	container string
+	reason    string
+	severity  string
+	// since is when the state began, zero when the object does not tell.
+	since       time.Time
+	message     string
+	annotations map[string]string
+}
+
+// StateWatcher alerts on the state of pods, nodes and PVCs of a cluster, for
+// the incidents that emit no useful event. Alerts are put into the alert
+// provider with the labels of event alerts, fire while the state lasts and
+// are resolved when it ends.
+type StateWatcher struct {
+	StopCh chan struct{}
+
+	cluster  string
+	opt      *config.StateWatchOpt
+	alerts   provider.Alerts
+	reasons  *reason.Dictionary
+	owners   *ownerResolver
+	mentions *ownerMentions
+	factory  informers.SharedInformerFactory
+	pods     corelisters.PodLister
+	nodes    corelisters.NodeLister
+	pvcs     corelisters.PersistentVolumeClaimLister
+	waiting  stringSet
+	nodeCond stringSet
+	// firing are the alerts put on the last evaluation
+	firing map[common_model.Fingerprint]*types.Alert
+}
+
+// NewStateWatcher starts the state watchers enabled by opt.
+func NewStateWatcher(directory *owner.Directory, reasons *reason.Dictionary, configResolver *config.ConfigResolver, opt *config.StateWatchOpt, cluster string, kc kubernetes.Interface, alerts provider.Alerts) *StateWatcher {
+	log.Info("NewStateWatcher:", cluster)
+	alerts = withClusterLabels(alerts, configResolver.GetClusterPolicy(cluster).Labels)
+	w := newStateWatcher(reasons, opt, cluster, kc, alerts)
+	w.mentions = newOwnerMentions(kc, directory, configResolver.GetOwnerDirectoryOpt())
+	go w.owners.Run(w.StopCh)
+	go w.mentions.Run(w.StopCh)
+	go w.run()
+	return w
+}
+
+func newStateWatcher(reasons *reason.Dictionary, opt *config.StateWatchOpt, cluster string, kc kubernetes.Interface, alerts provider.Alerts) *StateWatcher {
+	w := &StateWatcher{
+		StopCh:   make(chan struct{}),
+		cluster:  cluster,
+		opt:      opt,
+		alerts:   alerts,
+		reasons:  reasons,
+		owners:   newOwnerResolver(kc),
+		factory:  informers.NewSharedInformerFactory(kc, 0),
+		waiting:  newStringSet(opt.WaitingReasons),
+		nodeCond: newStringSet(opt.NodeConditions),
+		firing:   make(map[common_model.Fingerprint]*types.Alert),
+	}
+	if opt.Pods {
+		w.pods = w.factory.Core().V1().Pods().Lister()
+	}
+	if opt.Nodes {
+		w.nodes = w.factory.Core().V1().Nodes().Lister()
+	}
+	if opt.PVCs {
+		w.pvcs = w.factory.Core().V1().PersistentVolumeClaims().Lister()
+	}
+	return w
+}
+
+func (w *StateWatcher) Stop() {
+	close(w.StopCh)
+}
+
+// run evaluates the states every interval once the informers synced.
+func (w *StateWatcher) run() {
+	w.factory.Start(w.StopCh)
+	for informer, synced := range w.factory.WaitForCacheSync(w.StopCh) {
+		if !synced {
+			log.Error("state informer not synced: ", w.cluster, " ", informer)
+			return
+		}
+	}
+	ticker := time.NewTicker(w.opt.Interval)
+	defer ticker.Stop()
+	for {
+		now := time.Now()
+		w.update(now, w.collect(now))
+		select {
+		case <-ticker.C:
+		case <-w.StopCh:
+			return
+		}
+	}
+}
+
+// collect lists the problems of the watched objects.
+func (w *StateWatcher) collect(now time.Time) []*stateProblem {
+	var problems []*stateProblem
+	if w.pods != nil {
+		pods, err := w.pods.List(labels.Everything())
+		if err != nil {
+			log.WithError(err).Error("list pods: ", w.cluster)
+		}
+		for _, pod := range pods {
+			problems = append(problems, w.podProblems(pod, now)...)
+		}
+	}
+	if w.nodes != nil {
+		nodes, err := w.nodes.List(labels.Everything())
+		if err != nil {
+			log.WithError(err).Error("list nodes: ", w.cluster)
+		}
+		for _, node := range nodes {
+			problems = append(problems, w.nodeProblems(node)...)
+		}
+	}
+	if w.pvcs != nil {
+		pvcs, err := w.pvcs.List(labels.Everything())
+		if err != nil {
+			log.WithError(err).Error("list persistentvolumeclaims: ", w.cluster)
+		}
+		for _, pvc := range pvcs {
+			if p := w.pvcProblem(pvc, now); p != nil {
+				problems = append(problems, p)
+			}
+		}
+	}
+	return problems
+}
+
+func (w *StateWatcher) podProblems(pod *corev1.Pod, now time.Time) []*stateProblem {
+	ref := corev1.ObjectReference{Kind: "Pod", Namespace: pod.Namespace, Name: pod.Name, UID: pod.UID}
+	var problems []*stateProblem
+	statuses := append(append([]corev1.ContainerStatus(nil), pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, status := range statuses {
+		// a container restarted after the OOM kill has it as its last state
+		terminated := status.State.Terminated
+		if terminated == nil {
+			terminated = status.LastTerminationState.Terminated
+		}
+		annotations := map[string]string{
+			"container":     status.Name,
+			"restart_count": strconv.Itoa(int(status.RestartCount)),
+		}
+		if terminated != nil {
+			annotations["exit_code"] = strconv.Itoa(int(terminated.ExitCode))
+			annotations["exit_reason"] = terminated.Reason
+		}
+		if terminated != nil && terminated.Reason == StateReasonOOMKilled && now.Sub(terminated.FinishedAt.Time) < w.opt.OOMKilledFor {
+			problems = append(problems, &stateProblem{
+				ref:         ref,
+				host:        pod.Spec.NodeName,
+				container:   status.Name,
+				reason:      StateReasonOOMKilled,
+				severity:    config.SeverityCritical,
+				since:       terminated.FinishedAt.Time,
+				message:     fmt.Sprintf("container %s was OOMKilled, memory limit %s", status.Name, memoryLimit(pod, status.Name)),
+				annotations: annotations,
+			})
+		}
+		if waiting := status.State.Waiting; waiting != nil && w.waiting.has(waiting.Reason) {
+			problems = append(problems, &stateProblem{
+				ref:         ref,
+				host:        pod.Spec.NodeName,
+				container:   status.Name,
+				reason:      waiting.Reason,
+				severity:    config.SeverityWarning,
+				message:     waiting.Message,
+				annotations: annotations,
+			})
+		}
+	}
+	return problems
+}
+
+func memoryLimit(pod *corev1.Pod, container string) string {
+	for _, c := range append(append([]corev1.Container(nil), pod.Spec.InitContainers...), pod.Spec.Containers...) {
+		if c.Name != container {
+			continue
+		}
+		if limit, ok := c.Resources.Limits[corev1.ResourceMemory]; ok {
+			return limit.String()
+		}
+	}
+	return "none"
+}
+
+// nodeProblems are the configured conditions that are True, and Ready when it
+// is not.
+func (w *StateWatcher) nodeProblems(node *corev1.Node) []*stateProblem {
+	ref := corev1.ObjectReference{Kind: "Node", Name: node.Name, UID: node.UID}
+	var problems []*stateProblem
+	for _, c := range node.Status.Conditions {
+		if !w.nodeCond.has(string(c.Type)) {
+			continue
+		}
+		p := &stateProblem{
+			ref:     ref,
+			host:    node.Name,
+			since:   c.LastTransitionTime.Time,
+			message: c.Message,
+		}
+		switch {
+		case c.Type == corev1.NodeReady && c.Status != corev1.ConditionTrue:
+			p.reason, p.severity = StateReasonNodeNotReady, config.SeverityCritical
+		case c.Type != corev1.NodeReady && c.Status == corev1.ConditionTrue:
+			p.reason, p.severity = string(c.Type), config.SeverityWarning
+		default:
+			continue
+		}
+		problems = append(problems, p)
+	}
+	return problems
+}
+
+// pvcProblem is a PVC Pending for longer than PendingFor, or Lost.
+func (w *StateWatcher) pvcProblem(pvc *corev1.PersistentVolumeClaim, now time.Time) *stateProblem {
+	p := &stateProblem{
+		ref:   corev1.ObjectReference{Kind: "PersistentVolumeClaim", Namespace: pvc.Namespace, Name: pvc.Name, UID: pvc.UID},
+		since: pvc.CreationTimestamp.Time,
+	}
+	storageClass := "default"
+	if pvc.Spec.StorageClassName != nil {
+		storageClass = *pvc.Spec.StorageClassName
+	}
+	switch pvc.Status.Phase {
+	case corev1.ClaimPending:
+		if now.Sub(pvc.CreationTimestamp.Time) < w.opt.PendingFor {
+			return nil
+		}
+		p.reason, p.severity = StateReasonClaimPending, config.SeverityWarning
+		p.message = fmt.Sprintf("persistentvolumeclaim pending for %s, storage class %s", now.Sub(p.since).Round(time.Second), storageClass)
+	case corev1.ClaimLost:
+		p.reason, p.severity = StateReasonClaimLost, config.SeverityCritical
+		p.message = fmt.Sprintf("persistentvolumeclaim lost its volume %s", pvc.Spec.VolumeName)
+		p.since = time.Time{}
+	default:
+		return nil
+	}
+	return p
+}
+
+// update puts the alerts of the problems, firing until a few intervals from
+// now, and resolves the alerts whose problem is gone.
+func (w *StateWatcher) update(now time.Time, problems []*stateProblem) {
+	firing := make(map[common_model.Fingerprint]*types.Alert, len(problems))
+	var alerts []*types.Alert
+	for _, p := range problems {
+		alert := w.alert(p, now)
+		fp := alert.Fingerprint()
+		if last, ok := w.firing[fp]; ok {
+			alert.StartsAt = last.StartsAt
+		}
+		firing[fp] = alert
+		alerts = append(alerts, alert)
+	}
+	for fp, last := range w.firing {
+		if _, ok := firing[fp]; ok {
+			continue
+		}
+		resolved := *last
+		resolved.EndsAt = now
+		resolved.UpdatedAt = now
+		alerts = append(alerts, &resolved)
+	}
+	w.firing = firing
+	if len(alerts) == 0 {
+		return
+	}
+	if err := w.alerts.Put(alerts...); err != nil {
+		log.WithError(err).Error("put state alerts: ", w.cluster)
+	}
+}
+
+func (w *StateWatcher) alert(p *stateProblem, now time.Time) *types.Alert {
+	labelSet := objectLabels(w.cluster, &p.ref, p.host)
+	labelSet["severity"] = common_model.LabelValue(p.severity)
+	labelSet["event_type"] = EVENT_TYPE_WARRNIGN
+	labelSet["event_reason"] = common_model.LabelValue(p.reason)
+	if len(p.container) > 0 {
+		labelSet["container"] = common_model.LabelValue(p.container)
+	}
+	info := w.reasons.Lookup(p.reason)
+	var cnReason string
+	if info != nil {
+		cnReason = info.Label
+		if len(info.Class) > 0 {
+			labelSet["reason_class"] = common_model.LabelValue(info.Class)
+		}
+	}
+	labelSet["cn_reason"] = common_model.LabelValue(cnReason)
+	var workload *Workload
+	if p.ref.Kind == "Pod" && w.owners != nil {
+		workload = w.owners.Resolve(&p.ref)
+	}
+	addOwnerLabels(labelSet, w.mentions, p.ref.Namespace, workload)
+
+	annotations := common_model.LabelSet{
+		"message": common_model.LabelValue(p.message),
+	}
+	if info != nil && len(info.Doc) > 0 {
+		annotations["reason_doc"] = common_model.LabelValue(info.Doc)
+	}
+	for name, value := range p.annotations {
+		annotations[common_model.LabelName(name)] = common_model.LabelValue(value)
+	}
+
+	startsAt := p.since
+	if startsAt.IsZero() || startsAt.After(now) {
+		startsAt = now
+	}
+	return &types.Alert{
+		Alert: common_model.Alert{
+			Labels:      labelSet,
+			Annotations: annotations,
+			StartsAt:    startsAt,
+			EndsAt:      now.Add(stateAlertLifetimes * w.opt.Interval),
+		},
+		UpdatedAt: now,
+	}
+}
@@ -0,0 +1,186 @@
+package events
+
+import (
+	"github.com/crain-cn/event-mesh/cmd/config"
+	"github.com/crain-cn/event-mesh/pkg/provider"
+	"github.com/prometheus/alertmanager/types"
+	common_model "github.com/prometheus/common/model"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+type putAlerts struct {
+	provider.Alerts
+	put []*types.Alert
+}
+
+func (a *putAlerts) Put(alerts ...*types.Alert) error {
+	a.put = append(a.put, alerts...)
+	return nil
+}
+
+func stateReasons(alerts []*types.Alert, at time.Time) []string {
+	var reasons []string
+	for _, alert := range alerts {
+		reason := string(alert.Labels["obj_name"]) + "/" + string(alert.Labels["event_reason"])
+		if alert.ResolvedAt(at) {
+			reason += " resolved"
+		}
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+	return reasons
+}
+
+func TestStateWatcher(t *testing.T) {
+	now := time.Now()
+	storageClass := "ssd"
+	kc := fake.NewSimpleClientset(
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "web-1", Namespace: "shop"},
+			Spec: corev1.PodSpec{
+				NodeName: "node-1",
+				Containers: []corev1.Container{{
+					Name: "app",
+					Resources: corev1.ResourceRequirements{Limits: corev1.ResourceList{
+						corev1.ResourceMemory: resource.MustParse("512Mi"),
+					}},
+				}},
+			},
+			Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{
+				Name:         "app",
+				RestartCount: 3,
+				State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{
+					Reason: "CrashLoopBackOff",
+				}},
+				LastTerminationState: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+					Reason:     "OOMKilled",
+					ExitCode:   137,
+					FinishedAt: metav1.NewTime(now.Add(-time.Minute)),
+				}},
+			}}},
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "web-2", Namespace: "shop"},
+			Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{
+				Name: "app",
+				// killed long ago
+				LastTerminationState: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+					Reason:     "OOMKilled",
+					FinishedAt: metav1.NewTime(now.Add(-time.Hour)),
+				}},
+			}}},
+		},
+		&corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+			Status: corev1.NodeStatus{Conditions: []corev1.NodeCondition{
+				{Type: corev1.NodeReady, Status: corev1.ConditionTrue},
+				{Type: corev1.NodeMemoryPressure, Status: corev1.ConditionTrue, LastTransitionTime: metav1.NewTime(now.Add(-time.Minute))},
+				{Type: corev1.NodeDiskPressure, Status: corev1.ConditionFalse},
+			}},
+		},
+		&corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "node-2"},
+			Status: corev1.NodeStatus{Conditions: []corev1.NodeCondition{
+				{Type: corev1.NodeReady, Status: corev1.ConditionUnknown},
+			}},
+		},
+		&corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: "data-1", Namespace: "shop", CreationTimestamp: metav1.NewTime(now.Add(-time.Hour))},
+			Spec:       corev1.PersistentVolumeClaimSpec{StorageClassName: &storageClass},
+			Status:     corev1.PersistentVolumeClaimStatus{Phase: corev1.ClaimPending},
+		},
+		&corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: "data-2", Namespace: "shop", CreationTimestamp: metav1.NewTime(now)},
+			Status:     corev1.PersistentVolumeClaimStatus{Phase: corev1.ClaimPending},
+		},
+	)
+	opt := config.DefaultStateWatchOpt
+	opt.Pods, opt.Nodes, opt.PVCs = true, true, true
+	alerts := &putAlerts{}
+	w := newStateWatcher(nil, &opt, "prod", kc, alerts)
+	defer w.Stop()
+	w.factory.Start(w.StopCh)
+	w.factory.WaitForCacheSync(w.StopCh)
+
+	w.update(now, w.collect(now))
+	expected := []string{
+		"data-1/ClaimPending",
+		"node-1/MemoryPressure",
+		"node-2/NodeNotReady",
+		"web-1/CrashLoopBackOff",
+		"web-1/OOMKilled",
+	}
+	if got := stateReasons(alerts.put, now); !reflect.DeepEqual(got, expected) {
+		t.Errorf("\nexpected:\n%v\ngot:\n%v", expected, got)
+	}
+	for _, alert := range alerts.put {
+		if alert.Labels["event_reason"] != "OOMKilled" {
+			continue
+		}
+		labels := common_model.LabelSet{
+			"cluster":      "prod",
+			"namespace":    "shop",
+			"obj_kind":     "Pod",
+			"obj_name":     "web-1",
+			"pod":          "web-1",
+			"source_host":  "node-1",
+			"container":    "app",
+			"severity":     config.SeverityCritical,
+			"event_type":   EVENT_TYPE_WARRNIGN,
+			"event_reason": "OOMKilled",
+			"cn_reason":    "",
+			// the pod has no controller
+			"workload_kind": "Pod",
+			"workload_name": "web-1",
+		}
+		if !reflect.DeepEqual(alert.Labels, labels) {
+			t.Errorf("\nexpected:\n%v\ngot:\n%v", labels, alert.Labels)
+		}
+		if alert.Annotations["exit_code"] != "137" || alert.Annotations["message"] != "container app was OOMKilled, memory limit 512Mi" {
+			t.Errorf("\nexpected:\n%v\ngot:\n%v", "exit code 137 and the memory limit", alert.Annotations)
+		}
+		if !alert.StartsAt.Equal(now.Add(-time.Minute)) || !alert.EndsAt.After(now) {
+			t.Errorf("\nexpected:\n%v\ngot:\n%v - %v", now.Add(-time.Minute), alert.StartsAt, alert.EndsAt)
+		}
+	}
+
+	// the pressure ends, the other alerts keep firing
+	var kept []*stateProblem
+	for _, p := range w.collect(now) {
+		if p.reason != string(corev1.NodeMemoryPressure) {
+			kept = append(kept, p)
+		}
+	}
+	alerts.put = nil
+	later := now.Add(opt.Interval)
+	w.update(later, kept)
+	expected = []string{
+		"data-1/ClaimPending",
+		"node-1/MemoryPressure resolved",
+		"node-2/NodeNotReady",
+		"web-1/CrashLoopBackOff",
+		"web-1/OOMKilled",
+	}
+	if got := stateReasons(alerts.put, later); !reflect.DeepEqual(got, expected) {
+		t.Errorf("\nexpected:\n%v\ngot:\n%v", expected, got)
+	}
+	for _, alert := range alerts.put {
+		// alerts without a start in the object keep the first one seen
+		if alert.Labels["event_reason"] == "CrashLoopBackOff" && !alert.StartsAt.Equal(now) {
+			t.Errorf("\nexpected:\n%v\ngot:\n%v", now, alert.StartsAt)
+		}
+	}
+
+	alerts.put = nil
+	w.update(later, kept)
+	if got := stateReasons(alerts.put, later); len(got) != 4 {
+		t.Errorf("\nexpected:\n%v\ngot:\n%v", 4, got)
+	}
+}
@@ -0,0 +1,252 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"github.com/crain-cn/event-mesh/cmd/config"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/pager"
+	watchtools "k8s.io/client-go/tools/watch"
+	"time"
+)
+
+// retryWatch is the delay before listing or watching again after an error.
+const retryWatch = time.Second * 5
+
+var errWatchClosed = errors.New("event watch closed")
+
+// eventStream lists and watches the events of a cluster, in all namespaces or
+// in one, and resumes from its own checkpoint. Nothing is cached: every event
+// goes to the queue of the watcher, or is dropped.
+type eventStream struct {
+	watcher       *EventWatcher
+	namespace     string
+	fieldSelector string
+	checkpoint    *eventCheckpoint
+}
+
+// newEventStreams returns one stream for the whole cluster, or one per
+// namespace when the watch is limited to namespaces. Field selectors can not
+// express a set of namespaces, but a namespaced watch can.
+func newEventStreams(w *EventWatcher, opt *config.EventWatchOpt, rules []*config.FilterRule, checkpoints CheckpointStore) ([]*eventStream, error) {
+	namespaces, eventType := watchScope(rules)
+	if len(opt.Namespaces) > 0 {
+		namespaces = opt.Namespaces
+	}
+	if len(opt.Type) > 0 {
+		eventType = opt.Type
+	} else if observing := w.resolver.ObservingRules(); len(eventType) > 0 && len(observing) > 0 {
+		// recoveries are Normal events, a Warning watch would never see them
+		log.WithField("cluster", w.cluster).Info("watch all event types, resolve rules ", observing, " are resolved by events")
+		eventType = ""
+	}
+
+	var selectors []fields.Selector
+	if len(eventType) > 0 {
+		selectors = append(selectors, fields.OneTermEqualSelector("type", eventType))
+	}
+	if len(opt.FieldSelector) > 0 {
+		selector, err := fields.ParseSelector(opt.FieldSelector)
+		if err != nil {
+			return nil, err
+		}
+		selectors = append(selectors, selector)
+	}
+	fieldSelector := fields.AndSelectors(selectors...).String()
+
+	if len(namespaces) == 0 {
+		return []*eventStream{{
+			watcher:       w,
+			namespace:     corev1.NamespaceAll,
+			fieldSelector: fieldSelector,
+			checkpoint:    loadEventCheckpoint(checkpoints, w.cluster),
+		}}, nil
+	}
+	streams := make([]*eventStream, 0, len(namespaces))
+	for _, ns := range namespaces {
+		streams = append(streams, &eventStream{
+			watcher:       w,
+			namespace:     ns,
+			fieldSelector: fieldSelector,
+			checkpoint:    loadEventCheckpoint(checkpoints, w.cluster+"_"+ns),
+		})
+	}
+	return streams, nil
+}
+
+func (s *eventStream) logger() *logrus.Entry {
+	return log.WithFields(logrus.Fields{
+		"cluster":        s.watcher.cluster,
+		"namespace":      s.namespace,
+		"field_selector": s.fieldSelector,
+	})
+}
+
+// run lists and watches the events until StopCh is closed. A watch resumes
+// from the checkpointed resourceVersion; events are listed again only when
+// there is none or the apiserver answers 410 Gone.
+func (s *eventStream) run() {
+	stopCh := s.watcher.StopCh
+	// counted in saving by NewEventControllerWatcher
+	go func() {
+		defer s.watcher.saving.Done()
+		s.checkpoint.Run(stopCh)
+	}()
+
+	resourceVersion := s.checkpoint.ResourceVersion()
+	// Without a checkpoint the events before the start are history and are
+	// not notified.
+	coldStart := len(resourceVersion) == 0
+	for {
+		var err error
+		op := HealthOpWatch
+		if len(resourceVersion) == 0 {
+			op = HealthOpList
+			resourceVersion, err = s.relist(coldStart)
+		}
+		if err == nil {
+			op = HealthOpWatch
+			coldStart = false
+			resourceVersion, err = s.watch(resourceVersion)
+		}
+		select {
+		case <-stopCh:
+			return
+		default:
+		}
+		if apierrors.IsResourceExpired(err) || apierrors.IsGone(err) {
+			s.logger().Warning("event resourceVersion expired, relisting")
+			resourceVersion = ""
+			continue
+		}
+		s.watcher.health.Failed(op, err)
+		s.logger().WithError(err).Error("watch events")
+		select {
+		case <-stopCh:
+			return
+		case <-time.After(retryWatch):
+		}
+	}
+}
+
+// relist lists all events and returns the resourceVersion of the list.
+// Events whose UID was handled before are skipped.
+func (s *eventStream) relist(coldStart bool) (string, error) {
+	p := pager.New(pager.SimplePageFunc(func(opts metav1.ListOptions) (runtime.Object, error) {
+		return s.watcher.source.List(context.TODO(), s.namespace, opts)
+	}))
+	list, _, err := p.List(context.TODO(), metav1.ListOptions{FieldSelector: s.fieldSelector})
+	if err != nil {
+		return "", err
+	}
+	s.watcher.health.Contact()
+	listMeta, err := meta.ListAccessor(list)
+	if err != nil {
+		return "", err
+	}
+	err = meta.EachListItem(list, func(obj runtime.Object) error {
+		if event, ok := obj.(*corev1.Event); ok {
+			s.enqueue(event, "", coldStart)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	s.checkpoint.Track(listMeta.GetResourceVersion(), nil).Done()
+	return listMeta.GetResourceVersion(), nil
+}
+
+// watch watches the events from resourceVersion with bookmarks until an error
+// or StopCh, and returns the last resourceVersion received.
+func (s *eventStream) watch(resourceVersion string) (string, error) {
+	w, err := watchtools.NewRetryWatcher(resourceVersion, &cache.ListWatch{
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			options.FieldSelector = s.fieldSelector
+			return s.watcher.source.Watch(context.TODO(), s.namespace, options)
+		},
+	})
+	if err != nil {
+		return resourceVersion, err
+	}
+	defer w.Stop()
+	s.watcher.health.Watching(1)
+	defer s.watcher.health.Watching(-1)
+
+	for {
+		select {
+		case <-s.watcher.StopCh:
+			return resourceVersion, nil
+		case ev, ok := <-w.ResultChan():
+			if !ok {
+				return resourceVersion, errWatchClosed
+			}
+			switch ev.Type {
+			case watch.Added, watch.Modified:
+				if event := ObjToV1Event(ev.Object); event != nil {
+					resourceVersion = event.ResourceVersion
+					s.enqueue(event, resourceVersion, false)
+				}
+			case watch.Deleted, watch.Bookmark:
+				s.watcher.health.Contact()
+				if m, err := meta.Accessor(ev.Object); err == nil {
+					resourceVersion = m.GetResourceVersion()
+					s.checkpoint.Track(resourceVersion, nil).Done()
+				}
+			case watch.Error:
+				return resourceVersion, apierrors.FromObject(ev.Object)
+			}
+		}
+	}
+}
+
+// enqueue filters the event and hands a lean copy to the queue. Events that
+// are filtered, shed or already handled are skipped right away, not recorded
+// as handled. The resolver,
+// the counter and the rate detector see the events before the filter,
+// recoveries and counted events are usually filtered.
+func (s *eventStream) enqueue(event *corev1.Event, resourceVersion string, coldStart bool) {
+	w := s.watcher
+	w.health.Observed()
+	w.resolver.Observe(event)
+	tracked := s.checkpoint.Track(resourceVersion, event)
+	if s.checkpoint.Seen(event) || (coldStart && w.filter.filterTime(event)) {
+		tracked.Skip()
+		return
+	}
+	// count rules and rate baselines count the events the filter drops too
+	w.counter.Observe(event)
+	w.rates.Observe(event)
+	if w.filter.Filter(event) {
+		tracked.Skip()
+		return
+	}
+	el := w.newElEvent(leanEvent(event))
+	el.tracked = tracked
+	if !w.queue.Enqueue(el) {
+		tracked.Skip()
+	}
+}
+
+// leanEvent copies the event without the metadata the handlers do not use,
+// managedFields first of all, so a listed event does not keep the whole list
+// alive while it waits in the queue.
+func leanEvent(in *corev1.Event) *corev1.Event {
+	out := *in
+	out.ObjectMeta = metav1.ObjectMeta{
+		Name:              in.Name,
+		Namespace:         in.Namespace,
+		UID:               in.UID,
+		ResourceVersion:   in.ResourceVersion,
+		CreationTimestamp: in.CreationTimestamp,
+	}
+	return &out
+}
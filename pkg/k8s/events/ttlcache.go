@@ -0,0 +1,72 @@
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// ttlCache is a small expiring cache for apiserver lookups made per event.
+// Misses are cached as well, so a missing object is not looked up per event.
+type ttlCache struct {
+	ttl   time.Duration
+	now   func() time.Time
+	lock  sync.Mutex
+	items map[string]ttlEntry
+}
+
+type ttlEntry struct {
+	value   interface{}
+	expires time.Time
+}
+
+func newTTLCache(ttl time.Duration) *ttlCache {
+	return &ttlCache{
+		ttl:   ttl,
+		now:   time.Now,
+		items: make(map[string]ttlEntry),
+	}
+}
+
+func (c *ttlCache) Get(key string) (interface{}, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	entry, ok := c.items[key]
+	if !ok || c.now().After(entry.expires) {
+		return nil, false
+	}
+	return entry.value, true
+}
+
+func (c *ttlCache) Set(key string, value interface{}) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.items[key] = ttlEntry{
+		value:   value,
+		expires: c.now().Add(c.ttl),
+	}
+}
+
+func (c *ttlCache) gc() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	now := c.now()
+	for key, entry := range c.items {
+		if now.After(entry.expires) {
+			delete(c.items, key)
+		}
+	}
+}
+
+// Run drops expired entries every ttl until stopCh is closed.
+func (c *ttlCache) Run(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(c.ttl)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.gc()
+		case <-stopCh:
+			return
+		}
+	}
+}
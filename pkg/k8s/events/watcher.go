@@ -1,13 +1,16 @@
 package events
 
 import (
+	"github.com/crain-cn/event-mesh/api/model"
 	"github.com/crain-cn/event-mesh/cmd/config"
+	"github.com/crain-cn/event-mesh/pkg/owner"
 	"github.com/crain-cn/event-mesh/pkg/provider"
+	"github.com/crain-cn/event-mesh/pkg/reason"
 	corev1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
 	"os"
+	"sync"
 	"time"
 )
 
@@ -16,89 +19,133 @@ const (
 )
 
 type EventWatcher struct {
-	Kc                  kubernetes.Interface
-	ConfigResolver      *config.ConfigResolver
-	StopCh              chan struct{}
-	SharedIndexInformer cache.SharedIndexInformer
-	InformerSynced      cache.InformerSynced
-	Cache               map[string]corev1.Event
-	StartTime           time.Time
+	Kc             kubernetes.Interface
+	ConfigResolver *config.ConfigResolver
+	StopCh         chan struct{}
+	StartTime      time.Time
+
+	cluster    string
+	source     eventSource
+	filter     *eventFilter
+	resolver   *eventResolver
+	counter    *eventCounter
+	rates      *rateDetector
+	health     *ClusterHealth
+	queue      *eventQueue
+	streams    []*eventStream
+	newElEvent func(event *corev1.Event) *ElEvent
+	// saving counts the checkpoints not saved since the stop.
+	saving sync.WaitGroup
 }
 
-func NewEventControllerWatcher(workcodes,reasons map[string]string,configResolver *config.ConfigResolver, cluster string, kc kubernetes.Interface, alerts provider.Alerts) *EventWatcher {
-	// 指定 ListWatcher 在所有namespace下监听 Events 资源
+func NewEventControllerWatcher(directory *owner.Directory, reasons *reason.Dictionary, configResolver *config.ConfigResolver, dataDir string, checkpoints CheckpointStore, cluster string, kc kubernetes.Interface, alerts provider.Alerts, health *ClusterHealth) *EventWatcher {
 	log.Info("NewEventWatcher:", cluster)
 
 	startTime := time.Now()
-	eventWatcher := &EventWatcher{
-		Kc:                  kc,
-		ConfigResolver:      configResolver,
-		StopCh:              make(chan struct{}),
+	envStr := os.Getenv("env")
+	clusterLabels := configResolver.GetClusterPolicy(cluster).Labels
+	alerts = withClusterLabels(alerts, clusterLabels)
+	rules := FilterRulesFor(configResolver, cluster)
+	eventFilter, err := NewEventFilter(startTime, rules)
+	if err != nil {
+		log.WithError(err).Error("invalid event filter rules, falling back to defaults: ", cluster)
+		rules = DefaultFilterRules
+		eventFilter, _ = NewEventFilter(startTime, rules)
+	}
+	severities, err := newSeverityClassifier(configResolver.GetEventSeverityRules(cluster))
+	if err != nil {
+		log.WithError(err).Error("invalid event severity rules, using event types: ", cluster)
+		severities, _ = newSeverityClassifier(nil)
+	}
+	resolver, err := newEventResolver(kc, ResolveRulesFor(configResolver, cluster), sendAlert)
+	if err != nil {
+		log.WithError(err).Error("invalid event resolve rules, falling back to defaults: ", cluster)
+		resolver, _ = newEventResolver(kc, DefaultResolveRules, sendAlert)
+	}
+	aggregator := newEventAggregator(configResolver.GetEventAggregationOpt(cluster))
+	owners := newOwnerResolver(kc)
+	var enrichment *enricher
+	if opt := configResolver.GetEventEnrichmentOpt(cluster); opt != nil {
+		enrichment = newEnricher(kc, opt)
 	}
+	mentions := newOwnerMentions(kc, directory, configResolver.GetOwnerDirectoryOpt())
+	// count rules are also kept in the event rules of the database
+	var loadCountRules func() ([]*config.CountRule, error)
+	if envStr != "" && envStr != "dev" {
+		loadCountRules = model.GetEventCountRules
+	}
+	counter := newEventCounter(cluster, alerts, owners, mentions, configResolver.GetEventCountRules(cluster), loadCountRules)
+	var rates *rateDetector
+	if opt := configResolver.GetEventAnomalyOpt(cluster); opt != nil {
+		rates = loadRateDetector(dataDir, cluster, opt, alerts, mentions)
+	}
+	var diagnostics *diagnoser
+	if opt := configResolver.GetEventDiagnosticsOpt(cluster); opt != nil {
+		diagnostics = newDiagnoser(kc, opt)
+	}
+	eventWatcher := &EventWatcher{
+		Kc:             kc,
+		ConfigResolver: configResolver,
+		StopCh:         make(chan struct{}),
+		StartTime:      startTime,
+		cluster:        cluster,
+		source:         newEventSource(kc, configResolver.GetEventSource(cluster)),
+		filter:         eventFilter,
+		resolver:       resolver,
+		counter:        counter,
+		rates:          rates,
+		health:         health,
+		queue:          newEventQueue(cluster, configResolver.GetEventQueueOpt(cluster)),
+		newElEvent: func(event *corev1.Event) *ElEvent {
+			return &ElEvent{
+				Cluster:   cluster,
+				Event:     event,
+				StartTime: startTime,
+				Alerts:    alerts,
+				ENV:       envStr,
+				Reasons:   reasons,
 
-	envStr := os.Getenv("env")
-	eventListWatcher := cache.NewListWatchFromClient(kc.CoreV1().RESTClient(), "events", corev1.NamespaceAll, fields.Everything())
-	filters := configResolver.GetEventSinksFilters(cluster)
-	notFilters := configResolver.GetEventSinksNotFilters(cluster)
+				aggregator: aggregator,
+				owners:     owners,
+				enricher:   enrichment,
+				diagnoser:  diagnostics,
+				mentions:   mentions,
+				severities: severities,
+				resolver:   resolver,
 
-	eventFilter := NewEventFilter(startTime, ToFilterList(filters), ToFilterList(notFilters))
-	// 创建 indexer 和 informer
-	indexer, informer := cache.NewIndexerInformer(eventListWatcher, &corev1.Event{}, 0, cache.ResourceEventHandlerFuncs{
-		// 当有 pod 创建时，根据 Delta queue 弹出的 object 生成对应的Key，并加入到 workqueue中。此处可以根据Object的一些属性，进行过滤
-		AddFunc: func(obj interface{}) {
-			if event := ObjToV1Event(obj); event != nil {
-				filterResult := eventFilter.Filter(event)
-				if filterResult {
-					return
-				}
-				el := &ElEvent{
-					Cluster:   cluster,
-					Event:     event,
-					StartTime: startTime,
-					Alerts:    alerts,
-				}
-				el.ENV = envStr
-				el.Reasons = reasons
-				el.Workcodes = workcodes
-				go el.Handle2()
-			}
-		},
-		UpdateFunc: func(oldObj, newObj interface{}) {
-			if old := ObjToV1Event(oldObj); old != nil {
-				if new := ObjToV1Event(newObj); new != nil {
-					filterResult := eventFilter.Filter(new)
-					if filterResult {
-						return
-					}
-					log.Info("ElEvent Update: ",&ElEvent{
-						Cluster:   cluster,
-						Event:     new,
-						StartTime: startTime,
-						Alerts:    alerts,
-					})
-					el := &ElEvent{
-						Cluster:   cluster,
-						Event:     new,
-						StartTime: startTime,
-						Alerts:    alerts,
-					}
-					el.Workcodes = workcodes
-					el.Reasons = reasons
-					el.ENV = envStr
-					go el.Handle2()
-				}
+				clusterLabels: clusterLabels,
 			}
 		},
-		DeleteFunc: func(obj interface{}) {
-		},
-	}, cache.Indexers{})
-	controller := NewEventsController(indexer, informer)
-	// 启动 controller
-	go controller.Run(eventWatcher.StopCh)
+	}
+
+	eventWatcher.streams, err = newEventStreams(eventWatcher, configResolver.GetEventWatchOpt(cluster), rules, checkpoints)
+	if err != nil {
+		log.WithError(err).Error("invalid event watch field selector, watching all events: ", cluster)
+		eventWatcher.streams, _ = newEventStreams(eventWatcher, &config.EventWatchOpt{}, rules, checkpoints)
+	}
+
+	go eventWatcher.queue.Run(eventWatcher.StopCh)
+	go aggregator.Run(eventWatcher.StopCh)
+	go owners.Run(eventWatcher.StopCh)
+	go resolver.Run(eventWatcher.StopCh)
+	go counter.Run(eventWatcher.StopCh)
+	go mentions.Run(eventWatcher.StopCh)
+	if enrichment != nil {
+		go enrichment.Run(eventWatcher.StopCh)
+	}
+	if rates != nil {
+		go rates.Run(eventWatcher.StopCh)
+	}
+	// counted before the streams run, for Wait not to return before a
+	// checkpoint is counted
+	eventWatcher.saving.Add(len(eventWatcher.streams))
+	for _, stream := range eventWatcher.streams {
+		stream.logger().Info("watching events from ", eventWatcher.source.Name())
+		go stream.run()
+	}
 	return eventWatcher
 }
 
-
 //func NewEventWatcher2(configResolver *config.ConfigResolver, cluster string, kc kubernetes.Interface, alerts provider.Alerts) *EventWatcher {
 //	log.Info("NewEventWatcher:", cluster)
 //	eq := eventqueue.NewEventQueueBuffered(cluster, 10000)
@@ -168,8 +215,13 @@ func NewEventControllerWatcher(workcodes,reasons map[string]string,configResolve
 //}
 
 func (e *EventWatcher) Stop() {
-	// send a finish signal
-	e.StopCh <- struct{}{}
+	// close to signal the watch, the queue workers and the checkpoint
+	close(e.StopCh)
+}
+
+// Wait returns once the checkpoints of the stopped watcher are saved.
+func (e *EventWatcher) Wait() {
+	e.saving.Wait()
 }
 
 func ObjToV1Event(obj interface{}) *corev1.Event {
@@ -18,11 +18,13 @@ package kubeutil
 
 import (
 	"errors"
+	"fmt"
 	"github.com/crain-cn/event-mesh/pkg/logging"
 	"github.com/crain-cn/event-mesh/pkg/logging/logfields"
-	"github.com/sirupsen/logrus"
+	"io/ioutil"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+	"strings"
 )
 
 var (
@@ -32,13 +34,13 @@ var (
 func LoadConfig(kubeconfig string) (*rest.Config, error) {
 	cfg, err := clientcmd.Load([]byte(kubeconfig))
 	if err != nil {
-		log.WithError(err).Fatalf("unmarshal: %v", err)
+		return nil, fmt.Errorf("unmarshal kubeconfig: %v", err)
 	}
 	for context := range cfg.Contexts {
 		log.Infof("* %s", context)
 		contextCfg, err := clientcmd.NewNonInteractiveClientConfig(*cfg, context, &clientcmd.ConfigOverrides{}, nil).ClientConfig()
 		if err != nil {
-			logrus.WithError(err).Fatalf("create %s client: %v", context, err)
+			return nil, fmt.Errorf("create %s client: %v", context, err)
 		}
 		// An arbitrary high number we expect to not exceed. There are various components that need more than the default 5 QPS/10 Burst, e.G.
 		// hook for creating ProwJobs and Plank for creating Pods.
@@ -48,3 +50,33 @@ func LoadConfig(kubeconfig string) (*rest.Config, error) {
 	}
 	return nil, errors.New("invalid kubeconfig")
 }
+
+// RestConfig returns the config of the client of a Cluster of a cluster map.
+func RestConfig(c *Cluster) *rest.Config {
+	return &rest.Config{
+		Host: c.Endpoint,
+		TLSClientConfig: rest.TLSClientConfig{
+			CertData: c.ClientCertificate,
+			KeyData:  c.ClientKey,
+			CAData:   c.ClusterCACertificate,
+		},
+		QPS:   100,
+		Burst: 1000,
+	}
+}
+
+// namespaceFile holds the namespace of the service account of a pod.
+const namespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// PodNamespace returns the namespace of the pod the process runs in, or
+// default out of a pod.
+func PodNamespace() string {
+	b, err := ioutil.ReadFile(namespaceFile)
+	if err != nil {
+		return "default"
+	}
+	if namespace := strings.TrimSpace(string(b)); len(namespace) > 0 {
+		return namespace
+	}
+	return "default"
+}
@@ -0,0 +1,258 @@
+package leader
+
+import (
+	"context"
+	"fmt"
+	"github.com/crain-cn/event-mesh/pkg/k8s/kubeutil"
+	"github.com/crain-cn/event-mesh/pkg/logging"
+	"github.com/crain-cn/event-mesh/pkg/logging/logfields"
+	"github.com/prometheus/client_golang/prometheus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	log = logging.DefaultLogger.WithField(logfields.LogSubsys, "leader")
+)
+
+const (
+	// ModeActivePassive starts nothing on the replicas that do not lead.
+	ModeActivePassive = "active-passive"
+	// ModeActiveActive keeps the clusters and the CRDs in sync on the
+	// replicas that do not lead, which serve the read APIs and take over
+	// at once.
+	ModeActiveActive = "active-active"
+)
+
+// Options configures the election of the replica watching the clusters.
+type Options struct {
+	Mode string
+	// Namespace and Name are those of the Lease; Namespace defaults to the
+	// one of the pod.
+	Namespace string
+	Name      string
+	// Identity defaults to the host name, which is the pod name.
+	Identity      string
+	LeaseDuration time.Duration
+	RenewDeadline time.Duration
+	RetryPeriod   time.Duration
+}
+
+// DefaultOptions fail over within ten seconds when the leader dies; a leader
+// that stops hands over at once.
+var DefaultOptions = Options{
+	Mode:          ModeActivePassive,
+	Name:          "event-mesh",
+	LeaseDuration: 10 * time.Second,
+	RenewDeadline: 7 * time.Second,
+	RetryPeriod:   2 * time.Second,
+}
+
+// Candidate is what runs on the leader only.
+type Candidate interface {
+	StartLeading()
+	// StopLeading returns once the state for the next leader is saved.
+	StopLeading()
+}
+
+// Status is the leadership seen by a replica.
+type Status struct {
+	Mode     string `json:"mode"`
+	Identity string `json:"identity"`
+	Leader   string `json:"leader"`
+	Leading  bool   `json:"leading"`
+}
+
+// Elector campaigns for the Lease and runs the candidate while holding it.
+type Elector struct {
+	opt       Options
+	candidate Candidate
+	elector   *leaderelection.LeaderElector
+
+	// run serializes the start and stop of the candidate.
+	run sync.Mutex
+	// lock guards the fields below.
+	lock    sync.Mutex
+	leader  string
+	leading bool
+	stopped bool
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+// NewElector returns an elector for the Lease of opt, which does not campaign
+// until Run.
+func NewElector(kc kubernetes.Interface, opt Options, candidate Candidate) (*Elector, error) {
+	if opt.Mode != ModeActivePassive && opt.Mode != ModeActiveActive {
+		return nil, fmt.Errorf("unknown leader election mode %q", opt.Mode)
+	}
+	if len(opt.Namespace) == 0 {
+		opt.Namespace = kubeutil.PodNamespace()
+	}
+	if len(opt.Identity) == 0 {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, err
+		}
+		opt.Identity = hostname
+	}
+	registerMetrics(prometheus.DefaultRegisterer)
+
+	e := &Elector{
+		opt:       opt,
+		candidate: candidate,
+		done:      make(chan struct{}),
+	}
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{
+			Namespace: opt.Namespace,
+			Name:      opt.Name,
+		},
+		Client:     kc.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{Identity: opt.Identity},
+	}
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock:          lock,
+		Name:          opt.Name,
+		LeaseDuration: opt.LeaseDuration,
+		RenewDeadline: opt.RenewDeadline,
+		RetryPeriod:   opt.RetryPeriod,
+		// the lease is released on Stop, after the candidate stopped
+		ReleaseOnCancel: true,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: e.startLeading,
+			OnStoppedLeading: e.stopLeading,
+			OnNewLeader:      e.newLeader,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	e.elector = elector
+	return e, nil
+}
+
+// Namespace is the namespace of the Lease, where the state handed over
+// between the leaders is kept too.
+func (e *Elector) Namespace() string {
+	return e.opt.Namespace
+}
+
+// Name is the name of the Lease.
+func (e *Elector) Name() string {
+	return e.opt.Name
+}
+
+// Mode is the mode of the replicas, ModeActivePassive or ModeActiveActive.
+func (e *Elector) Mode() string {
+	return e.opt.Mode
+}
+
+// Run campaigns until Stop, again whenever the leadership is lost.
+func (e *Elector) Run() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer close(e.done)
+	e.lock.Lock()
+	if e.stopped {
+		e.lock.Unlock()
+		cancel()
+		return
+	}
+	e.cancel = cancel
+	e.lock.Unlock()
+
+	log.Info("campaigning for lease ", e.opt.Namespace, "/", e.opt.Name, " as ", e.opt.Identity)
+	for {
+		e.elector.Run(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Warning("lost the leadership, campaigning again")
+	}
+}
+
+// Stop stops the candidate, then releases the lease for another replica to
+// take over at once.
+func (e *Elector) Stop() {
+	e.lock.Lock()
+	e.stopped = true
+	e.lock.Unlock()
+	e.stopLeading()
+	e.lock.Lock()
+	cancel := e.cancel
+	e.lock.Unlock()
+	if cancel == nil {
+		return
+	}
+	cancel()
+	<-e.done
+}
+
+// startLeading is called by the elector in a goroutine; ctx is done once the
+// leadership is lost, possibly before it runs.
+func (e *Elector) startLeading(ctx context.Context) {
+	e.run.Lock()
+	defer e.run.Unlock()
+	e.lock.Lock()
+	if e.leading || e.stopped || ctx.Err() != nil {
+		e.lock.Unlock()
+		return
+	}
+	e.leading = true
+	e.leader = e.opt.Identity
+	e.lock.Unlock()
+
+	log.Info("started leading")
+	isLeader.Set(1)
+	transitions.Inc()
+	e.candidate.StartLeading()
+}
+
+// stopLeading is called by the elector whenever it stops campaigning, led
+// or not.
+func (e *Elector) stopLeading() {
+	e.run.Lock()
+	defer e.run.Unlock()
+	e.lock.Lock()
+	if !e.leading {
+		e.lock.Unlock()
+		return
+	}
+	e.leading = false
+	e.lock.Unlock()
+
+	log.Info("stopped leading")
+	isLeader.Set(0)
+	e.candidate.StopLeading()
+}
+
+func (e *Elector) newLeader(identity string) {
+	e.lock.Lock()
+	e.leader = identity
+	e.lock.Unlock()
+	log.Info("leader: ", identity)
+}
+
+// IsLeader reports whether the candidate runs on this replica.
+func (e *Elector) IsLeader() bool {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return e.leading
+}
+
+// Status returns the leadership seen by this replica.
+func (e *Elector) Status() Status {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return Status{
+		Mode:     e.opt.Mode,
+		Identity: e.opt.Identity,
+		Leader:   e.leader,
+		Leading:  e.leading,
+	}
+}
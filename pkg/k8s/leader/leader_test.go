@@ -0,0 +1,84 @@
+package leader
+
+import (
+	"k8s.io/client-go/kubernetes/fake"
+	"sync"
+	"testing"
+	"time"
+)
+
+type candidate struct {
+	lock    sync.Mutex
+	leading bool
+	started chan struct{}
+}
+
+func (c *candidate) StartLeading() {
+	c.lock.Lock()
+	c.leading = true
+	c.lock.Unlock()
+	c.started <- struct{}{}
+}
+
+func (c *candidate) StopLeading() {
+	c.lock.Lock()
+	c.leading = false
+	c.lock.Unlock()
+}
+
+func (c *candidate) isLeading() bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.leading
+}
+
+func TestElectorHandover(t *testing.T) {
+	kc := fake.NewSimpleClientset()
+	opt := Options{
+		Mode:          ModeActivePassive,
+		Namespace:     "ops",
+		Name:          "event-mesh",
+		LeaseDuration: time.Second,
+		RenewDeadline: 500 * time.Millisecond,
+		RetryPeriod:   100 * time.Millisecond,
+	}
+	electors := make([]*Elector, 2)
+	candidates := make([]*candidate, 2)
+	for i, identity := range []string{"a", "b"} {
+		opt.Identity = identity
+		candidates[i] = &candidate{started: make(chan struct{}, 1)}
+		e, err := NewElector(kc, opt, candidates[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		electors[i] = e
+	}
+
+	go electors[0].Run()
+	select {
+	case <-candidates[0].started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a to lead")
+	}
+	go electors[1].Run()
+	defer electors[1].Stop()
+	time.Sleep(5 * opt.RetryPeriod)
+	if candidates[1].isLeading() {
+		t.Fatalf("\nexpected:\n%v\ngot:\n%v", "b waiting", electors[1].Status())
+	}
+
+	// a stops its candidate before releasing the lease, b takes over
+	electors[0].Stop()
+	if candidates[0].isLeading() {
+		t.Errorf("\nexpected:\n%v\ngot:\n%v", "a stopped", electors[0].Status())
+	}
+	select {
+	case <-candidates[1].started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected b to take over")
+	}
+	status := electors[1].Status()
+	if !status.Leading || status.Leader != "b" {
+		t.Errorf("\nexpected:\n%v\ngot:\n%v", "b leading", status)
+	}
+}
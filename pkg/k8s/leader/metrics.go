@@ -0,0 +1,31 @@
+package leader
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sync"
+)
+
+const metricsNamespace = "eventmesh"
+
+var (
+	metricsOnce sync.Once
+
+	isLeader = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "leader",
+		Help:      "Whether this replica leads, and watches the clusters.",
+	})
+
+	transitions = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "leader_transitions_total",
+		Help:      "Number of times this replica started leading.",
+	})
+)
+
+// registerMetrics registers the metrics of the leadership.
+func registerMetrics(r prometheus.Registerer) {
+	metricsOnce.Do(func() {
+		r.MustRegister(isLeader, transitions)
+	})
+}
@@ -1,15 +1,19 @@
 package watcher
 
 import (
-	"github.com/crain-cn/event-mesh/api/model"
 	"github.com/crain-cn/event-mesh/cmd/config"
 	eventmesh_v1 "github.com/crain-cn/event-mesh/pkg/k8s/apis/eventmesh/v1"
 	"github.com/crain-cn/event-mesh/pkg/k8s/clustermesh"
 	"github.com/crain-cn/event-mesh/pkg/k8s/events"
+	"github.com/crain-cn/event-mesh/pkg/k8s/leader"
 	"github.com/crain-cn/event-mesh/pkg/logging"
 	"github.com/crain-cn/event-mesh/pkg/logging/logfields"
+	"github.com/crain-cn/event-mesh/pkg/owner"
 	"github.com/crain-cn/event-mesh/pkg/provider"
+	"github.com/crain-cn/event-mesh/pkg/reason"
 	"github.com/crain-cn/cluster-mesh/api/cloud.mesh/v1beta1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
 	"sync"
@@ -46,21 +50,60 @@ type K8sWatcher struct {
 	// on Daemon.
 	clientConfig      *rest.Config
 	configResolver    *config.ConfigResolver
+	dataDir           string
+	clusterSource     clustermesh.ClusterSource
 	clusterManager    *clustermesh.ClusterManager
 	eventRouteManager *events.EventRouteManager
+	// elector elects the replica watching the clusters, nil when the
+	// replica is alone.
+	elector *leader.Elector
+	// shard, when set, shards the clusters across the replicas instead;
+	// sharder reads their membership.
+	shard   *clustermesh.ShardOptions
+	sharder *clustermesh.Sharder
 	// controllersStarted is a channel that is closed when all controllers, i.e.,
 	// k8s watchers have started listening for k8s events.
 	controllersStarted chan struct{}
+	// ready is closed once the managers are created; startOnce starts the
+	// controllers feeding them.
+	ready     chan struct{}
+	startOnce sync.Once
 }
 
-func NewK8sWatcher(configResolver *config.ConfigResolver, clientConfig *rest.Config) *K8sWatcher {
+func NewK8sWatcher(configResolver *config.ConfigResolver, clientConfig *rest.Config, clusterSource clustermesh.ClusterSource, dataDir string) *K8sWatcher {
 	return &K8sWatcher{
 		configResolver:     configResolver,
 		clientConfig:       clientConfig,
+		clusterSource:      clusterSource,
+		dataDir:            dataDir,
 		controllersStarted: make(chan struct{}),
+		ready:              make(chan struct{}),
 	}
 }
 
+// EnableLeaderElection makes the replicas elect the one watching the
+// clusters and generating the config of the CRDs. It is called before
+// EnableK8sWatcher.
+func (k *K8sWatcher) EnableLeaderElection(opt leader.Options) error {
+	kc, err := kubernetes.NewForConfig(k.clientConfig)
+	if err != nil {
+		return err
+	}
+	k.elector, err = leader.NewElector(kc, opt, k)
+	return err
+}
+
+// EnableSharding makes every replica watch, route and notify for the
+// clusters of its shard. It is called before EnableK8sWatcher, instead of
+// EnableLeaderElection.
+func (k *K8sWatcher) EnableSharding(opt clustermesh.ShardOptions) error {
+	if err := opt.Validate(); err != nil {
+		return err
+	}
+	k.shard = &opt
+	return nil
+}
+
 // k8sMetrics implements the LatencyMetric and ResultMetric interface from
 // k8s client-go package
 type k8sMetrics struct{}
@@ -73,21 +116,140 @@ func (k *K8sWatcher) EnableK8sWatcher(alerts provider.Alerts) error {
 
 	asyncControllers := &sync.WaitGroup{}
 	//swg := lock.NewStoppableWaitGroup()
-	k.clusterManager = clustermesh.NewClusterManager(k.configResolver, k.clientConfig, alerts)
-	k.clusterManager.Reasons = model.GetEventReasonsAll()
-	k.clusterManager.Workcodes = model.GetAppUserAll()
-	k.clusterManager.ClusterMeshInit(asyncControllers)
-	asyncControllers.Add(1)
-
+	k.clusterManager = clustermesh.NewClusterManager(k.configResolver, k.clusterSource, alerts)
+	kc, err := kubernetes.NewForConfig(k.clientConfig)
+	// the db source of the reasons does not need the client
+	var reasonClient kubernetes.Interface
+	if err != nil {
+		log.WithError(err).Error("create kubernetes client")
+	} else {
+		reasonClient = kc
+	}
+	// without a dictionary the events are handled without their reason
+	// classes and docs
+	k.clusterManager.Reasons = reason.NewDictionaryFor(k.configResolver.GetReasonDictionaryOpt(), reasonClient)
+	if k.clusterManager.Reasons != nil {
+		if err := k.clusterManager.Reasons.Refresh(); err != nil {
+			log.WithError(err).Error("load event reasons")
+		}
+		go k.clusterManager.Reasons.Run(wait.NeverStop)
+	}
+	k.clusterManager.Owners = owner.NewDirectoryFor(k.configResolver.GetOwnerDirectoryOpt())
+	k.clusterManager.Owners.Refresh()
+	go k.clusterManager.Owners.Run(wait.NeverStop)
+	k.clusterManager.DataDir = k.dataDir
+	k.clusterManager.Checkpoints = events.NewFileCheckpointStore(k.dataDir)
 	k.eventRouteManager = events.NewEventRouteManager(k.clientConfig)
-	k.eventRouteManager.ReceiverInit(asyncControllers)
-	k.eventRouteManager.EventRouteInit(asyncControllers)
-	asyncControllers.Add(1)
+	if k.shard != nil {
+		k.sharder, err = clustermesh.NewSharder(kc, *k.shard, k.clusterManager)
+		if err != nil {
+			return err
+		}
+		// the replica gaining a cluster resumes from the checkpoint of its
+		// previous owner, or from its own file before sharding
+		k.clusterManager.Checkpoints = events.NewSeededCheckpointStore(
+			events.NewConfigMapCheckpointStore(kc, k.sharder.Namespace(), k.sharder.Name()+"-checkpoint"),
+			events.NewFileCheckpointStore(k.dataDir))
+		k.clusterManager.Health.Replica = k.sharder.Identity()
+		go k.sharder.Run()
+	}
+	if k.elector == nil {
+		close(k.ready)
+		k.startControllers(asyncControllers)
+		asyncControllers.Wait()
+		return nil
+	}
 
+	// the next leader resumes from the checkpoints of the previous one, the
+	// first from its files before leader election
+	k.clusterManager.Checkpoints = events.NewSeededCheckpointStore(
+		events.NewConfigMapCheckpointStore(kc, k.elector.Namespace(), k.elector.Name()+"-checkpoint"),
+		events.NewFileCheckpointStore(k.dataDir))
+	k.clusterManager.SetLeading(false)
+	k.eventRouteManager.SetLeading(false)
+	close(k.ready)
+	go k.elector.Run()
+	if k.elector.Mode() == leader.ModeActiveActive {
+		k.startControllers(asyncControllers)
+	}
 	asyncControllers.Wait()
 	return nil
 }
 
+// startControllers starts the cluster source and the CRD informers, once.
+func (k *K8sWatcher) startControllers(asyncControllers *sync.WaitGroup) {
+	k.startOnce.Do(func() {
+		k.clusterManager.ClusterMeshInit(asyncControllers)
+		asyncControllers.Add(1)
+
+		k.eventRouteManager.ReceiverInit(asyncControllers)
+		k.eventRouteManager.EventRouteInit(asyncControllers)
+		asyncControllers.Add(1)
+	})
+}
+
+// StartLeading starts the cluster watchers and the config generation; in
+// the active-passive mode the controllers start on the first lead.
+func (k *K8sWatcher) StartLeading() {
+	k.clusterManager.SetLeading(true)
+	k.eventRouteManager.SetLeading(true)
+	go k.startControllers(&sync.WaitGroup{})
+}
+
+// StopLeading stops the cluster watchers and returns once their checkpoints
+// are saved.
+func (k *K8sWatcher) StopLeading() {
+	k.eventRouteManager.SetLeading(false)
+	k.clusterManager.SetLeading(false)
+}
+
+// Stop hands the clusters over to the next leader, or stops them and saves
+// their checkpoints when the replica is alone.
+func (k *K8sWatcher) Stop() {
+	if k.elector != nil {
+		k.elector.Stop()
+		return
+	}
+	select {
+	case <-k.ready:
+		k.clusterManager.SetLeading(false)
+	default:
+	}
+	// the clusters are stopped before leaving, for the next owners to
+	// resume them from their checkpoints
+	if k.sharder != nil {
+		k.sharder.Stop()
+	}
+}
+
+// Serving reports whether the replica serves the read APIs: it leads, is
+// alone, or follows in the active-active mode.
+func (k *K8sWatcher) Serving() bool {
+	if k.elector == nil {
+		return true
+	}
+	return k.elector.Mode() == leader.ModeActiveActive || k.elector.IsLeader()
+}
+
+// LeaderStatus returns the leadership seen by the replica.
+func (k *K8sWatcher) LeaderStatus() leader.Status {
+	if k.elector == nil {
+		return leader.Status{Leading: true}
+	}
+	return k.elector.Status()
+}
+
+// ClusterStatus returns the state of the clusters, standby on a replica
+// that does not lead.
+func (k *K8sWatcher) ClusterStatus() []clustermesh.ClusterStatus {
+	select {
+	case <-k.ready:
+		return k.clusterManager.Status()
+	default:
+		return nil
+	}
+}
+
 // GetStore returns the k8s cache store for the given resource name.
 func (k *K8sWatcher) GetStore(name string) cache.Store {
 	switch name {
@@ -262,13 +262,14 @@ func NewPipelineBuilder(r prometheus.Registerer) *PipelineBuilder {
 	}
 }
 
-// New returns a map of receivers to Stages.
+// New returns a map of receivers to Stages. wait and notificationLog are
+// nil when the replica notifies alone.
 func (pb *PipelineBuilder) New(
 	receivers map[string][]Integration,
-	//wait func() time.Duration,
+	wait func() time.Duration,
 	//inhibitor *inhibit.Inhibitor,
 	//silencer *silence.Silencer,
-	//notificationLog NotificationLog,
+	notificationLog NotificationLog,
 	//peer *cluster.Peer,
 ) RoutingStage {
 	rs := make(RoutingStage, len(receivers))
@@ -278,7 +279,7 @@ func (pb *PipelineBuilder) New(
 	//ss := NewMuteStage(silencer)
 
 	for name := range receivers {
-		st := createReceiverStage(name, receivers[name], pb.metrics)
+		st := createReceiverStage(name, receivers[name], wait, notificationLog, pb.metrics)
 		rs[name] = MultiStage{st}
 	}
 	return rs
@@ -288,22 +289,28 @@ func (pb *PipelineBuilder) New(
 func createReceiverStage(
 	name string,
 	integrations []Integration,
-	//	wait func() time.Duration,
-	//	notificationLog NotificationLog,
+	wait func() time.Duration,
+	notificationLog NotificationLog,
 	metrics *metrics,
 ) Stage {
 	var fs FanoutStage
 	for i := range integrations {
-		/*recv := &nflogpb.Receiver{
+		recv := &nflogpb.Receiver{
 			GroupName:   name,
 			Integration: integrations[i].Name(),
 			Idx:         uint32(integrations[i].Index()),
-		}*/
+		}
 		var s MultiStage
-		//s = append(s, NewWaitStage(wait))
-		//s = append(s, NewDedupStage(&integrations[i], notificationLog, recv))
+		if wait != nil {
+			s = append(s, NewWaitStage(wait))
+		}
+		if notificationLog != nil {
+			s = append(s, NewDedupStage(&integrations[i], notificationLog, recv))
+		}
 		s = append(s, NewRetryStage(integrations[i], name, metrics))
-		//s = append(s, NewSetNotifiesStage(notificationLog, recv))
+		if notificationLog != nil {
+			s = append(s, NewSetNotifiesStage(notificationLog, recv))
+		}
 
 		fs = append(fs, s)
 	}
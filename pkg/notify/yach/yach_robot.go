@@ -184,9 +184,15 @@ func (n *Notifier) genMarkdown(title string,as []*types.Alert) *Message {
 			}
 		}
 
+		// resolved_by is set on the resolved alerts of event problems
+		_, eventResolved := alert.Annotations["resolved_by"]
 		if _, ok := alert.Labels["event_reason"]; ok {
 			isEvent = true
-			msgList = append(msgList, fmt.Sprintf("\n## 『事件通知』"))
+			if eventResolved {
+				msgList = append(msgList, fmt.Sprintf("\n## 『事件恢复』"))
+			} else {
+				msgList = append(msgList, fmt.Sprintf("\n## 『事件通知』"))
+			}
 			msgList = append(msgList, fmt.Sprintf("\n### 事件%d: %s", key, alert.Labels["event_reason"]))
 
 		} else {
@@ -203,6 +209,9 @@ func (n *Notifier) genMarkdown(title string,as []*types.Alert) *Message {
 				msgList = append(msgList, fmt.Sprintf("\n### 原因: %s", alert.Labels["cn_reason"]))
 			}
 		}
+		if doc := string(alert.Annotations["reason_doc"]); len(doc) > 0 {
+			msgList = append(msgList, fmt.Sprintf("### 文档: %s", doc))
+		}
 
 
 		msgList = append(msgList, fmt.Sprintf("### 级别: %s", labels.Severity))
@@ -212,6 +221,17 @@ func (n *Notifier) genMarkdown(title string,as []*types.Alert) *Message {
 			msgList = append(msgList, fmt.Sprintf("### 描述:"))
 			msgList = append(msgList, fmt.Sprintf("> %s", message))
 		}
+		if container := string(alert.Annotations["container"]); len(container) > 0 {
+			state := fmt.Sprintf("重启 %s 次", alert.Annotations["restart_count"])
+			if exitCode := string(alert.Annotations["exit_code"]); len(exitCode) > 0 {
+				state += fmt.Sprintf(", 退出码 %s %s", exitCode, alert.Annotations["exit_reason"])
+			}
+			msgList = append(msgList, fmt.Sprintf("### 容器: %s (%s)", container, state))
+		}
+		if logTail := string(alert.Annotations["log_tail"]); len(logTail) > 0 {
+			msgList = append(msgList, fmt.Sprintf("### 日志:"))
+			msgList = append(msgList, fmt.Sprintf("```\n%s\n```", logTail))
+		}
 		msgList = append(msgList, fmt.Sprintf("### Lables:"))
 		msgList = append(msgList, fmt.Sprintf("> cluster：%s", labels.Cluster))
 		if len(labels.Node) > 0 {
@@ -240,11 +260,17 @@ func (n *Notifier) genMarkdown(title string,as []*types.Alert) *Message {
 		}
 		time := string(alert.StartsAt.Format("2006-01-02 15:04:05"))
 		msgList = append(msgList, fmt.Sprintf("\n### 开始时间: %s", time))
+		if count := string(alert.Annotations["count"]); isEvent && len(count) > 0 && count != "1" {
+			msgList = append(msgList, fmt.Sprintf("\n### 次数: %s (首次: %s)", count, alert.Annotations["first_seen"]))
+		}
 
-		if !isEvent && !alert.EndsAt.IsZero() {
+		if (!isEvent || eventResolved) && !alert.EndsAt.IsZero() {
 			time2 := string(alert.EndsAt.Format("2006-01-02 15:04:05"))
 			msgList = append(msgList, fmt.Sprintf("\n### 恢复时间: %s", time2))
 		}
+		if eventResolved {
+			msgList = append(msgList, fmt.Sprintf("\n### 恢复事件: %s", alert.Annotations["resolved_by"]))
+		}
 		urlStr := "https://cloud.tal.com/"
 		if envStr == "test" || envStr == "dev" {
 			urlStr = "https://cloud-test.tal.com/"
@@ -253,14 +279,19 @@ func (n *Notifier) genMarkdown(title string,as []*types.Alert) *Message {
 		params := fmt.Sprintf("reason=%s&severity=%s&cluster=%s&namespace=%s&obj_kind=%s&source_host=%s&datetime=%s",alert.Labels["event_reason"],strings.ToLower(labels.Severity),labels.Cluster,labels.Namespace,alert.Labels["obj_kind"],labels.Node,timeStr)
 		msgList = append(msgList, fmt.Sprintf("\n### 详情链接: %s", fmt.Sprintf("%shunter/notification/events?%s",urlStr,params)))
 
-		if _, ok := alert.Labels["workcode"]; ok   {
-			if alert.Labels["workcode"] != "" {
+		// the owners of every alert in the group are mentioned
+		workcodes := splitMentions(string(alert.Labels["workcode"]))
+		mobiles := splitMentions(string(alert.Labels["mobile"]))
+		if len(workcodes) > 0 || len(mobiles) > 0 {
+			if msg.At == nil {
 				msg.At = &YachAt{
 					AtMobiles: []string{},
-					AtYachIds: []string{string(alert.Labels["workcode"])},
-					IsAtAll: false,
+					AtYachIds: []string{},
+					IsAtAll:   false,
 				}
 			}
+			msg.At.AtYachIds = appendMissing(msg.At.AtYachIds, workcodes)
+			msg.At.AtMobiles = appendMissing(msg.At.AtMobiles, mobiles)
 		}
 	}
 
@@ -271,3 +302,30 @@ func (n *Notifier) genMarkdown(title string,as []*types.Alert) *Message {
 
 	return msg
 }
+
+// splitMentions splits the comma separated workcode and mobile labels.
+func splitMentions(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); len(item) > 0 {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func appendMissing(list []string, items []string) []string {
+	for _, item := range items {
+		found := false
+		for _, have := range list {
+			if have == item {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, item)
+		}
+	}
+	return list
+}
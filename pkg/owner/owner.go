@@ -0,0 +1,150 @@
+package owner
+
+import (
+	"github.com/crain-cn/event-mesh/pkg/logging"
+	"github.com/crain-cn/event-mesh/pkg/logging/logfields"
+	"strings"
+	"sync"
+	"time"
+)
+
+var log = logging.DefaultLogger.WithField(logfields.LogSubsys, "owner")
+
+const (
+	// AnnotationOwner lists the workcodes of the owners of a workload or a
+	// namespace, separated by commas.
+	AnnotationOwner = "eventmesh.io/owner"
+	// AnnotationOwnerMobile lists their mobile numbers, separated by commas.
+	AnnotationOwnerMobile = "eventmesh.io/owner-mobile"
+)
+
+// Owner is someone to mention in the notifications of a workload.
+type Owner struct {
+	Name     string `yaml:"name"`
+	Workcode string `yaml:"workcode"`
+	Mobile   string `yaml:"mobile"`
+}
+
+// Source loads the owners of workloads, keyed by Key. Owners of a whole
+// namespace are keyed with an empty workload.
+type Source interface {
+	Name() string
+	Load() (map[string][]Owner, error)
+}
+
+func Key(namespace, workload string) string {
+	return namespace + "|" + workload
+}
+
+// Directory keeps the owners loaded from its sources and reloads them every
+// interval. A source that fails to load keeps the owners it loaded last.
+type Directory struct {
+	sources  []Source
+	interval time.Duration
+	lock     sync.RWMutex
+	loaded   []map[string][]Owner
+}
+
+func NewDirectory(interval time.Duration, sources ...Source) *Directory {
+	return &Directory{
+		sources:  sources,
+		interval: interval,
+		loaded:   make([]map[string][]Owner, len(sources)),
+	}
+}
+
+// Refresh loads every source once.
+func (d *Directory) Refresh() {
+	for i, source := range d.sources {
+		owners, err := source.Load()
+		if err != nil {
+			log.WithError(err).Error("load owners from ", source.Name())
+			continue
+		}
+		d.lock.Lock()
+		d.loaded[i] = owners
+		d.lock.Unlock()
+	}
+}
+
+// Run refreshes the directory every interval until stopCh is closed. Call
+// Refresh first to have the owners at hand when Run starts.
+func (d *Directory) Run(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			d.Refresh()
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+// Lookup returns the owners of the workload from the first source that knows
+// them, or else the owners of its namespace.
+func (d *Directory) Lookup(namespace, workload string) []Owner {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	for _, key := range []string{Key(namespace, workload), Key(namespace, "")} {
+		for _, owners := range d.loaded {
+			if o, ok := owners[key]; ok && len(o) > 0 {
+				return o
+			}
+		}
+	}
+	return nil
+}
+
+// FromAnnotations returns the owners listed in the annotations of an object.
+// Workcodes and mobile numbers are paired by position.
+func FromAnnotations(annotations map[string]string) []Owner {
+	workcodes := splitList(annotations[AnnotationOwner])
+	mobiles := splitList(annotations[AnnotationOwnerMobile])
+	n := len(workcodes)
+	if len(mobiles) > n {
+		n = len(mobiles)
+	}
+	owners := make([]Owner, n)
+	for i := range owners {
+		if i < len(workcodes) {
+			owners[i].Workcode = workcodes[i]
+		}
+		if i < len(mobiles) {
+			owners[i].Mobile = mobiles[i]
+		}
+	}
+	return owners
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); len(item) > 0 {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Workcodes and Mobiles return the non-empty values of the owners.
+func Workcodes(owners []Owner) []string {
+	var workcodes []string
+	for _, o := range owners {
+		if len(o.Workcode) > 0 {
+			workcodes = append(workcodes, o.Workcode)
+		}
+	}
+	return workcodes
+}
+
+func Mobiles(owners []Owner) []string {
+	var mobiles []string
+	for _, o := range owners {
+		if len(o.Mobile) > 0 {
+			mobiles = append(mobiles, o.Mobile)
+		}
+	}
+	return mobiles
+}
@@ -0,0 +1,110 @@
+package owner
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+type staticSource struct {
+	owners map[string][]Owner
+	err    error
+}
+
+func (s *staticSource) Name() string {
+	return "static"
+}
+
+func (s *staticSource) Load() (map[string][]Owner, error) {
+	return s.owners, s.err
+}
+
+func TestDirectoryLookup(t *testing.T) {
+	first := &staticSource{owners: map[string][]Owner{
+		Key("shop", "cart"): {{Workcode: "1"}},
+	}}
+	second := &staticSource{owners: map[string][]Owner{
+		Key("shop", "cart"):  {{Workcode: "2"}},
+		Key("shop", "order"): {{Workcode: "3"}},
+		Key("shop", ""):      {{Workcode: "4"}},
+	}}
+	d := NewDirectory(0, first, second)
+	d.Refresh()
+
+	tests := []struct {
+		namespace, workload string
+		expected            []Owner
+	}{
+		// the first source that knows the workload wins
+		{"shop", "cart", []Owner{{Workcode: "1"}}},
+		{"shop", "order", []Owner{{Workcode: "3"}}},
+		// unknown workloads fall back to the namespace
+		{"shop", "search", []Owner{{Workcode: "4"}}},
+		{"blog", "post", nil},
+	}
+	for _, test := range tests {
+		if got := d.Lookup(test.namespace, test.workload); !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("%s/%s:\nexpected:\n%v\ngot:\n%v", test.namespace, test.workload, test.expected, got)
+		}
+	}
+
+	// a failed refresh keeps what the source loaded last
+	first.owners, first.err = nil, errors.New("db down")
+	d.Refresh()
+	expected := []Owner{{Workcode: "1"}}
+	if got := d.Lookup("shop", "cart"); !reflect.DeepEqual(got, expected) {
+		t.Errorf("\nexpected:\n%v\ngot:\n%v", expected, got)
+	}
+}
+
+func TestFileSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "owner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "owners.yaml")
+	data := `
+owners:
+- namespace: shop
+  workload: cart
+  owners:
+  - name: Alice
+    workcode: "012345"
+    mobile: "13800000000"
+- namespace: shop
+  owners:
+  - workcode: "054321"
+`
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := NewFileSource(path).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string][]Owner{
+		Key("shop", "cart"): {{Name: "Alice", Workcode: "012345", Mobile: "13800000000"}},
+		Key("shop", ""):     {{Workcode: "054321"}},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("\nexpected:\n%v\ngot:\n%v", expected, got)
+	}
+}
+
+func TestFromAnnotations(t *testing.T) {
+	got := FromAnnotations(map[string]string{
+		AnnotationOwner:       "012345, 054321",
+		AnnotationOwnerMobile: "13800000000",
+	})
+	expected := []Owner{{Workcode: "012345", Mobile: "13800000000"}, {Workcode: "054321"}}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("\nexpected:\n%v\ngot:\n%v", expected, got)
+	}
+	if got := FromAnnotations(nil); len(got) != 0 {
+		t.Errorf("\nexpected:\n%v\ngot:\n%v", nil, got)
+	}
+}
@@ -0,0 +1,99 @@
+package owner
+
+import (
+	"github.com/crain-cn/event-mesh/api/model"
+	"github.com/crain-cn/event-mesh/cmd/config"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+)
+
+// NewDirectoryFor returns the directory of the db and file sources in opt.
+// Annotations are read by the event watchers of each cluster.
+func NewDirectoryFor(opt *config.OwnerDirectoryOpt) *Directory {
+	var sources []Source
+	for _, name := range opt.Sources {
+		switch name {
+		case config.OwnerSourceDB:
+			sources = append(sources, NewDBSource())
+		case config.OwnerSourceFile:
+			sources = append(sources, NewFileSource(opt.File))
+		case config.OwnerSourceAnnotations:
+		default:
+			log.Warning("unknown owner source: ", name)
+		}
+	}
+	return NewDirectory(opt.RefreshInterval, sources...)
+}
+
+// dbSource reads the app managers of the platform database.
+type dbSource struct{}
+
+func NewDBSource() Source {
+	return dbSource{}
+}
+
+func (dbSource) Name() string {
+	return "db"
+}
+
+func (dbSource) Load() (map[string][]Owner, error) {
+	apps, err := model.GetAppOwnersAll()
+	if err != nil {
+		return nil, err
+	}
+	owners := make(map[string][]Owner, len(apps))
+	for _, app := range apps {
+		key := Key(app.Namespace, app.Deployment)
+		owners[key] = append(owners[key], Owner{Name: app.Name, Workcode: app.Workcode})
+	}
+	return owners, nil
+}
+
+// fileSource reads a YAML file like
+//
+//	owners:
+//	- namespace: shop
+//	  workload: cart
+//	  owners:
+//	  - name: Alice
+//	    workcode: "012345"
+//	    mobile: "13800000000"
+//
+// An entry without a workload is for the whole namespace. The file is read
+// again on every refresh.
+type fileSource struct {
+	path string
+}
+
+type ownerFile struct {
+	Owners []struct {
+		Namespace string  `yaml:"namespace"`
+		Workload  string  `yaml:"workload"`
+		Owners    []Owner `yaml:"owners"`
+	} `yaml:"owners"`
+}
+
+func NewFileSource(path string) Source {
+	return &fileSource{path: path}
+}
+
+func (s *fileSource) Name() string {
+	return "file " + s.path
+}
+
+func (s *fileSource) Load() (map[string][]Owner, error) {
+	data, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return nil, err
+	}
+	var f ownerFile
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, err
+	}
+	owners := make(map[string][]Owner, len(f.Owners))
+	for _, entry := range f.Owners {
+		key := Key(entry.Namespace, entry.Workload)
+		owners[key] = append(owners[key], entry.Owners...)
+	}
+	return owners, nil
+}
@@ -0,0 +1,196 @@
+package peer
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	goredis "github.com/go-redis/redis/v8"
+	"github.com/prometheus/alertmanager/nflog"
+	"github.com/prometheus/alertmanager/nflog/nflogpb"
+	"sync"
+	"time"
+)
+
+// NotificationLog is the notification log of alertmanager, replicated
+// through Redis as alertmanager gossips it between its peers: the entries
+// logged are kept in a hash, for the peers starting to read, and published
+// for the peers running to merge.
+type NotificationLog struct {
+	nflog  *nflog.Log
+	client goredis.UniversalClient
+	// key is the hash of the entries, by group and receiver, and the
+	// channel the entries are published on.
+	key    string
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// merge serializes the merges, merging is the entry merged, which the
+	// log broadcasts again when it is new.
+	merge   sync.Mutex
+	mtx     sync.Mutex
+	merging []byte
+}
+
+// NewNotificationLog returns the notification log of the peers of prefix,
+// with the entries of Redis, which keeps them for retention.
+func NewNotificationLog(ctx context.Context, client goredis.UniversalClient, prefix string, retention time.Duration) (*NotificationLog, error) {
+	l, err := nflog.New(nflog.WithRetention(retention))
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	n := &NotificationLog{
+		nflog:  l,
+		client: client,
+		key:    prefix + ":nflog",
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	sub := client.Subscribe(ctx, n.key)
+	if _, err := sub.Receive(ctx); err != nil {
+		cancel()
+		sub.Close()
+		return nil, err
+	}
+	entries, err := client.HGetAll(ctx, n.key).Result()
+	if err != nil {
+		cancel()
+		sub.Close()
+		return nil, err
+	}
+	for _, b := range entries {
+		n.mergeEntry([]byte(b))
+	}
+	l.SetBroadcast(n.broadcast)
+	go n.receive(sub)
+	go n.runGC(retention)
+	return n, nil
+}
+
+// Log logs the notification of the alerts, and replicates it.
+func (n *NotificationLog) Log(r *nflogpb.Receiver, gkey string, firingAlerts, resolvedAlerts []uint64) error {
+	return n.nflog.Log(r, gkey, firingAlerts, resolvedAlerts)
+}
+
+// Query queries the log, with the entries of the peers merged.
+func (n *NotificationLog) Query(params ...nflog.QueryParam) ([]*nflogpb.Entry, error) {
+	return n.nflog.Query(params...)
+}
+
+// Close stops the replication.
+func (n *NotificationLog) Close() {
+	n.cancel()
+}
+
+func (n *NotificationLog) receive(sub *goredis.PubSub) {
+	defer sub.Close()
+	ch := sub.Channel()
+	for {
+		select {
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			n.mergeEntry([]byte(msg.Payload))
+		case <-n.ctx.Done():
+			return
+		}
+	}
+}
+
+func (n *NotificationLog) mergeEntry(b []byte) {
+	n.merge.Lock()
+	defer n.merge.Unlock()
+	n.setMerging(b)
+	defer n.setMerging(nil)
+	if err := n.nflog.Merge(b); err != nil {
+		log.WithError(err).Error("merge notification log entry")
+	}
+}
+
+func (n *NotificationLog) setMerging(b []byte) {
+	n.mtx.Lock()
+	n.merging = b
+	n.mtx.Unlock()
+}
+
+func (n *NotificationLog) isMerging(b []byte) bool {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	return n.merging != nil && bytes.Equal(n.merging, b)
+}
+
+// broadcast keeps and publishes an entry logged; an entry merged is not
+// published again.
+func (n *NotificationLog) broadcast(b []byte) {
+	if n.isMerging(b) {
+		return
+	}
+	e, err := decodeEntry(b)
+	if err != nil {
+		log.WithError(err).Error("decode notification log entry")
+		return
+	}
+	pipe := n.client.TxPipeline()
+	pipe.HSet(n.ctx, n.key, entryKey(e.Entry), b)
+	pipe.Publish(n.ctx, n.key, b)
+	if _, err := pipe.Exec(n.ctx); err != nil {
+		log.WithError(err).Error("replicate notification log entry")
+	}
+}
+
+// runGC removes the entries expired from the log and from Redis.
+func (n *NotificationLog) runGC(retention time.Duration) {
+	ticker := time.NewTicker(retention / 8)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			n.gc()
+		case <-n.ctx.Done():
+			return
+		}
+	}
+}
+
+func (n *NotificationLog) gc() {
+	if _, err := n.nflog.GC(); err != nil {
+		log.WithError(err).Error("notification log gc")
+	}
+	entries, err := n.client.HGetAll(n.ctx, n.key).Result()
+	if err != nil {
+		log.WithError(err).Error("read notification log")
+		return
+	}
+	now := time.Now()
+	for key, b := range entries {
+		e, err := decodeEntry([]byte(b))
+		if err != nil || e.ExpiresAt.Before(now) {
+			n.client.HDel(n.ctx, n.key, key)
+		}
+	}
+}
+
+// decodeEntry decodes an entry broadcast, delimited by its length.
+func decodeEntry(b []byte) (*nflogpb.MeshEntry, error) {
+	size, n := binary.Uvarint(b)
+	if n <= 0 || uint64(len(b)-n) < size {
+		return nil, errors.New("invalid notification log entry")
+	}
+	var e nflogpb.MeshEntry
+	if err := e.Unmarshal(b[n : n+int(size)]); err != nil {
+		return nil, err
+	}
+	if e.Entry == nil || e.Entry.Receiver == nil {
+		return nil, errors.New("notification log entry without receiver")
+	}
+	return &e, nil
+}
+
+// entryKey is the key of the entry in the log, by group and receiver.
+func entryKey(e *nflogpb.Entry) string {
+	r := e.Receiver
+	return fmt.Sprintf("%s:%s/%s/%d", e.GroupKey, r.GroupName, r.Integration, r.Idx)
+}
@@ -0,0 +1,123 @@
+package peer
+
+import (
+	"context"
+	"github.com/crain-cn/event-mesh/pkg/logging"
+	"github.com/crain-cn/event-mesh/pkg/logging/logfields"
+	goredis "github.com/go-redis/redis/v8"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	log = logging.DefaultLogger.WithField(logfields.LogSubsys, "peer")
+)
+
+// Peer is a replica notifying from the alerts shared through Redis. The
+// peers are ordered by name; a peer waits for its position times the peer
+// timeout before it notifies, for the notification log of the peers before
+// to tell it the notification was sent.
+type Peer struct {
+	client goredis.UniversalClient
+	// key is the sorted set of the peers, scored by their last heartbeat.
+	key     string
+	name    string
+	timeout time.Duration
+
+	mtx      sync.Mutex
+	position int
+	peers    []string
+}
+
+// NewPeer returns the peer name among the ones of prefix; a peer that did
+// not beat for timeout is gone.
+func NewPeer(client goredis.UniversalClient, prefix, name string, timeout time.Duration) *Peer {
+	return &Peer{
+		client:  client,
+		key:     prefix + ":peers",
+		name:    name,
+		timeout: timeout,
+	}
+}
+
+// Run beats and reads the peers every half timeout until ctx is done, then
+// leaves for the next peer to notify at once.
+func (p *Peer) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.timeout / 2)
+	defer ticker.Stop()
+	for {
+		if err := p.Refresh(ctx); err != nil {
+			log.WithError(err).Error("refresh peers")
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			p.leave()
+			return
+		}
+	}
+}
+
+// Refresh beats and reads the peers once, for the position of the peer to be
+// known before it notifies.
+func (p *Peer) Refresh(ctx context.Context) error {
+	now := time.Now()
+	pipe := p.client.TxPipeline()
+	pipe.ZAdd(ctx, p.key, &goredis.Z{Score: float64(now.UnixNano()), Member: p.name})
+	// forget the peers gone long ago
+	pipe.ZRemRangeByScore(ctx, p.key, "-inf", "("+strconv.FormatInt(now.Add(-10*p.timeout).UnixNano(), 10))
+	alive := pipe.ZRangeByScore(ctx, p.key, &goredis.ZRangeBy{
+		Min: strconv.FormatInt(now.Add(-p.timeout).UnixNano(), 10),
+		Max: "+inf",
+	})
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+	peers := alive.Val()
+	sort.Strings(peers)
+	position := sort.SearchStrings(peers, p.name)
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if p.position != position || len(p.peers) != len(peers) {
+		log.Info("peers: ", peers, ", position: ", position)
+	}
+	p.position = position
+	p.peers = peers
+	return nil
+}
+
+func (p *Peer) leave() {
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+	if err := p.client.ZRem(ctx, p.key, p.name).Err(); err != nil {
+		log.WithError(err).Error("leave peers")
+	}
+}
+
+// Name is the name of the peer.
+func (p *Peer) Name() string {
+	return p.name
+}
+
+// Position returns the position of the peer, 0 until the peers are read by
+// Refresh.
+func (p *Peer) Position() int {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	return p.position
+}
+
+// Peers returns the names of the peers alive, sorted.
+func (p *Peer) Peers() []string {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	return p.peers
+}
+
+// Wait returns how long the peer waits before it notifies.
+func (p *Peer) Wait() time.Duration {
+	return time.Duration(p.Position()) * p.timeout
+}
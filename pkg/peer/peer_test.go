@@ -0,0 +1,92 @@
+package peer
+
+import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/go-redis/redis/v8"
+	"github.com/prometheus/alertmanager/nflog"
+	"github.com/prometheus/alertmanager/nflog/nflogpb"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPeerPosition(t *testing.T) {
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	client := goredis.NewClient(&goredis.Options{Addr: s.Addr()})
+	ctx := context.Background()
+
+	a := NewPeer(client, "test", "event-mesh-a", time.Minute)
+	b := NewPeer(client, "test", "event-mesh-b", time.Minute)
+	for _, p := range []*Peer{b, a, b} {
+		if err := p.Refresh(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if a.Position() != 0 || b.Position() != 1 {
+		t.Errorf("\nexpected:\n%v\ngot:\n%v", []int{0, 1}, []int{a.Position(), b.Position()})
+	}
+	if b.Wait() != time.Minute {
+		t.Errorf("\nexpected:\n%v\ngot:\n%v", time.Minute, b.Wait())
+	}
+
+	// b notifies first once a left
+	a.leave()
+	if err := b.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(b.Peers(), []string{"event-mesh-b"}) || b.Wait() != 0 {
+		t.Errorf("\nexpected:\n%v\ngot:\n%v", []string{"event-mesh-b"}, b.Peers())
+	}
+}
+
+func TestNotificationLogReplicated(t *testing.T) {
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	client := goredis.NewClient(&goredis.Options{Addr: s.Addr()})
+	ctx := context.Background()
+
+	a, err := NewNotificationLog(ctx, client, "test", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	b, err := NewNotificationLog(ctx, client, "test", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	recv := &nflogpb.Receiver{GroupName: "yach", Integration: "yach", Idx: 0}
+	if err := a.Log(recv, "{}:{cluster=\"prod\"}", []uint64{1, 2}, nil); err != nil {
+		t.Fatal(err)
+	}
+	query := func(l *NotificationLog) []*nflogpb.Entry {
+		entries, _ := l.Query(nflog.QGroupKey("{}:{cluster=\"prod\"}"), nflog.QReceiver(recv))
+		return entries
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(query(b)) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if entries := query(b); len(entries) != 1 || !reflect.DeepEqual(entries[0].FiringAlerts, []uint64{1, 2}) {
+		t.Errorf("\nexpected:\n%v\ngot:\n%v", []uint64{1, 2}, entries)
+	}
+
+	// a replica starting reads the entries logged before
+	c, err := NewNotificationLog(ctx, client, "test", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if len(query(c)) != 1 {
+		t.Errorf("\nexpected:\n%v\ngot:\n%v", 1, query(c))
+	}
+}
@@ -0,0 +1,354 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/crain-cn/event-mesh/cmd/config"
+	"github.com/crain-cn/event-mesh/pkg/logging"
+	"github.com/crain-cn/event-mesh/pkg/logging/logfields"
+	"github.com/crain-cn/event-mesh/pkg/provider"
+	goredis "github.com/go-redis/redis/v8"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/common/model"
+	"github.com/sirupsen/logrus"
+	"sync"
+	"time"
+)
+
+const (
+	alertChannelLength = 10000
+	// putRetries bounds the merges of an alert put concurrently by several
+	// replicas.
+	putRetries = 10
+)
+
+// NewClient returns a client of the Redis of a session store; the timeouts
+// are in seconds.
+func NewClient(opt *config.RedisOpt) *goredis.Client {
+	return goredis.NewClient(&goredis.Options{
+		Addr:        opt.Address,
+		Password:    opt.Password,
+		PoolSize:    opt.PoolSise,
+		ReadTimeout: time.Duration(opt.ReadTimeout) * time.Second,
+		IdleTimeout: time.Duration(opt.IdleTimeout) * time.Second,
+	})
+}
+
+// Alerts keeps the alerts in Redis, shared by the replicas: an alert put by
+// one is merged with the one put by another, and published to the
+// subscribers of all. All methods are goroutine-safe.
+type Alerts struct {
+	client goredis.UniversalClient
+	// prefix:alerts is the set of the fingerprints, prefix:alert:<fp> an
+	// alert and prefix:alerts the channel of the alerts put.
+	prefix string
+	marker types.Marker
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mtx       sync.Mutex
+	listeners map[int]listeningAlerts
+	next      int
+	// seen are the alerts received, to be deleted from the marker once
+	// resolved, whichever replica removes them from Redis.
+	seen   map[model.Fingerprint]struct{}
+	logger *logrus.Entry
+}
+
+type listeningAlerts struct {
+	alerts chan *types.Alert
+	done   chan struct{}
+}
+
+// NewAlerts returns an alert provider on the Redis of client, which removes
+// the resolved alerts every intervalGC.
+func NewAlerts(ctx context.Context, client goredis.UniversalClient, prefix string, m types.Marker, intervalGC time.Duration) (*Alerts, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	a := &Alerts{
+		client:    client,
+		prefix:    prefix,
+		marker:    m,
+		ctx:       ctx,
+		cancel:    cancel,
+		listeners: map[int]listeningAlerts{},
+		seen:      map[model.Fingerprint]struct{}{},
+		logger:    logging.DefaultLogger.WithField(logfields.LogSubsys, "provider"),
+	}
+	sub := client.Subscribe(ctx, a.channel())
+	// wait for the subscription, for no alert put from now on to be missed
+	if _, err := sub.Receive(ctx); err != nil {
+		cancel()
+		sub.Close()
+		return nil, err
+	}
+	go a.receive(sub)
+	go a.runGC(intervalGC)
+	return a, nil
+}
+
+// Close the alert provider.
+func (a *Alerts) Close() {
+	if a.cancel != nil {
+		a.cancel()
+	}
+}
+
+func (a *Alerts) channel() string {
+	return a.prefix + ":alerts"
+}
+
+func (a *Alerts) indexKey() string {
+	return a.prefix + ":alerts"
+}
+
+func (a *Alerts) alertKey(fp model.Fingerprint) string {
+	return a.prefix + ":alert:" + fp.String()
+}
+
+// receive passes the alerts put by any replica to the listeners.
+func (a *Alerts) receive(sub *goredis.PubSub) {
+	defer sub.Close()
+	ch := sub.Channel()
+	for {
+		select {
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			var alert types.Alert
+			if err := json.Unmarshal([]byte(msg.Payload), &alert); err != nil {
+				a.logger.WithError(err).Error("decode alert")
+				continue
+			}
+			a.Listeners(&alert)
+		case <-a.ctx.Done():
+			return
+		}
+	}
+}
+
+// runGC removes the resolved alerts, as the memory provider does.
+func (a *Alerts) runGC(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			a.gc()
+		case <-a.ctx.Done():
+			return
+		}
+	}
+}
+
+func (a *Alerts) gc() {
+	alerts, err := a.list()
+	if err != nil {
+		a.logger.WithError(err).Error("list alerts")
+		return
+	}
+	current := make(map[model.Fingerprint]struct{}, len(alerts))
+	for _, alert := range alerts {
+		fp := alert.Fingerprint()
+		if !alert.Resolved() {
+			current[fp] = struct{}{}
+			continue
+		}
+		pipe := a.client.TxPipeline()
+		pipe.Del(a.ctx, a.alertKey(fp))
+		pipe.SRem(a.ctx, a.indexKey(), fp.String())
+		if _, err := pipe.Exec(a.ctx); err != nil {
+			a.logger.WithError(err).Error("delete alert ", fp)
+			current[fp] = struct{}{}
+		}
+	}
+
+	a.mtx.Lock()
+	for fp := range a.seen {
+		if _, ok := current[fp]; !ok {
+			delete(a.seen, fp)
+			a.marker.Delete(fp)
+		}
+	}
+	for i, l := range a.listeners {
+		select {
+		case <-l.done:
+			delete(a.listeners, i)
+			close(l.alerts)
+		default:
+			// listener is not closed yet, hence proceed.
+		}
+	}
+	a.mtx.Unlock()
+}
+
+// list returns the alerts in Redis; an alert removed while listed is left
+// out.
+func (a *Alerts) list() ([]*types.Alert, error) {
+	fps, err := a.client.SMembers(a.ctx, a.indexKey()).Result()
+	if err != nil || len(fps) == 0 {
+		return nil, err
+	}
+	keys := make([]string, 0, len(fps))
+	for _, fp := range fps {
+		keys = append(keys, a.prefix+":alert:"+fp)
+	}
+	values, err := a.client.MGet(a.ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	alerts := make([]*types.Alert, 0, len(values))
+	for i, value := range values {
+		s, ok := value.(string)
+		if !ok {
+			continue
+		}
+		var alert types.Alert
+		if err := json.Unmarshal([]byte(s), &alert); err != nil {
+			a.logger.WithError(err).Error("decode alert ", fps[i])
+			continue
+		}
+		alerts = append(alerts, &alert)
+	}
+	return alerts, nil
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// Subscribe returns an iterator over active alerts that have not been
+// resolved and successfully notified about.
+// They are not guaranteed to be in chronological order.
+func (a *Alerts) Subscribe() provider.AlertIterator {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	// the alerts put from now on are still received when Redis can not
+	// be read
+	alerts, err := a.list()
+	if err != nil {
+		a.logger.WithError(err).Error("list alerts")
+	}
+	var (
+		done = make(chan struct{})
+		ch   = make(chan *types.Alert, max(len(alerts), alertChannelLength))
+	)
+
+	for _, alert := range alerts {
+		a.seen[alert.Fingerprint()] = struct{}{}
+		ch <- alert
+	}
+
+	a.listeners[a.next] = listeningAlerts{alerts: ch, done: done}
+	a.next++
+
+	return provider.NewAlertIterator(ch, done, nil)
+}
+
+// GetPending returns an iterator over all the alerts that have
+// pending notifications.
+func (a *Alerts) GetPending() provider.AlertIterator {
+	var (
+		ch   = make(chan *types.Alert, alertChannelLength)
+		done = make(chan struct{})
+	)
+
+	alerts, err := a.list()
+	go func() {
+		defer close(ch)
+
+		for _, alert := range alerts {
+			select {
+			case ch <- alert:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return provider.NewAlertIterator(ch, done, err)
+}
+
+// Get returns the alert for a given fingerprint.
+func (a *Alerts) Get(fp model.Fingerprint) (*types.Alert, error) {
+	b, err := a.client.Get(a.ctx, a.alertKey(fp)).Bytes()
+	if err == goredis.Nil {
+		return nil, provider.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var alert types.Alert
+	if err := json.Unmarshal(b, &alert); err != nil {
+		return nil, err
+	}
+	return &alert, nil
+}
+
+func (a *Alerts) Listeners(alert *types.Alert) {
+	a.mtx.Lock()
+	a.seen[alert.Fingerprint()] = struct{}{}
+	for _, l := range a.listeners {
+		select {
+		case l.alerts <- alert:
+		case <-l.done:
+		}
+	}
+	a.mtx.Unlock()
+}
+
+// Put adds the given alerts to the set, each merged with the one in Redis
+// in a transaction, which is retried when another replica put it meanwhile.
+func (a *Alerts) Put(alerts ...*types.Alert) error {
+	for _, alert := range alerts {
+		var err error
+		for i := 0; i < putRetries; i++ {
+			err = a.put(alert)
+			if err != goredis.TxFailedErr {
+				break
+			}
+		}
+		if err != nil {
+			a.logger.WithField("msg", "error on set alert").WithError(err).Error()
+		}
+	}
+	return nil
+}
+
+func (a *Alerts) put(alert *types.Alert) error {
+	key := a.alertKey(alert.Fingerprint())
+	return a.client.Watch(a.ctx, func(tx *goredis.Tx) error {
+		merged := alert
+		b, err := tx.Get(a.ctx, key).Bytes()
+		switch err {
+		case nil:
+			var old types.Alert
+			if err := json.Unmarshal(b, &old); err != nil {
+				return err
+			}
+			// Merge alerts if there is an overlap in activity range.
+			if (alert.EndsAt.After(old.StartsAt) && alert.EndsAt.Before(old.EndsAt)) ||
+				(alert.StartsAt.After(old.StartsAt) && alert.StartsAt.Before(old.EndsAt)) {
+				merged = old.Merge(alert)
+			}
+		case goredis.Nil:
+		default:
+			return err
+		}
+		b, err = json.Marshal(merged)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(a.ctx, func(pipe goredis.Pipeliner) error {
+			pipe.Set(a.ctx, key, b, 0)
+			pipe.SAdd(a.ctx, a.indexKey(), merged.Fingerprint().String())
+			pipe.Publish(a.ctx, a.channel(), b)
+			return nil
+		})
+		return err
+	}, key)
+}
@@ -0,0 +1,97 @@
+package redis
+
+import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/crain-cn/event-mesh/pkg/provider"
+	goredis "github.com/go-redis/redis/v8"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"testing"
+	"time"
+)
+
+func newTestAlerts(t *testing.T, addr string) *Alerts {
+	client := goredis.NewClient(&goredis.Options{Addr: addr})
+	alerts, err := NewAlerts(context.Background(), client, "test", types.NewMarker(prometheus.NewRegistry()), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return alerts
+}
+
+func TestAlertsShared(t *testing.T) {
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	a := newTestAlerts(t, s.Addr())
+	defer a.Close()
+	b := newTestAlerts(t, s.Addr())
+	defer b.Close()
+
+	now := time.Now()
+	alert := &types.Alert{
+		Alert: model.Alert{
+			Labels:   model.LabelSet{"alertname": "BackOff", "cluster": "prod"},
+			StartsAt: now,
+			EndsAt:   now.Add(time.Hour),
+		},
+		UpdatedAt: now,
+	}
+	it := b.Subscribe()
+	defer it.Close()
+	if err := a.Put(alert); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case got := <-it.Next():
+		if got.Fingerprint() != alert.Fingerprint() {
+			t.Errorf("\nexpected:\n%v\ngot:\n%v", alert, got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("alert put on a replica not received by the other")
+	}
+
+	// the alert put again by the other replica is merged
+	again := *alert
+	again.StartsAt = now.Add(time.Minute)
+	again.EndsAt = now.Add(2 * time.Hour)
+	again.UpdatedAt = now.Add(time.Minute)
+	if err := b.Put(&again); err != nil {
+		t.Fatal(err)
+	}
+	got, err := a.Get(alert.Fingerprint())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.StartsAt.Equal(alert.StartsAt) || !got.EndsAt.Equal(again.EndsAt) {
+		t.Errorf("\nexpected:\n%v\ngot:\n%v", []time.Time{alert.StartsAt, again.EndsAt}, []time.Time{got.StartsAt, got.EndsAt})
+	}
+
+	// a new subscriber starts with the alerts put before
+	late := a.Subscribe()
+	defer late.Close()
+	select {
+	case got := <-late.Next():
+		if got.Fingerprint() != alert.Fingerprint() {
+			t.Errorf("\nexpected:\n%v\ngot:\n%v", alert, got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("alert put before the subscription not listed")
+	}
+
+	// the resolved alerts are removed
+	resolved := again
+	resolved.EndsAt = now.Add(-time.Second)
+	resolved.UpdatedAt = now.Add(2 * time.Minute)
+	if err := a.Put(&resolved); err != nil {
+		t.Fatal(err)
+	}
+	b.gc()
+	if _, err := a.Get(alert.Fingerprint()); err != provider.ErrNotFound {
+		t.Errorf("\nexpected:\n%v\ngot:\n%v", provider.ErrNotFound, err)
+	}
+}
@@ -0,0 +1,125 @@
+package reason
+
+import (
+	"github.com/crain-cn/event-mesh/api/model"
+	"github.com/crain-cn/event-mesh/cmd/config"
+	"github.com/crain-cn/event-mesh/pkg/logging"
+	"github.com/crain-cn/event-mesh/pkg/logging/logfields"
+	"k8s.io/client-go/kubernetes"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var log = logging.DefaultLogger.WithField(logfields.LogSubsys, "reason")
+
+// Source loads the reason dictionary.
+type Source interface {
+	Name() string
+	Load() ([]*model.EventReasons, error)
+}
+
+// Reason is what the dictionary knows of an event reason.
+type Reason struct {
+	// Label is the readable reason, the cn_reason label of the alerts.
+	Label string
+	Class string
+	Doc   string
+}
+
+// Dictionary keeps the reasons loaded from its source and reloads them every
+// interval, so edits apply without a restart. A failed load keeps the
+// reasons loaded last.
+type Dictionary struct {
+	source   Source
+	interval time.Duration
+	classes  map[int]string
+	lock     sync.RWMutex
+	reasons  map[string]*Reason
+}
+
+func NewDictionary(source Source, interval time.Duration, classes map[int]string) *Dictionary {
+	return &Dictionary{
+		source:   source,
+		interval: interval,
+		classes:  classes,
+		reasons:  make(map[string]*Reason),
+	}
+}
+
+// Refresh loads the source once.
+func (d *Dictionary) Refresh() error {
+	items, err := d.source.Load()
+	if err != nil {
+		return err
+	}
+	reasons := make(map[string]*Reason, len(items))
+	for _, item := range items {
+		reasons[item.Name] = &Reason{
+			Label: item.Label,
+			Class: d.className(item.ClassId),
+			Doc:   item.Doc,
+		}
+	}
+	d.lock.Lock()
+	d.reasons = reasons
+	d.lock.Unlock()
+	return nil
+}
+
+func (d *Dictionary) className(id int) string {
+	if id == 0 {
+		return ""
+	}
+	if name, ok := d.classes[id]; ok {
+		return name
+	}
+	return strconv.Itoa(id)
+}
+
+// Run reloads the dictionary every interval until stopCh is closed. Call
+// Refresh first to have the reasons at hand when Run starts.
+func (d *Dictionary) Run(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := d.Refresh(); err != nil {
+				log.WithError(err).Error("load reasons from ", d.source.Name())
+			}
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+// Lookup returns the reason, or nil when the dictionary does not know it.
+func (d *Dictionary) Lookup(name string) *Reason {
+	if d == nil {
+		return nil
+	}
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	return d.reasons[name]
+}
+
+// NewDictionaryFor returns the dictionary configured by opt. The configmap
+// source reads through kc; it is nil when kc is.
+func NewDictionaryFor(opt *config.ReasonDictionaryOpt, kc kubernetes.Interface) *Dictionary {
+	var source Source
+	switch opt.Source {
+	case config.ReasonSourceConfigMap:
+		if kc == nil {
+			log.Error("no kubernetes client, skipping the reason dictionary of configmap ", opt.ConfigMap)
+			return nil
+		}
+		source = NewConfigMapSource(kc, opt.ConfigMap)
+	default:
+		if opt.Source != config.ReasonSourceDB {
+			log.Warning("unknown reason source, using db: ", opt.Source)
+		}
+		source = NewDBSource()
+	}
+	return NewDictionary(source, opt.RefreshInterval, opt.Classes)
+}
@@ -0,0 +1,113 @@
+package reason
+
+import (
+	"errors"
+	"github.com/crain-cn/event-mesh/api/model"
+	"github.com/crain-cn/event-mesh/cmd/config"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"reflect"
+	"testing"
+)
+
+type staticSource struct {
+	reasons []*model.EventReasons
+	err     error
+}
+
+func (s *staticSource) Name() string {
+	return "static"
+}
+
+func (s *staticSource) Load() ([]*model.EventReasons, error) {
+	return s.reasons, s.err
+}
+
+func TestDictionary(t *testing.T) {
+	source := &staticSource{reasons: []*model.EventReasons{
+		{Name: "BackOff", Label: "容器重启", ClassId: 1, Doc: "https://wiki.example.com/backoff"},
+		{Name: "FailedMount", Label: "挂载失败", ClassId: 2},
+		{Name: "Killing", Label: "容器终止"},
+	}}
+	d := NewDictionary(source, 0, map[int]string{1: "application"})
+	if err := d.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		expected *Reason
+	}{
+		{"BackOff", &Reason{Label: "容器重启", Class: "application", Doc: "https://wiki.example.com/backoff"}},
+		// unnamed classes keep their id
+		{"FailedMount", &Reason{Label: "挂载失败", Class: "2"}},
+		{"Killing", &Reason{Label: "容器终止"}},
+		{"Unknown", nil},
+	}
+	for _, test := range tests {
+		if got := d.Lookup(test.name); !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("%s:\nexpected:\n%v\ngot:\n%v", test.name, test.expected, got)
+		}
+	}
+
+	// edits apply on the next refresh, failures keep the last reasons
+	source.reasons = []*model.EventReasons{{Name: "BackOff", Label: "重启"}}
+	if err := d.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	source.err = errors.New("db down")
+	if err := d.Refresh(); err == nil {
+		t.Errorf("\nexpected:\n%v\ngot:\n%v", source.err, err)
+	}
+	expected := &Reason{Label: "重启"}
+	if got := d.Lookup("BackOff"); !reflect.DeepEqual(got, expected) {
+		t.Errorf("\nexpected:\n%v\ngot:\n%v", expected, got)
+	}
+	if got := d.Lookup("Killing"); got != nil {
+		t.Errorf("\nexpected:\n%v\ngot:\n%v", nil, got)
+	}
+
+	var none *Dictionary
+	if got := none.Lookup("BackOff"); got != nil {
+		t.Errorf("\nexpected:\n%v\ngot:\n%v", nil, got)
+	}
+}
+
+func TestConfigMapSource(t *testing.T) {
+	kc := fake.NewSimpleClientset(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "event-reasons", Namespace: "eventmesh"},
+		Data: map[string]string{ConfigMapKey: `
+- name: BackOff
+  label: 容器重启
+  class_id: 1
+  doc: https://wiki.example.com/backoff
+`},
+	})
+	got, err := NewConfigMapSource(kc, "eventmesh/event-reasons").Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []*model.EventReasons{{Name: "BackOff", Label: "容器重启", ClassId: 1, Doc: "https://wiki.example.com/backoff"}}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("\nexpected:\n%v\ngot:\n%v", expected, got)
+	}
+
+	if _, err := NewConfigMapSource(kc, "eventmesh/missing").Load(); err == nil {
+		t.Errorf("\nexpected:\nan error\ngot:\n%v", err)
+	}
+}
+
+func TestNewDictionaryFor(t *testing.T) {
+	// the configmap source needs the kubernetes client, the db one does not
+	configMap := &config.ReasonDictionaryOpt{Source: config.ReasonSourceConfigMap, ConfigMap: "eventmesh/event-reasons"}
+	if got := NewDictionaryFor(configMap, nil); got != nil {
+		t.Errorf("\nexpected:\n%v\ngot:\n%v", nil, got)
+	}
+	if got := NewDictionaryFor(configMap, fake.NewSimpleClientset()); got == nil || got.source.Name() != "configmap eventmesh/event-reasons" {
+		t.Errorf("\nexpected:\n%v\ngot:\n%v", "configmap eventmesh/event-reasons", got)
+	}
+	if got := NewDictionaryFor(&config.ReasonDictionaryOpt{Source: "db"}, nil); got == nil || got.source.Name() != "db" {
+		t.Errorf("\nexpected:\n%v\ngot:\n%v", "db", got)
+	}
+}
@@ -0,0 +1,92 @@
+package reason
+
+import (
+	"context"
+	"fmt"
+	"github.com/crain-cn/event-mesh/api/model"
+	"gopkg.in/yaml.v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"strings"
+	"time"
+)
+
+// ConfigMapKey is the key of the reasons in the ConfigMap.
+const ConfigMapKey = "reasons.yaml"
+
+const configMapTimeout = 10 * time.Second
+
+type dbSource struct{}
+
+func NewDBSource() Source {
+	return dbSource{}
+}
+
+func (dbSource) Name() string {
+	return "db"
+}
+
+func (dbSource) Load() ([]*model.EventReasons, error) {
+	return model.GetEventReasonsAll()
+}
+
+// configMapSource reads the reasons from a ConfigMap like
+//
+//	data:
+//	  reasons.yaml: |
+//	    - name: BackOff
+//	      label: 容器重启
+//	      class_id: 1
+//	      doc: https://wiki.example.com/k8s/backoff
+type configMapSource struct {
+	kc        kubernetes.Interface
+	namespace string
+	name      string
+}
+
+type configMapReason struct {
+	Name    string `yaml:"name"`
+	Label   string `yaml:"label"`
+	ClassId int    `yaml:"class_id"`
+	Doc     string `yaml:"doc"`
+}
+
+// NewConfigMapSource reads the ConfigMap at ref, namespace/name.
+func NewConfigMapSource(kc kubernetes.Interface, ref string) Source {
+	s := &configMapSource{kc: kc, name: ref}
+	if i := strings.Index(ref, "/"); i >= 0 {
+		s.namespace, s.name = ref[:i], ref[i+1:]
+	}
+	return s
+}
+
+func (s *configMapSource) Name() string {
+	return "configmap " + s.namespace + "/" + s.name
+}
+
+func (s *configMapSource) Load() ([]*model.EventReasons, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), configMapTimeout)
+	defer cancel()
+	cm, err := s.kc.CoreV1().ConfigMaps(s.namespace).Get(ctx, s.name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	data, ok := cm.Data[ConfigMapKey]
+	if !ok {
+		return nil, fmt.Errorf("configmap %s/%s has no %s", s.namespace, s.name, ConfigMapKey)
+	}
+	var items []*configMapReason
+	if err := yaml.Unmarshal([]byte(data), &items); err != nil {
+		return nil, err
+	}
+	reasons := make([]*model.EventReasons, 0, len(items))
+	for _, item := range items {
+		reasons = append(reasons, &model.EventReasons{
+			Name:    item.Name,
+			Label:   item.Label,
+			ClassId: item.ClassId,
+			Doc:     item.Doc,
+		})
+	}
+	return reasons, nil
+}